@@ -35,6 +35,132 @@ const (
 	ManualUpdateStrategyType UpdateStrategyType = "Manual"
 )
 
+// RampCurveType is a string enumeration type that enumerates
+// all possible curves the replicas of a subset follow when converging toward the target.
+type RampCurveType string
+
+const (
+	// ExponentialRampCurveType moves the replicas of a subset by a fixed percentage of the remaining difference
+	// in each reconcile, which is fast at first and eases in.
+	ExponentialRampCurveType RampCurveType = "Exponential"
+	// LinearRampCurveType moves the replicas of a subset by an equal delta in each reconcile.
+	LinearRampCurveType RampCurveType = "Linear"
+	// SCurveRampCurveType moves the replicas of a subset slowly at first, then accelerates, and eases in
+	// when approaching the target.
+	SCurveRampCurveType RampCurveType = "SCurve"
+)
+
+// SubsetReplicasLastStable is the value of subset replicas which holds the replicas of the subset
+// recorded in Status.LastStableSubsetReplicas.
+const SubsetReplicasLastStable = "last-stable"
+
+// ApplyOrderType is a string enumeration type that enumerates
+// all possible orders of applying the replicas of subsets.
+type ApplyOrderType string
+
+const (
+	// DownFirstApplyOrderType scales up subsets only after the subsets being scaled down have removed their
+	// pods, which avoids transient over-commit of a capacity-constrained cluster.
+	DownFirstApplyOrderType ApplyOrderType = "DownFirst"
+	// UpFirstApplyOrderType scales down subsets only after the subsets being scaled up have got all their
+	// pods ready, which keeps the availability during the change.
+	UpFirstApplyOrderType ApplyOrderType = "UpFirst"
+)
+
+// InitialStrategyType is a string enumeration type that enumerates
+// all possible strategies of the first allocation of a UnitedDeployment.
+type InitialStrategyType string
+
+const (
+	// EvenInitialStrategyType spreads the replicas of the first allocation evenly, as the later ones do.
+	EvenInitialStrategyType InitialStrategyType = "Even"
+	// SingleSubsetInitialStrategyType concentrates the replicas of the first allocation into the first subset
+	// whose replicas are not specified, e.g. for a smoke test before spreading.
+	SingleSubsetInitialStrategyType InitialStrategyType = "SingleSubset"
+	// OrderedInitialStrategyType fills the subsets whose replicas are not specified to their max replicas
+	// one by one in the order of Subsets in the first allocation.
+	OrderedInitialStrategyType InitialStrategyType = "Ordered"
+)
+
+// ScheduleStrategyType is a string enumeration type that enumerates
+// all possible strategies of applying the specified replicas of subsets.
+type ScheduleStrategyType string
+
+const (
+	// StrictScheduleStrategyType fails the allocation if the specified replicas of subsets could not be applied
+	// as they are, and keeps the subsets at their current replicas.
+	StrictScheduleStrategyType ScheduleStrategyType = "Strict"
+	// BestEffortScheduleStrategyType caps the specified replicas of subsets within their bounds, and scales them
+	// down proportionally if they sum to more than the replicas of the UnitedDeployment.
+	BestEffortScheduleStrategyType ScheduleStrategyType = "BestEffort"
+)
+
+// TieBreakPolicyType is a string enumeration type that enumerates
+// all possible policies to choose among the subsets tied in an allocation.
+type TieBreakPolicyType string
+
+const (
+	// NameTieBreakPolicyType favors the subsets in the reverse order of their names.
+	NameTieBreakPolicyType TieBreakPolicyType = "Name"
+	// RoundRobinTieBreakPolicyType rotates the favored subsets by the generation of the UnitedDeployment.
+	RoundRobinTieBreakPolicyType TieBreakPolicyType = "RoundRobin"
+	// LeastLoadedTieBreakPolicyType favors the subsets with the most room left below their max replicas.
+	LeastLoadedTieBreakPolicyType TieBreakPolicyType = "LeastLoaded"
+)
+
+// RemainderPolicyType is a string enumeration type that enumerates
+// all possible policies to choose the subsets receiving the replicas left over after the even split.
+type RemainderPolicyType string
+
+const (
+	// SpreadByNameRemainderPolicyType gives the left over replicas to the subsets in the order of their names.
+	SpreadByNameRemainderPolicyType RemainderPolicyType = "SpreadByName"
+	// SpreadBySmallestRemainderPolicyType gives the left over replicas to the subsets with the fewest current replicas.
+	SpreadBySmallestRemainderPolicyType RemainderPolicyType = "SpreadBySmallest"
+	// SpreadByLargestRemainderPolicyType gives the left over replicas to the subsets with the most current replicas.
+	SpreadByLargestRemainderPolicyType RemainderPolicyType = "SpreadByLargest"
+	// RotateRemainderPolicyType gives the left over replicas to the subsets in the rotation of their names starting
+	// from Status.ScaleOutCursor, which advances past the subsets scaled out, so that successive small scale-outs
+	// land on different subsets.
+	RotateRemainderPolicyType RemainderPolicyType = "Rotate"
+)
+
+// RoundingModeType is a string enumeration type that enumerates
+// all possible modes to round the even split of replicas among subsets.
+type RoundingModeType string
+
+const (
+	// LargestRemainderRoundingModeType gives the replicas left over after the even split to the subsets one by one,
+	// so that the shares of subsets differ by at most one and sum to the replicas.
+	LargestRemainderRoundingModeType RoundingModeType = "LargestRemainder"
+	// FloorRoundingModeType rounds the share of each subset down, and drops the replicas left over.
+	FloorRoundingModeType RoundingModeType = "Floor"
+	// CeilRoundingModeType rounds the share of each subset up until the replicas run out, so that the last
+	// subset to get a share takes what is left.
+	CeilRoundingModeType RoundingModeType = "Ceil"
+)
+
+// ScaleInPolicyType is a string enumeration type that enumerates
+// all possible policies to choose the subsets to shrink first on scale-in.
+type ScaleInPolicyType string
+
+const (
+	// MostRecentlyScaledOutScaleInPolicyType shrinks the subsets which were scaled out most recently first,
+	// so that the pods just created are deleted instead of the older ones.
+	MostRecentlyScaledOutScaleInPolicyType ScaleInPolicyType = "MostRecentlyScaledOut"
+)
+
+// SubsetRole is a string enumeration type that enumerates
+// all possible roles of a subset.
+type SubsetRole string
+
+const (
+	// LeaderSubsetRole indicates the subset holds a small fixed number of replicas, like the primary of a database.
+	LeaderSubsetRole SubsetRole = "leader"
+	// FollowerSubsetRole indicates the subset absorbs the replicas left by the leader subset.
+	FollowerSubsetRole SubsetRole = "follower"
+)
+
 // UnitedDeploymentConditionType indicates valid conditions type of a UnitedDeployment.
 type UnitedDeploymentConditionType string
 
@@ -45,6 +171,48 @@ const (
 	SubsetUpdated UnitedDeploymentConditionType = "SubsetUpdated"
 	// SubsetFailure is added to a UnitedDeployment when one of its subsets has failure during its own reconciling.
 	SubsetFailure UnitedDeploymentConditionType = "SubsetFailure"
+	// AllSubsetsUnavailable is added to a UnitedDeployment when none of its subsets could hold any replica,
+	// in which case the subsets are kept at their current replicas.
+	AllSubsetsUnavailable UnitedDeploymentConditionType = "AllSubsetsUnavailable"
+	// MinDomainsUnsatisfied is added to a UnitedDeployment when its replicas could not be spread across
+	// Topology.MinDomains failure domains.
+	MinDomainsUnsatisfied UnitedDeploymentConditionType = "MinDomainsUnsatisfied"
+	// SubsetsRebalancing is added to a UnitedDeployment when the replicas moved between its subsets exceed
+	// Topology.MaxUnavailableDuringRebalance, so that the rebalance continues in the following reconciles.
+	SubsetsRebalancing UnitedDeploymentConditionType = "SubsetsRebalancing"
+	// TotalReplicasCapped is added to a UnitedDeployment when its replicas exceed Topology.MaxTotalReplicas,
+	// so that fewer replicas than Spec.Replicas are distributed among its subsets.
+	TotalReplicasCapped UnitedDeploymentConditionType = "TotalReplicasCapped"
+)
+
+const (
+	// AnnotationRebalanceNow requests a one-time full rebalance of the subset replicas, bypassing the smoothing
+	// of allocation. It takes effect only if its value equals the generation of the UnitedDeployment, and is
+	// removed by the controller once the rebalance is done.
+	AnnotationRebalanceNow = "apps.kruise.io/rebalance-now"
+
+	// AnnotationSubsetUnschedulable marks the workload of a subset as temporarily unschedulable, e.g. when
+	// its zone is cordoned, if its value is "true". The subset is held at its current replicas, and the
+	// replicas which it would receive are allocated to the other subsets until the annotation is removed.
+	AnnotationSubsetUnschedulable = "apps.kruise.io/subset-unschedulable"
+
+	// AnnotationSubsetLastScaledGeneration records on the workload of a subset the generation of the
+	// UnitedDeployment when the subset was scaled out last time.
+	AnnotationSubsetLastScaledGeneration = "apps.kruise.io/subset-last-scaled-generation"
+
+	// AnnotationSubsetReplicasOverride pins the replicas of subsets on a UnitedDeployment, e.g. for canary
+	// experiments. Its value is a JSON map from subset name to replicas, such as {"subset-a": 2}, which takes
+	// precedence over the replicas declared in the topology.
+	AnnotationSubsetReplicasOverride = "apps.kruise.io/subset-replicas-override"
+
+	// AnnotationBurst requests the allocation to fill the headroom reserved by Topology.HeadroomPercent if its
+	// value is "true", e.g. during a traffic burst. The headroom is reserved again once the annotation is removed.
+	AnnotationBurst = "apps.kruise.io/burst"
+
+	// AnnotationFrozenSubsets freezes subsets of a UnitedDeployment at their current replicas, e.g. during
+	// maintenance. Its value is a comma-separated list of subset names, such as "subset-a,subset-b". The frozen
+	// subsets neither grow nor shrink, and the changes of replicas are allocated among the others.
+	AnnotationFrozenSubsets = "apps.kruise.io/frozen-subsets"
 )
 
 // UnitedDeploymentSpec defines the desired state of UnitedDeployment.
@@ -75,6 +243,11 @@ type UnitedDeploymentSpec struct {
 	// If unspecified, defaults to 10.
 	// +optional
 	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Paused indicates the replicas of the subsets are kept at their current replicas rather than allocated
+	// again, e.g. while the UnitedDeployment is being inspected.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
 }
 
 // SubsetTemplate defines the subset template under the UnitedDeployment.
@@ -161,6 +334,265 @@ type Topology struct {
 	// which will be provisioned and managed by UnitedDeployment.
 	// +optional
 	Subsets []Subset `json:"subsets,omitempty"`
+
+	// SmoothingAlphaPercent is the smoothing factor in percentage of the exponential moving average applied
+	// to the calculated replicas of each subset. In each reconcile, the replicas of a subset move from the last
+	// allocated replicas recorded in status toward the calculated replicas by this percentage of the difference,
+	// and by at least one replica. It should be in range [1, 100]. If unspecified or 100, the calculated replicas
+	// are applied immediately.
+	// +optional
+	SmoothingAlphaPercent *int32 `json:"smoothingAlphaPercent,omitempty"`
+
+	// RampCurve indicates the curve the replicas of subsets follow when converging toward the calculated replicas
+	// with SmoothingAlphaPercent, which is Exponential, Linear or SCurve. A Linear or SCurve ramp reaches the
+	// calculated replicas in 100/SmoothingAlphaPercent reconciles, rounded up. Defaults to Exponential.
+	// +optional
+	RampCurve RampCurveType `json:"rampCurve,omitempty"`
+
+	// PreferredWeights indicates the preferred distribution of replicas among the subsets whose replicas are
+	// not specified, as a mapping from subset name to its relative weight. Subsets absent from it have weight 0.
+	// +optional
+	PreferredWeights map[string]int32 `json:"preferredWeights,omitempty"`
+
+	// PreferredBiasPercent indicates how strongly the distribution is nudged toward PreferredWeights. It should be
+	// in range [0, 100]. At 0 the replicas are averaged among the subsets, and at 100 they are distributed by
+	// PreferredWeights as long as the max replicas of subsets allow. Defaults to 100 if PreferredWeights is set.
+	// +optional
+	PreferredBiasPercent *int32 `json:"preferredBiasPercent,omitempty"`
+
+	// HeadroomPercent indicates the percentage of the replicas of the UnitedDeployment which are left unallocated
+	// as burst capacity. It should be in range [0, 100], and the reserved replicas are rounded down. The headroom
+	// never takes the specified replicas of subsets, and is filled while the AnnotationBurst annotation is "true".
+	// +optional
+	HeadroomPercent *int32 `json:"headroomPercent,omitempty"`
+
+	// MaxTotalReplicas is a hard ceiling on the total replicas of the subsets, e.g. to protect the quota of the
+	// cluster. The replicas of the UnitedDeployment are clamped to it before they are distributed, and the
+	// TotalReplicasCapped condition tells whether the clamping occurs. It should not be less than 0.
+	// +optional
+	MaxTotalReplicas *int32 `json:"maxTotalReplicas,omitempty"`
+
+	// MemoryHeadroomWeighting distributes the replicas among the subsets whose replicas are not specified in
+	// proportion to their available memory, as reported by the memory headroom provider of the controller.
+	// It takes effect only if PreferredWeights is not set, and the replicas are averaged if there is no data.
+	// +optional
+	MemoryHeadroomWeighting *MemoryHeadroomWeighting `json:"memoryHeadroomWeighting,omitempty"`
+
+	// MaxActiveSubsets indicates the max number of subsets receiving replicas. The replicas are concentrated into
+	// the subsets in the order of Subsets, and the rest are scaled to 0. More subsets are activated only if
+	// the active ones can not hold the replicas within their max replicas.
+	// +optional
+	MaxActiveSubsets *int32 `json:"maxActiveSubsets,omitempty"`
+
+	// OverflowOrder indicates the chain of overflow subsets by name. The replicas are distributed among the
+	// other subsets first, and spill over to the overflow subsets one by one in this order only when the
+	// subsets before them are filled to their max replicas.
+	// +optional
+	OverflowOrder []string `json:"overflowOrder,omitempty"`
+
+	// FillOrder indicates the order by subset name in which the subsets are filled on scale-out and drained in
+	// reverse on scale-in, as if the subsets listed earlier had higher Subset.Priority. The listed subsets are
+	// given priorities above the ones of the subsets not listed, which go last in their current order.
+	// +optional
+	FillOrder []string `json:"fillOrder,omitempty"`
+
+	// ScaleDownStabilizationWindowSeconds indicates the number of seconds for which past replicas of
+	// the UnitedDeployment are considered when scaling in. The highest replicas desired within the window
+	// are allocated to subsets, so that a brief dip of replicas does not scale in any subset.
+	// +optional
+	ScaleDownStabilizationWindowSeconds *int32 `json:"scaleDownStabilizationWindowSeconds,omitempty"`
+
+	// MinSubsetReplicasChangeIntervalSeconds indicates the minimum number of seconds between two changes of
+	// the replicas of a subset. A change within the interval is deferred until the interval elapses, so that
+	// subsets are not constantly adjusted by small amounts.
+	// +optional
+	MinSubsetReplicasChangeIntervalSeconds *int32 `json:"minSubsetReplicasChangeIntervalSeconds,omitempty"`
+
+	// NodeWarmupSeconds indicates the number of seconds after nodes are added to a subset, as reported by
+	// the node provisioning provider of the controller, during which the subset is not scaled out, so that
+	// the new nodes could fully join the cluster before receiving pods.
+	// +optional
+	NodeWarmupSeconds *int32 `json:"nodeWarmupSeconds,omitempty"`
+
+	// ApplyOrder indicates the order of applying the replicas of subsets, which is DownFirst or UpFirst.
+	// The subsets scaling in the other direction are held at their current replicas until the first ones
+	// are done, across reconciles if needed. If unspecified, all the subsets are scaled at the same time.
+	// +optional
+	ApplyOrder ApplyOrderType `json:"applyOrder,omitempty"`
+
+	// ReservedEmptySubset indicates the name of a subset which is held at 0 replicas and excluded from
+	// the distribution, so that it stays empty as the target of a future canary. The subset receives
+	// replicas again once it is released by clearing this field.
+	// +optional
+	ReservedEmptySubset string `json:"reservedEmptySubset,omitempty"`
+
+	// MaxCostBudget indicates the max total cost of the replicas of all subsets, priced per replica by the cost
+	// provider of the controller. When the budget binds, the cheaper subsets are filled first, and the replicas
+	// which can not be afforded are left unallocated.
+	// +optional
+	MaxCostBudget *int32 `json:"maxCostBudget,omitempty"`
+
+	// InitialStrategy indicates how the replicas are distributed in the first allocation of the UnitedDeployment,
+	// when no subset has been provisioned yet, which is Even, SingleSubset or Ordered. The later allocations
+	// follow the other rules of Topology. Defaults to Even.
+	// +optional
+	InitialStrategy InitialStrategyType `json:"initialStrategy,omitempty"`
+
+	// ScheduleStrategy indicates how the specified replicas of subsets are applied, which is Strict or BestEffort.
+	// With BestEffort, the specified replicas which do not fit are adjusted as closely as possible instead of
+	// failing the allocation, and the adjustments are reported in the allocation result. Defaults to Strict.
+	// +optional
+	ScheduleStrategy ScheduleStrategyType `json:"scheduleStrategy,omitempty"`
+
+	// TieBreak indicates which subsets get the replicas left over after the even or weighted split, when the
+	// subsets are tied by their current replicas, which is Name, RoundRobin or LeastLoaded. Defaults to Name.
+	// +optional
+	TieBreak TieBreakPolicyType `json:"tieBreak,omitempty"`
+
+	// RemainderPolicy indicates which subsets get the replicas left over after the even split, which is
+	// SpreadByName, SpreadBySmallest, SpreadByLargest or Rotate. Subsets of the same current replicas are taken
+	// in the order of their names, or in the rotation recorded by Status.ScaleOutCursor for Rotate. If empty,
+	// the left over replicas are given as TieBreak indicates.
+	// +optional
+	RemainderPolicy RemainderPolicyType `json:"remainderPolicy,omitempty"`
+
+	// RoundingMode indicates how the even split of replicas among the subsets whose replicas are not specified is
+	// rounded, which is LargestRemainder, Floor or Ceil. Floor may leave the allocated replicas below the replicas
+	// of the UnitedDeployment, unless a catch-all subset takes the replicas left over. Defaults to LargestRemainder.
+	// +optional
+	RoundingMode RoundingModeType `json:"roundingMode,omitempty"`
+
+	// StabilityBias indicates that the replicas left over after the even split are moved to the subsets which
+	// already have as many replicas as they would get, so that fewer pods are created and deleted. It takes
+	// precedence over RemainderPolicy, ScaleInPolicy and TieBreak when they would give the plans of more changes.
+	// +optional
+	StabilityBias bool `json:"stabilityBias,omitempty"`
+
+	// AllocationStrategy indicates the name of the allocation strategy registered in the controller which
+	// distributes the replicas among the subsets. If empty or Default, the built-in allocation configured by
+	// the other fields of the topology is used, which is also used if the strategy is not registered.
+	// +optional
+	AllocationStrategy string `json:"allocationStrategy,omitempty"`
+
+	// ScaleInPolicy indicates which subsets lose the replicas left over after the even split on scale-in.
+	// MostRecentlyScaledOut takes the subsets which were scaled out most recently first, which keeps the
+	// ordinals of StatefulSet subsets stable across scale-out and scale-in. If empty, the replicas left over
+	// are given as RemainderPolicy indicates.
+	// +optional
+	ScaleInPolicy ScaleInPolicyType `json:"scaleInPolicy,omitempty"`
+
+	// ReserveUpdateSurge indicates that, while the UnitedDeployment is being updated to a new revision, the
+	// replicas of each subset are kept below the capacity reported by the capacity provider by the max surge
+	// of its workload, so that the surging pods of the update do not exceed the capacity. The replicas over
+	// the reserved capacity are deferred until the update completes.
+	// +optional
+	ReserveUpdateSurge bool `json:"reserveUpdateSurge,omitempty"`
+
+	// MinDomains indicates the minimum number of failure domains which should hold replicas whenever the
+	// replicas of the UnitedDeployment are at least MinDomains. Replicas are moved from the domains holding
+	// more than one replica to the empty ones, if the subsets of the empty domains are not specified and
+	// have room. It should be at least 1.
+	// +optional
+	MinDomains *int32 `json:"minDomains,omitempty"`
+
+	// MinNonEmptySubsets indicates the minimum number of subsets which should hold at least one replica, so that
+	// the replicas are never concentrated in fewer subsets. Replicas are moved from the subsets holding more than
+	// one replica to the empty ones after allocation, and the allocation is rejected if the replicas or the
+	// bounds of subsets do not allow. It should not be less than 0.
+	// +optional
+	MinNonEmptySubsets *int32 `json:"minNonEmptySubsets,omitempty"`
+
+	// CanaryRamp raises the share of a canary subset from 0 to a target percentage of the replicas of the
+	// UnitedDeployment over a period of time, and the rest of the replicas are allocated to the other subsets.
+	// The replicas of the canary subset should not be specified.
+	// +optional
+	CanaryRamp *CanaryRamp `json:"canaryRamp,omitempty"`
+
+	// MaxUnavailableDuringRebalance indicates the max number of replicas a subset could lose in one reconcile
+	// when replicas are moved between subsets. Value can be an absolute number (ex. 5) or a percentage of
+	// the last allocated replicas of the subset (ex. 10%), which is rounded up. At least one replica is removed
+	// in each reconcile, and the rest of the move is done in the following reconciles.
+	// +optional
+	MaxUnavailableDuringRebalance *intstr.IntOrString `json:"maxUnavailableDuringRebalance,omitempty"`
+
+	// MinReplicasPerSubset indicates that the replicas left by the specified subsets should be enough to keep one
+	// replica in each subset whose replicas are not specified. Otherwise the allocation is rejected and the subsets
+	// are kept as they are, instead of draining some of the unspecified subsets.
+	// +optional
+	MinReplicasPerSubset bool `json:"minReplicasPerSubset,omitempty"`
+
+	// PreventScaleInBelowHighWaterMark indicates that the subsets whose replicas are not specified are never scaled
+	// in below the highest replicas they have been scaled to, which are recorded in Status.SubsetHighWaterMarks,
+	// e.g. to keep the caches of the subsets warm. The allocation is rejected as for protected subsets if the
+	// replicas of the UnitedDeployment can not keep all the subsets at their high-water marks.
+	// +optional
+	PreventScaleInBelowHighWaterMark bool `json:"preventScaleInBelowHighWaterMark,omitempty"`
+
+	// GradualStep indicates the max replicas a newly added subset could receive in one reconcile, so that it takes
+	// the replicas from the other subsets gradually instead of at once. A subset is onboarded gradually if it is
+	// added to a UnitedDeployment which has allocated replicas before, its replicas are not specified and it has
+	// no replicas yet, until it receives less than the step in a reconcile.
+	// +optional
+	GradualStep *int32 `json:"gradualStep,omitempty"`
+
+	// MaxSkew indicates the max difference of the replicas between any two subsets whose replicas are not specified,
+	// except the catch-all subset. The replicas are moved from the largest subsets to the smallest ones to keep
+	// the difference within it, and the allocation is rejected if the max or min replicas of subsets do not allow.
+	// It should be greater than 0.
+	// +optional
+	MaxSkew *int32 `json:"maxSkew,omitempty"`
+
+	// GroupReplicas indicates the replicas of the groups of subsets, as a mapping from Subset.Group to its replicas.
+	// The replicas of a group include the specified replicas of its member subsets, and the rest are averaged
+	// among its other member subsets. The other subsets share the replicas left by the groups as usual.
+	// +optional
+	GroupReplicas map[string]int32 `json:"groupReplicas,omitempty"`
+
+	// GroupPercentages indicates the percentages of the replicas of the UnitedDeployment for the groups of subsets,
+	// as a mapping from Subset.Group to its percentage, e.g. 70 for the group of spot subsets and 30 for the group of
+	// on-demand subsets, however many subsets each group has. The replicas of the groups are rounded to sum to the
+	// replicas of the UnitedDeployment, and split among their member subsets as GroupReplicas. The percentages should
+	// sum to 100, and should not be indicated together with GroupReplicas.
+	// +optional
+	GroupPercentages map[string]int32 `json:"groupPercentages,omitempty"`
+}
+
+// MemoryHeadroomWeighting defines the bounds of the shares of subsets distributed by memory headroom.
+type MemoryHeadroomWeighting struct {
+	// MinSharePercent is the min share in percentage of each subset by memory headroom, which is in range
+	// [0, 100]. The shares are clamped into [MinSharePercent, MaxSharePercent] before the replicas are
+	// distributed by them, so that a subset with little headroom is not starved.
+	// +optional
+	MinSharePercent *int32 `json:"minSharePercent,omitempty"`
+
+	// MaxSharePercent is the max share in percentage of each subset by memory headroom, which is in range
+	// [0, 100]. Defaults to 100.
+	// +optional
+	MaxSharePercent *int32 `json:"maxSharePercent,omitempty"`
+}
+
+// CanaryRamp defines the share of a canary subset ramping up over time.
+type CanaryRamp struct {
+	// Subset is the name of the canary subset.
+	Subset string `json:"subset"`
+
+	// TargetPercent is the percentage of the replicas of the UnitedDeployment which the canary subset holds
+	// at the end of the ramp. It should be in range [0, 100].
+	TargetPercent int32 `json:"targetPercent"`
+
+	// RampDurationSeconds is the number of seconds for the share of the canary subset to rise linearly from 0
+	// to TargetPercent, since the ramp started as recorded in Status.CanaryRamp. It should be greater than 0.
+	RampDurationSeconds int32 `json:"rampDurationSeconds"`
+}
+
+// RelativeReplicas defines the replicas of a subset relative to another subset.
+type RelativeReplicas struct {
+	// Subset is the name of the referenced subset.
+	Subset string `json:"subset"`
+
+	// RatioPercent is the replicas of the subset in percentage of the specified replicas of the referenced
+	// subset, which is rounded half up. It should not be less than 0.
+	RatioPercent int32 `json:"ratioPercent"`
 }
 
 // Subset defines the detail of a subset.
@@ -185,8 +617,88 @@ type Subset struct {
 	// percentage like '10%', which means 10% of UnitedDeployment replicas of pods will be distributed
 	// under this subset. If nil, the number of replicas in this subset is determined by controller.
 	// Controller will try to keep all the subsets with nil replicas have average pods.
+	// Replicas could also be 'last-stable', which holds the number of replicas this subset had
+	// when the UnitedDeployment was ready last time.
 	// +optional
 	Replicas *intstr.IntOrString `json:"replicas,omitempty"`
+
+	// Indicates the replicas of this subset relative to another subset, e.g. half of the replicas of it.
+	// The referenced subset should have its replicas specified, directly or through another relative
+	// reference, and the references should not form a cycle. It should not be set together with Replicas.
+	// +optional
+	RelativeTo *RelativeReplicas `json:"relativeTo,omitempty"`
+
+	// Indicates the number of pods which the nodes of this subset reserve for system or daemon workloads.
+	// It is subtracted from MaxReplicas and from the capacity of this subset reported by the capacity provider,
+	// if any is configured, so that the controller leaves room for these pods when allocating replicas.
+	// It takes no effect if neither of them is set.
+	// +optional
+	SystemReservedReplicas *int32 `json:"systemReservedReplicas,omitempty"`
+
+	// Indicates the role of this subset, which is leader or follower. A leader subset holds the number of
+	// replicas indicated by Replicas, or 1 if Replicas is nil, and the followers split the rest replicas.
+	// If roles are indicated, exactly one subset should be the leader.
+	// +optional
+	Role SubsetRole `json:"role,omitempty"`
+
+	// Indicates the names of the subsets this subset depends on. When starting from 0 replicas, this subset
+	// receives no replicas until all its dependencies are ready at their replicas. When scaled down to 0
+	// replicas, the dependencies are not scaled down until this subset is drained.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// Indicates the max percentage of the replicas this subset could lose in one reconcile, which should be
+	// in range [1, 100]. At least one replica is removed in each reconcile, so that the subset always converges.
+	// +optional
+	MaxScaleInPercent *int32 `json:"maxScaleInPercent,omitempty"`
+
+	// Indicates the failure domain of this subset, such as a zone or a rack. Subsets of the same failure domain
+	// are counted as one domain by Topology.MinDomains. If empty, this subset is a failure domain by itself.
+	// +optional
+	FailureDomain string `json:"failureDomain,omitempty"`
+
+	// Indicates the max replicas of this subset. The replicas which this subset could not hold are allocated
+	// to the other subsets whose replicas are not specified. If the capacity provider of the controller reports
+	// a lower capacity of this subset, the capacity is used instead.
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// Indicates the soft min replicas of this subset, which it is given first out of the replicas left by the
+	// subsets whose replicas are specified, before the rest are shared as usual. Unlike a hard floor, if the soft
+	// min replicas of the subsets sum to more than the replicas they share, they yield in proportion to their
+	// soft min replicas instead of rejecting the allocation. It is ignored if the replicas of this subset are
+	// specified, and it should not be less than 0.
+	// +optional
+	SoftMinReplicas *int32 `json:"softMinReplicas,omitempty"`
+
+	// Indicates the priority of this subset, where a higher value means a higher priority. The replicas left
+	// by the subsets whose replicas are specified fill the subsets of higher priorities to their max replicas
+	// before the ones of lower priorities, and are split among the subsets of the same priority. A subset of
+	// a negative priority is a standby subset, which keeps its current replicas as long as the subsets of
+	// non-negative priorities could absorb the change. It grows only if they are full, and shrinks only if they
+	// have no replicas left. The standby subsets of a lower priority are the later to grow and to shrink.
+	// Subsets without priority take the one reported by the scheduling priority provider of the controller, or 0.
+	// +optional
+	Priority *int32 `json:"priority,omitempty"`
+
+	// Indicates that this subset receives exactly the replicas left after the other subsets get their specified
+	// replicas or their shares, which could be zero or the bulk of the replicas. The other subsets whose replicas
+	// are not specified share the replicas as if this subset took an even part of them rounded down, and the
+	// replicas which this subset can not hold are given back to them. At most one subset could be catch-all.
+	// +optional
+	CatchAll bool `json:"catchAll,omitempty"`
+
+	// Indicates that this subset is never shrunk below its current replicas automatically, e.g. since its pods
+	// hold stateful data. It could still grow, and the replicas to scale in are taken from the other subsets.
+	// It is shrunk only if its replicas are specified explicitly below the current ones.
+	// +optional
+	Protected bool `json:"protected,omitempty"`
+
+	// Indicates the group of this subset, such as the region containing the zone of this subset or the kind of
+	// its nodes, e.g. spot or on-demand. The replicas indicated for the group in Topology.GroupReplicas or
+	// Topology.GroupPercentages are split among the subsets of the group.
+	// +optional
+	Group string `json:"group,omitempty"`
 }
 
 // UnitedDeploymentStatus defines the observed state of UnitedDeployment.
@@ -223,6 +735,10 @@ type UnitedDeploymentStatus struct {
 	// +optional
 	SubsetReplicas map[string]int32 `json:"subsetReplicas,omitempty"`
 
+	// Records the replicas of each subset when all the replicas of the UnitedDeployment were ready last time.
+	// +optional
+	LastStableSubsetReplicas map[string]int32 `json:"lastStableSubsetReplicas,omitempty"`
+
 	// Represents the latest available observations of a UnitedDeployment's current state.
 	// +optional
 	Conditions []UnitedDeploymentCondition `json:"conditions,omitempty"`
@@ -230,6 +746,89 @@ type UnitedDeploymentStatus struct {
 	// Records the information of update progress.
 	// +optional
 	UpdateStatus *UpdateStatus `json:"updateStatus,omitempty"`
+
+	// Records the replicas desired within the scale down stabilization window, in order of time.
+	// +optional
+	ReplicasHistory []ReplicasHistoryRecord `json:"replicasHistory,omitempty"`
+
+	// Records the progress of the Linear or SCurve ramps of subsets which are converging toward their targets.
+	// +optional
+	SubsetRamps map[string]SubsetRamp `json:"subsetRamps,omitempty"`
+
+	// Records the last time the replicas of each subset changed, when a minimum change interval is indicated.
+	// +optional
+	SubsetReplicasChangeTimes map[string]metav1.Time `json:"subsetReplicasChangeTimes,omitempty"`
+
+	// Records the subsets which are being onboarded gradually by Topology.GradualStep.
+	// +optional
+	OnboardingSubsets []string `json:"onboardingSubsets,omitempty"`
+
+	// Records the subsets which got a replica more or less than their ideal shares rounded to the nearest integer,
+	// so that the allocated replicas sum to the replicas of the UnitedDeployment.
+	// +optional
+	RoundingAdjustments map[string]SubsetRoundingAdjustment `json:"roundingAdjustments,omitempty"`
+
+	// Records the index, among the subsets sorted by name, of the subset which gets the next replica left over
+	// after the even split, when Topology.RemainderPolicy is Rotate.
+	// +optional
+	ScaleOutCursor int32 `json:"scaleOutCursor,omitempty"`
+
+	// Records when the ramp of Topology.CanaryRamp started. The ramp restarts if the canary subset changes.
+	// +optional
+	CanaryRamp *CanaryRampStatus `json:"canaryRamp,omitempty"`
+
+	// Explains why each subset gets its replicas in the last allocation, with a line for each subset sorted by name
+	// telling its replicas and the rationale of them. It is recorded only if the allocation rationale of the
+	// controller is enabled.
+	// +optional
+	AllocationExplanation string `json:"allocationExplanation,omitempty"`
+
+	// Records the highest replicas each subset has been scaled to, when Topology.PreventScaleInBelowHighWaterMark
+	// is enabled.
+	// +optional
+	SubsetHighWaterMarks map[string]int32 `json:"subsetHighWaterMarks,omitempty"`
+}
+
+// CanaryRampStatus records the start of the ramp of a canary subset.
+type CanaryRampStatus struct {
+	// Subset is the name of the canary subset.
+	Subset string `json:"subset"`
+
+	// StartTime is when the ramp started.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// SubsetRoundingAdjustment records the difference between the replicas allocated to a subset and its ideal share.
+type SubsetRoundingAdjustment struct {
+	// IdealMilliReplicas is the unrounded share of the subset in thousandths of a replica.
+	IdealMilliReplicas int64 `json:"idealMilliReplicas"`
+
+	// Adjustment is the allocated replicas minus the ideal share rounded to the nearest integer.
+	Adjustment int32 `json:"adjustment"`
+
+	// Reason explains why the subset got the adjustment.
+	Reason string `json:"reason"`
+}
+
+// SubsetRamp records the progress of a subset converging toward its target replicas.
+type SubsetRamp struct {
+	// From is the replicas of the subset when the ramp started.
+	From int32 `json:"from"`
+
+	// To is the target replicas of the ramp.
+	To int32 `json:"to"`
+
+	// Step is the number of reconciles the ramp has gone through.
+	Step int32 `json:"step"`
+}
+
+// ReplicasHistoryRecord records the replicas of a UnitedDeployment desired since a point in time.
+type ReplicasHistoryRecord struct {
+	// Replicas is the desired replicas of the UnitedDeployment.
+	Replicas int32 `json:"replicas"`
+
+	// Time is when the UnitedDeployment started to desire the replicas.
+	Time metav1.Time `json:"time"`
 }
 
 // UnitedDeploymentCondition describes current state of a UnitedDeployment.
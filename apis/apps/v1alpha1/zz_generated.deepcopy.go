@@ -321,6 +321,37 @@ func (in *BroadcastJobTemplateSpec) DeepCopy() *BroadcastJobTemplateSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryRamp) DeepCopyInto(out *CanaryRamp) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryRamp.
+func (in *CanaryRamp) DeepCopy() *CanaryRamp {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryRamp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryRampStatus) DeepCopyInto(out *CanaryRampStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryRampStatus.
+func (in *CanaryRampStatus) DeepCopy() *CanaryRampStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryRampStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloneSet) DeepCopyInto(out *CloneSet) {
 	*out = *in
@@ -1713,6 +1744,31 @@ func (in *ManualUpdate) DeepCopy() *ManualUpdate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemoryHeadroomWeighting) DeepCopyInto(out *MemoryHeadroomWeighting) {
+	*out = *in
+	if in.MinSharePercent != nil {
+		in, out := &in.MinSharePercent, &out.MinSharePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxSharePercent != nil {
+		in, out := &in.MaxSharePercent, &out.MaxSharePercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemoryHeadroomWeighting.
+func (in *MemoryHeadroomWeighting) DeepCopy() *MemoryHeadroomWeighting {
+	if in == nil {
+		return nil
+	}
+	out := new(MemoryHeadroomWeighting)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeImage) DeepCopyInto(out *NodeImage) {
 	*out = *in
@@ -2385,6 +2441,37 @@ func (in *ReferenceObject) DeepCopy() *ReferenceObject {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RelativeReplicas) DeepCopyInto(out *RelativeReplicas) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RelativeReplicas.
+func (in *RelativeReplicas) DeepCopy() *RelativeReplicas {
+	if in == nil {
+		return nil
+	}
+	out := new(RelativeReplicas)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicasHistoryRecord) DeepCopyInto(out *ReplicasHistoryRecord) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicasHistoryRecord.
+func (in *ReplicasHistoryRecord) DeepCopy() *ReplicasHistoryRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicasHistoryRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceDistribution) DeepCopyInto(out *ResourceDistribution) {
 	*out = *in
@@ -3165,6 +3252,41 @@ func (in *Subset) DeepCopyInto(out *Subset) {
 		*out = new(intstr.IntOrString)
 		**out = **in
 	}
+	if in.RelativeTo != nil {
+		in, out := &in.RelativeTo, &out.RelativeTo
+		*out = new(RelativeReplicas)
+		**out = **in
+	}
+	if in.SystemReservedReplicas != nil {
+		in, out := &in.SystemReservedReplicas, &out.SystemReservedReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxScaleInPercent != nil {
+		in, out := &in.MaxScaleInPercent, &out.MaxScaleInPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SoftMinReplicas != nil {
+		in, out := &in.SoftMinReplicas, &out.SoftMinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Subset.
@@ -3177,6 +3299,36 @@ func (in *Subset) DeepCopy() *Subset {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubsetRamp) DeepCopyInto(out *SubsetRamp) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubsetRamp.
+func (in *SubsetRamp) DeepCopy() *SubsetRamp {
+	if in == nil {
+		return nil
+	}
+	out := new(SubsetRamp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubsetRoundingAdjustment) DeepCopyInto(out *SubsetRoundingAdjustment) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubsetRoundingAdjustment.
+func (in *SubsetRoundingAdjustment) DeepCopy() *SubsetRoundingAdjustment {
+	if in == nil {
+		return nil
+	}
+	out := new(SubsetRoundingAdjustment)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubsetTemplate) DeepCopyInto(out *SubsetTemplate) {
 	*out = *in
@@ -3253,6 +3405,117 @@ func (in *Topology) DeepCopyInto(out *Topology) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.SmoothingAlphaPercent != nil {
+		in, out := &in.SmoothingAlphaPercent, &out.SmoothingAlphaPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PreferredWeights != nil {
+		in, out := &in.PreferredWeights, &out.PreferredWeights
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PreferredBiasPercent != nil {
+		in, out := &in.PreferredBiasPercent, &out.PreferredBiasPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.HeadroomPercent != nil {
+		in, out := &in.HeadroomPercent, &out.HeadroomPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxTotalReplicas != nil {
+		in, out := &in.MaxTotalReplicas, &out.MaxTotalReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MemoryHeadroomWeighting != nil {
+		in, out := &in.MemoryHeadroomWeighting, &out.MemoryHeadroomWeighting
+		*out = new(MemoryHeadroomWeighting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxActiveSubsets != nil {
+		in, out := &in.MaxActiveSubsets, &out.MaxActiveSubsets
+		*out = new(int32)
+		**out = **in
+	}
+	if in.OverflowOrder != nil {
+		in, out := &in.OverflowOrder, &out.OverflowOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FillOrder != nil {
+		in, out := &in.FillOrder, &out.FillOrder
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ScaleDownStabilizationWindowSeconds != nil {
+		in, out := &in.ScaleDownStabilizationWindowSeconds, &out.ScaleDownStabilizationWindowSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinSubsetReplicasChangeIntervalSeconds != nil {
+		in, out := &in.MinSubsetReplicasChangeIntervalSeconds, &out.MinSubsetReplicasChangeIntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.NodeWarmupSeconds != nil {
+		in, out := &in.NodeWarmupSeconds, &out.NodeWarmupSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxCostBudget != nil {
+		in, out := &in.MaxCostBudget, &out.MaxCostBudget
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinDomains != nil {
+		in, out := &in.MinDomains, &out.MinDomains
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinNonEmptySubsets != nil {
+		in, out := &in.MinNonEmptySubsets, &out.MinNonEmptySubsets
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CanaryRamp != nil {
+		in, out := &in.CanaryRamp, &out.CanaryRamp
+		*out = new(CanaryRamp)
+		**out = **in
+	}
+	if in.MaxUnavailableDuringRebalance != nil {
+		in, out := &in.MaxUnavailableDuringRebalance, &out.MaxUnavailableDuringRebalance
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.GradualStep != nil {
+		in, out := &in.GradualStep, &out.GradualStep
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxSkew != nil {
+		in, out := &in.MaxSkew, &out.MaxSkew
+		*out = new(int32)
+		**out = **in
+	}
+	if in.GroupReplicas != nil {
+		in, out := &in.GroupReplicas, &out.GroupReplicas
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.GroupPercentages != nil {
+		in, out := &in.GroupPercentages, &out.GroupPercentages
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Topology.
@@ -3413,6 +3676,13 @@ func (in *UnitedDeploymentStatus) DeepCopyInto(out *UnitedDeploymentStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.LastStableSubsetReplicas != nil {
+		in, out := &in.LastStableSubsetReplicas, &out.LastStableSubsetReplicas
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]UnitedDeploymentCondition, len(*in))
@@ -3425,6 +3695,51 @@ func (in *UnitedDeploymentStatus) DeepCopyInto(out *UnitedDeploymentStatus) {
 		*out = new(UpdateStatus)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ReplicasHistory != nil {
+		in, out := &in.ReplicasHistory, &out.ReplicasHistory
+		*out = make([]ReplicasHistoryRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SubsetRamps != nil {
+		in, out := &in.SubsetRamps, &out.SubsetRamps
+		*out = make(map[string]SubsetRamp, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SubsetReplicasChangeTimes != nil {
+		in, out := &in.SubsetReplicasChangeTimes, &out.SubsetReplicasChangeTimes
+		*out = make(map[string]metav1.Time, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.OnboardingSubsets != nil {
+		in, out := &in.OnboardingSubsets, &out.OnboardingSubsets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RoundingAdjustments != nil {
+		in, out := &in.RoundingAdjustments, &out.RoundingAdjustments
+		*out = make(map[string]SubsetRoundingAdjustment, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.CanaryRamp != nil {
+		in, out := &in.CanaryRamp, &out.CanaryRamp
+		*out = new(CanaryRampStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SubsetHighWaterMarks != nil {
+		in, out := &in.SubsetHighWaterMarks, &out.SubsetHighWaterMarks
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnitedDeploymentStatus.
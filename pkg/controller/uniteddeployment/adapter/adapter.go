@@ -33,6 +33,9 @@ type Adapter interface {
 	GetStatusObservedGeneration(subset metav1.Object) int64
 	// GetReplicaDetails returns the replicas information of the subset status.
 	GetReplicaDetails(subset metav1.Object, updatedRevision string) (specReplicas, specPartition *int32, statusReplicas, statusReadyReplicas, statusUpdatedReplicas, statusUpdatedReadyReplicas int32, err error)
+	// GetMaxSurge returns the max number of pods that can be scheduled above the desired replicas of the subset
+	// during its rolling update, or nil if the subset does not surge.
+	GetMaxSurge(subset metav1.Object) *int32
 	// GetSubsetFailure returns failure information of the subset.
 	GetSubsetFailure() *string
 	// ApplySubsetTemplate updates the subset to the latest revision.
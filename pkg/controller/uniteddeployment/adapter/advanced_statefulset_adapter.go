@@ -83,6 +83,11 @@ func (a *AdvancedStatefulSetAdapter) GetReplicaDetails(obj metav1.Object, update
 	return
 }
 
+// GetMaxSurge returns nil, since AdvancedStatefulSet never surges during its rolling update.
+func (a *AdvancedStatefulSetAdapter) GetMaxSurge(obj metav1.Object) *int32 {
+	return nil
+}
+
 // GetSubsetFailure returns the failure information of the subset.
 // AdvancedStatefulSet has no condition.
 func (a *AdvancedStatefulSetAdapter) GetSubsetFailure() *string {
@@ -63,6 +63,23 @@ func (a *CloneSetAdapter) GetReplicaDetails(obj metav1.Object, updatedRevision s
 	return
 }
 
+func (a *CloneSetAdapter) GetMaxSurge(obj metav1.Object) *int32 {
+	set := obj.(*alpha1.CloneSet)
+	if set.Spec.UpdateStrategy.MaxSurge == nil {
+		return nil
+	}
+
+	var replicas int
+	if set.Spec.Replicas != nil {
+		replicas = int(*set.Spec.Replicas)
+	}
+	maxSurge, err := intstr.GetValueFromIntOrPercent(set.Spec.UpdateStrategy.MaxSurge, replicas, true)
+	if err != nil {
+		return nil
+	}
+	return utilpointer.Int32Ptr(int32(maxSurge))
+}
+
 func (a *CloneSetAdapter) GetSubsetFailure() *string {
 	return nil
 }
@@ -24,6 +24,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilpointer "k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
@@ -74,6 +76,25 @@ func (a *DeploymentAdapter) GetReplicaDetails(obj metav1.Object, updatedRevision
 	return
 }
 
+// GetMaxSurge returns the max surge of the Deployment rolling update.
+func (a *DeploymentAdapter) GetMaxSurge(obj metav1.Object) *int32 {
+	set := obj.(*appsv1.Deployment)
+	if set.Spec.Strategy.Type != appsv1.RollingUpdateDeploymentStrategyType ||
+		set.Spec.Strategy.RollingUpdate == nil || set.Spec.Strategy.RollingUpdate.MaxSurge == nil {
+		return nil
+	}
+
+	var replicas int
+	if set.Spec.Replicas != nil {
+		replicas = int(*set.Spec.Replicas)
+	}
+	maxSurge, err := intstr.GetValueFromIntOrPercent(set.Spec.Strategy.RollingUpdate.MaxSurge, replicas, true)
+	if err != nil {
+		return nil
+	}
+	return utilpointer.Int32Ptr(int32(maxSurge))
+}
+
 // GetSubsetFailure returns the failure information of the subset.
 // Deployment has no condition.
 func (a *DeploymentAdapter) GetSubsetFailure() *string {
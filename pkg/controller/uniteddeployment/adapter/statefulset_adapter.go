@@ -80,6 +80,11 @@ func (a *StatefulSetAdapter) GetReplicaDetails(obj metav1.Object, updatedRevisio
 	return
 }
 
+// GetMaxSurge returns nil, since StatefulSet never surges during its rolling update.
+func (a *StatefulSetAdapter) GetMaxSurge(obj metav1.Object) *int32 {
+	return nil
+}
+
 // GetSubsetFailure returns the failure information of the subset.
 // StatefulSet has no condition.
 func (a *StatefulSetAdapter) GetSubsetFailure() *string {
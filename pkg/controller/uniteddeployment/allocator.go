@@ -17,23 +17,77 @@ limitations under the License.
 package uniteddeployment
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
 
-	"k8s.io/klog/v2"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2/klogr"
 
 	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
 )
 
+// allocationLogger logs the allocation of replicas with key-value pairs, such as namespace, name, subset and err.
+// Tests could replace it to capture the log output.
+var allocationLogger = klogr.New()
+
+// allocationLoggerFor returns allocationLogger with the namespace and name of the UnitedDeployment.
+func allocationLoggerFor(ud *appsv1alpha1.UnitedDeployment) logr.Logger {
+	return allocationLogger.WithValues("namespace", ud.Namespace, "name", ud.Name)
+}
+
 type nameToReplicas struct {
 	SubsetName string
 	Replicas   int32
 	Specified  bool
+
+	// MinReplicas and MaxReplicas bound the replicas which could be allocated to the subset.
+	// Nil means no bound in that direction. MinReplicas of a protected subset is its current replicas.
+	MinReplicas *int32
+	MaxReplicas *int32
+	// StepMaxReplicas bounds the replicas which could be allocated to the subset in this round only.
+	// The replicas exceeding it are deferred to the following rounds rather than rejected.
+	StepMaxReplicas *int32
+	// SoftMinReplicas is the replicas which the subset is given first if its replicas are not specified, which yield
+	// in proportion with the ones of the other subsets if there are not enough replicas for all of them.
+	SoftMinReplicas *int32
+
+	// LastScaledGeneration is the generation of the UnitedDeployment when the subset was scaled out last time.
+	LastScaledGeneration int64
+	// CatchAll marks the subset receiving exactly the replicas left after the other subsets get their shares.
+	CatchAll bool
+	// PinnedBy is the constraint which pins the replicas of the subset at its boundary in the allocation, which is
+	// pinnedByMax, pinnedByMin or pinnedBySkew, or empty if the subset is not pinned.
+	PinnedBy string
+}
+
+// upperBound returns the max replicas which could be allocated to the subset in this round, or nil if unbounded.
+func (n *nameToReplicas) upperBound() *int32 {
+	if n.StepMaxReplicas == nil || (n.MaxReplicas != nil && *n.MaxReplicas < *n.StepMaxReplicas) {
+		return n.MaxReplicas
+	}
+	return n.StepMaxReplicas
 }
 
 type subsetInfos []*nameToReplicas
 
+// clone returns a copy of the subsets, whose replicas could be allocated without changing the original ones.
+func (n subsetInfos) clone() subsetInfos {
+	cloned := make(subsetInfos, len(n))
+	for i, subset := range n {
+		copied := *subset
+		cloned[i] = &copied
+	}
+	return cloned
+}
+
 func (n subsetInfos) Get(i int) *nameToReplicas {
 	return []*nameToReplicas(n)[i]
 }
@@ -43,35 +97,439 @@ func (n subsetInfos) Len() int {
 }
 
 func (n subsetInfos) Less(i, j int) bool {
-	if n[i].Replicas != n[j].Replicas {
-		return n[i].Replicas < n[j].Replicas
-	}
-
-	return strings.Compare(n[i].SubsetName, n[j].SubsetName) < 0
+	return defaultSubsetComparator(n[i], n[j])
 }
 
 func (n subsetInfos) Swap(i, j int) {
 	n[i], n[j] = n[j], n[i]
 }
 
+// subsetComparator reports whether subset a should be sorted before subset b.
+type subsetComparator func(a, b *nameToReplicas) bool
+
+// defaultSubsetComparator sorts subsets by replicas in order of increment, and then by name.
+var defaultSubsetComparator = chainSubsetComparators(lessByReplicas, lessBySubsetName)
+
+func lessByReplicas(a, b *nameToReplicas) bool {
+	return a.Replicas < b.Replicas
+}
+
+func lessBySubsetName(a, b *nameToReplicas) bool {
+	return strings.Compare(a.SubsetName, b.SubsetName) < 0
+}
+
+// getTieBreakComparators returns the comparators sorting the subsets by Topology.TieBreak when they have the same
+// replicas. The subsets sorted at the end are favored by the remainders of the split.
+func getTieBreakComparators(ud *appsv1alpha1.UnitedDeployment) []subsetComparator {
+	switch ud.Spec.Topology.TieBreak {
+	case appsv1alpha1.RoundRobinTieBreakPolicyType:
+		names := make([]string, 0, len(ud.Spec.Topology.Subsets))
+		for _, subset := range ud.Spec.Topology.Subsets {
+			names = append(names, subset.Name)
+		}
+		sort.Strings(names)
+		rank := make(map[string]int64, len(names))
+		for i, name := range names {
+			rank[name] = (int64(i) + ud.Generation) % int64(len(names))
+		}
+		return []subsetComparator{lessByReplicas, func(a, b *nameToReplicas) bool {
+			return rank[a.SubsetName] < rank[b.SubsetName]
+		}}
+	case appsv1alpha1.LeastLoadedTieBreakPolicyType:
+		return []subsetComparator{lessByReplicas, lessByHeadroom, lessBySubsetName}
+	}
+	return nil
+}
+
+// lessByHeadroom sorts subsets by the room left below their upper bounds in order of increment. Unbounded subsets
+// have the most room.
+func lessByHeadroom(a, b *nameToReplicas) bool {
+	boundA, boundB := a.upperBound(), b.upperBound()
+	if boundA == nil || boundB == nil {
+		return boundA != nil && boundB == nil
+	}
+	return *boundA-a.Replicas < *boundB-b.Replicas
+}
+
+// lessByPriority sorts subsets by their priorities in order of increment, so that the subsets of higher priorities
+// are favored by the remainders of the split.
+func lessByPriority(priorities map[string]int32) subsetComparator {
+	return func(a, b *nameToReplicas) bool {
+		return priorities[a.SubsetName] < priorities[b.SubsetName]
+	}
+}
+
+// chainSubsetComparators composes comparators into one, which consults each of them in order
+// until one of them tells the two subsets apart.
+func chainSubsetComparators(comparators ...subsetComparator) subsetComparator {
+	return func(a, b *nameToReplicas) bool {
+		for _, less := range comparators {
+			if less(a, b) {
+				return true
+			}
+			if less(b, a) {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// subsetSorter sorts subsetInfos by a comparator.
+type subsetSorter struct {
+	subsetInfos
+	less subsetComparator
+}
+
+func (s subsetSorter) Less(i, j int) bool {
+	return s.less(s.subsetInfos[i], s.subsetInfos[j])
+}
+
+// getUnitedDeploymentReplicas returns the total desired replicas of the UnitedDeployment. Nil replicas
+// are regarded as 1, the same as the default of Spec.Replicas, since the UnitedDeployment may not have
+// been defaulted yet.
+func getUnitedDeploymentReplicas(ud *appsv1alpha1.UnitedDeployment) int32 {
+	if ud.Spec.Replicas == nil {
+		return 1
+	}
+	return *ud.Spec.Replicas
+}
+
 // GetAllocatedReplicas returns a mapping from subset to next replicas.
 // Next replicas is allocated by replicasAllocator, which will consider the current replicas of each subset and
 // new replicas indicated from UnitedDeployment.Spec.Topology.Subsets.
-func GetAllocatedReplicas(nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) (*map[string]int32, error) {
-	subsetInfos := getSubsetInfos(nameToSubset, ud)
-	specifiedReplicas := getSpecifiedSubsetReplicas(ud)
+// It gives up with an error of CancelledAllocationReason once ctx is cancelled or has expired.
+func GetAllocatedReplicas(ctx context.Context, nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) (*map[string]int32, error) {
+	result := GetAllocationResult(ctx, nameToSubset, ud)
+	return result.SubsetReplicas, result.err
+}
 
+// GetAllocationResult is the structured form of GetAllocatedReplicas, which tells why the allocation is ineffective
+// by a machine-readable reason code.
+func GetAllocationResult(ctx context.Context, nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) *AllocationResult {
+	nextReplicas, status, err := allocateSubsetReplicas(ctx, nameToSubset, ud)
+	result := newAllocationResult(nextReplicas, err)
+	result.Rationale = status.rationale
+	result.SpecifiedSubsets = status.specifiedSubsets
+	result.SpecifiedAdjustments = status.specifiedAdjustments
+	result.PinnedSubsets = status.pinnedSubsets
+	if nextReplicas != nil {
+		result.ChurnRatio = ChurnRatio(getCurrentSubsetReplicas(nameToSubset), *nextReplicas)
+	}
+	if status.paused {
+		result.ReasonCode = PausedAllocationReason
+		result.Message = "UnitedDeployment is paused, so the current replicas of subsets are kept"
+	}
+	return result
+}
+
+// errAllSubsetsUnavailable is returned along with the current replicas of subsets if none of the subsets could
+// hold any replica, so that a misconfiguration does not scale all the running pods in.
+var errAllSubsetsUnavailable = newAllocationError(AllSubsetsUnavailableAllocationReason, "all subsets are unavailable to hold any replica")
+
+// allocationStatus holds the details of an allocation which should be recorded in the status of the UnitedDeployment.
+type allocationStatus struct {
+	// subsetRamps is the progress of the subset ramps recorded in Status.SubsetRamps.
+	subsetRamps map[string]appsv1alpha1.SubsetRamp
+	// roundingAdjustments is recorded in Status.RoundingAdjustments.
+	roundingAdjustments map[string]appsv1alpha1.SubsetRoundingAdjustment
+	// unsatisfiedDomainsReason is the message of the MinDomainsUnsatisfied condition if not empty.
+	unsatisfiedDomainsReason string
+	// totalCappedReason is the message of the TotalReplicasCapped condition if not empty.
+	totalCappedReason string
+	// rebalancing is true if the replicas moved between subsets are limited by MaxUnavailableDuringRebalance.
+	rebalancing bool
+	// rationale explains why each subset gets its replicas if allocationRationale is enabled.
+	rationale map[string]string
+	// onboardingSubsets is recorded in Status.OnboardingSubsets.
+	onboardingSubsets []string
+	// specifiedSubsets is the sorted names of the subsets whose replicas are specified.
+	specifiedSubsets []string
+	// specifiedAdjustments is the specified replicas adjusted by the BestEffort schedule strategy.
+	specifiedAdjustments map[string]SpecifiedReplicasAdjustment
+	// scaleOutCursor is recorded in Status.ScaleOutCursor if it is not nil.
+	scaleOutCursor *int32
+	// pinnedSubsets is a mapping from the name of each subset pinned at a boundary to the constraint pinning it.
+	pinnedSubsets map[string]string
+	// paused is true if the current replicas of subsets are kept since the UnitedDeployment is paused.
+	paused bool
+}
+
+// allocateSubsetReplicas returns the next replicas of each subset, together with the details of the allocation
+// which should be recorded in the status. The allocation is given up between its steps and within the loops moving
+// replicas one by one once ctx is cancelled.
+func allocateSubsetReplicas(ctx context.Context, nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) (*map[string]int32, allocationStatus, error) {
+	if ud.Spec.Paused {
+		// keep the current replicas verbatim rather than allocating them again, and the progress recorded in status
+		current := getCurrentSubsetReplicas(nameToSubset)
+		return &current, allocationStatus{paused: true, subsetRamps: ud.Status.SubsetRamps, roundingAdjustments: ud.Status.RoundingAdjustments,
+			onboardingSubsets: ud.Status.OnboardingSubsets}, nil
+	}
+	if err := allocationCancelled(ctx); err != nil {
+		return nil, allocationStatus{}, err
+	}
+	subsetInfos, err := getSubsetInfos(ctx, nameToSubset, ud)
+	if err != nil {
+		return nil, allocationStatus{}, err
+	}
+	specifiedReplicas, err := getSpecifiedSubsetReplicas(ud)
+	if err != nil {
+		return nil, allocationStatus{}, err
+	}
+	replicas, totalCappedReason := capTotalReplicas(ud, getStabilizedReplicas(ud))
+	if totalCappedReason != "" {
+		allocationLoggerFor(ud).Info("Cap the replicas to allocate", "reason", totalCappedReason)
+	}
+	if replicas > 0 && len(*subsetInfos) == 0 {
+		return nil, allocationStatus{}, newAllocationError(NoSubsetsAllocationReason, "no subsets defined to place %d replicas", replicas)
+	}
+	if targets := getExternalSubsetTargets(ctx, ud, replicas); targets != nil {
+		specifiedReplicas = targets
+	}
+	protectSubsets(ud, subsetInfos, specifiedReplicas)
+	keepHighWaterMarks(ud, subsetInfos, specifiedReplicas)
+	if err := allocationCancelled(ctx); err != nil {
+		return nil, allocationStatus{}, err
+	}
+	if specifiedReplicas, err = getGroupSpecifiedReplicas(ud, subsetInfos, replicas, specifiedReplicas); err != nil {
+		return nil, allocationStatus{}, err
+	}
+	if err := validateFrozenSubsets(ud, replicas, specifiedReplicas); err != nil {
+		return nil, allocationStatus{}, err
+	}
+	var adjustments map[string]SpecifiedReplicasAdjustment
+	if isBestEffortSchedule(ud) {
+		if specifiedReplicas, adjustments = fitSpecifiedReplicas(subsetInfos, replicas, specifiedReplicas); len(adjustments) > 0 {
+			allocationLoggerFor(ud).Info("Adjust the specified replicas which do not fit", "adjustments", adjustments)
+		}
+	}
 	// call SortToAllocator to sort all subset by subset.Replicas in order of increment
-	return subsetInfos.SortToAllocator().AllocateReplicas(*ud.Spec.Replicas, specifiedReplicas)
+	allocator := subsetInfos.SortToAllocator(getTieBreakComparators(ud)...)
+	allocator.ctx = ctx
+	configureAllocator(allocator, ud)
+	allocator.rationale = newAllocationRationale()
+	if len(*nameToSubset) == 0 && len(ud.Status.SubsetReplicas) == 0 {
+		allocator.initialStrategy = ud.Spec.Topology.InitialStrategy
+	}
+	if replicas > 0 && allocator.allSubsetsUnavailable(specifiedReplicas) {
+		return allocator.toSubsetReplicaMap(), allocationStatus{}, errAllSubsetsUnavailable
+	}
+	input := allocator.allocationInput(ud, replicas, specifiedReplicas)
+	nextReplicas := allocateByPlugin(ctx, ud, input)
+	var incremental *map[string]int32
+	rationale := explainAll(nextReplicas, "plugin")
+	strategy := getAllocationStrategy(ud)
+	if nextReplicas == nil && strategy == nil {
+		// the built-in allocation adjusts only the drifted subset if it could, which is damped and reviewed as usual
+		if nextReplicas = allocateIncrementally(ctx, ud, subsetInfos, specifiedReplicas); nextReplicas != nil {
+			rationale = explainAll(nextReplicas, "incremental")
+		}
+	}
+	if nextReplicas == nil && strategy != nil {
+		if nextReplicas, err = allocator.allocateByStrategy(ud, strategy, input, specifiedReplicas); err != nil {
+			return nil, allocationStatus{}, err
+		}
+		rationale = explainAll(nextReplicas, "strategy="+ud.Spec.Topology.AllocationStrategy)
+	} else if nextReplicas == nil {
+		if nextReplicas, err = allocator.AllocateReplicas(replicas, specifiedReplicas); err != nil {
+			return nil, allocationStatus{}, err
+		}
+		rationale = allocator.rationale
+		incremental = scaleOutIncrementally(ud, subsetInfos, specifiedReplicas, nextReplicas)
+	}
+	status := allocationStatus{roundingAdjustments: allocator.roundingAdjustments, unsatisfiedDomainsReason: allocator.unsatisfiedDomainsReason,
+		pinnedSubsets: allocator.pinnedSubsets()}
+	if incremental != nil {
+		// the subsets left short of their weighted targets are neither rounded nor pinned as the allocator planned
+		explainChanges(rationale, nextReplicas, incremental, "incremental scale-out")
+		nextReplicas, status.roundingAdjustments, status.pinnedSubsets = incremental, nil, nil
+	}
+	if len(allocator.rotationNames) > 0 {
+		status.scaleOutCursor = &allocator.scaleOutCursor
+	}
+
+	smoothed, ramps := smoothAllocatedReplicas(ud, nextReplicas)
+	explainChanges(rationale, nextReplicas, smoothed, "smoothed")
+	status.subsetRamps = ramps
+	scaleInLimited := limitSubsetScaleIn(ud, smoothed)
+	explainChanges(rationale, smoothed, scaleInLimited, "scale-in limited")
+	limited, rebalancing := limitRebalance(ud, scaleInLimited)
+	explainChanges(rationale, scaleInLimited, limited, "rebalance limited")
+	status.rebalancing = rebalancing
+	deferred := deferSubsetReplicasChanges(ud, limited)
+	explainChanges(rationale, limited, deferred, "deferred")
+	// the reviewer sees the replicas about to be applied, which are not changed any more once reviewed
+	if reviewed := reviewAllocation(ctx, ud, input, deferred); reviewed != deferred {
+		explainChanges(rationale, deferred, reviewed, "reviewed")
+		status.forgetReviewedSubsets(deferred, reviewed)
+		deferred = reviewed
+	}
+	if err := allocationCancelled(ctx); err != nil {
+		return nil, allocationStatus{}, err
+	}
+	status.rationale = rationale
+	status.onboardingSubsets = getNextOnboardingSubsets(ud, nameToSubset, deferred)
+	status.specifiedSubsets = sortedSubsetNames(specifiedReplicas)
+	status.specifiedAdjustments = adjustments
+	status.totalCappedReason = totalCappedReason
+	return deferred, status, nil
+}
+
+// sortedSubsetNames returns the names of the subsets in replicas sorted by name.
+func sortedSubsetNames(replicas *map[string]int32) []string {
+	if replicas == nil || len(*replicas) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(*replicas))
+	for name := range *replicas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func (n subsetInfos) SortToAllocator() *replicasAllocator {
-	sort.Sort(n)
-	return &replicasAllocator{subsets: &n}
+// SortToAllocator sorts a copy of the subsets by the comparators consulted in order, or by defaultSubsetComparator
+// if none is given, and returns an allocator keeping this order. The subsets themselves are left unchanged.
+func (n subsetInfos) SortToAllocator(comparators ...subsetComparator) *replicasAllocator {
+	less := defaultSubsetComparator
+	if len(comparators) > 0 {
+		less = chainSubsetComparators(comparators...)
+	}
+
+	subsets := n.clone()
+	allocator := &replicasAllocator{subsets: &subsets, less: less, logger: allocationLogger, ctx: context.Background()}
+	allocator.sortSubsets()
+	allocator.current = subsets.clone()
+	return allocator
 }
 
 type replicasAllocator struct {
+	// subsets holds the replicas of the last allocation, which starts over from a copy of current each time,
+	// so that allocating the same replicas again gives the same result.
 	subsets *subsetInfos
+	current subsetInfos
+	// less is the comparator which the subsets are sorted by.
+	less subsetComparator
+
+	// preferredWeights and preferredBiasPercent nudge the distribution of unspecified subsets toward a preferred split.
+	preferredWeights     map[string]int32
+	preferredBiasPercent int32
+
+	// maxActiveSubsets limits the number of subsets receiving replicas, which are activated in order of subsetPriority,
+	// the order of Topology.Subsets.
+	maxActiveSubsets *int32
+	subsetPriority   []string
+
+	// interruptionRisks reduces the share of unspecified subsets which are likely to be interrupted soon.
+	interruptionRisks map[string]int32
+	// schedulingSuccessRates reduces the share of unspecified subsets which frequently fail to schedule pods.
+	schedulingSuccessRates map[string]int32
+	// schedulingPriorities fills unspecified subsets of higher priorities before the ones of lower priorities.
+	schedulingPriorities map[string]int32
+	// overflowOrder spills the replicas over to the overflow subsets one by one once the other ones are full.
+	overflowOrder []string
+	// subsetCosts and maxCostBudget keep the total cost of replicas within the budget.
+	subsetCosts   map[string]int32
+	maxCostBudget *int32
+	// headroomPercent leaves a percentage of the replicas unallocated, which is 0 while bursting.
+	headroomPercent int32
+	// initialStrategy distributes the replicas of the first allocation of a UnitedDeployment.
+	initialStrategy appsv1alpha1.InitialStrategyType
+	// scaleInPolicy chooses the subsets losing the replicas left over after the even split on scale-in.
+	scaleInPolicy appsv1alpha1.ScaleInPolicyType
+	// minReplicasPerSubset requires the replicas left by the specified subsets to keep one replica in each unspecified subset.
+	minReplicasPerSubset bool
+	// remainderPolicy chooses the subsets receiving the replicas left over after the even split.
+	remainderPolicy appsv1alpha1.RemainderPolicyType
+	// roundingMode rounds the even split of the unspecified subsets.
+	roundingMode appsv1alpha1.RoundingModeType
+	// rotationNames is the sorted names of subsets, among which the replicas left over after the even split are
+	// rotated from scaleOutCursor if remainderPolicy is Rotate. Each allocation starts from lastScaleOutCursor.
+	rotationNames      []string
+	scaleOutCursor     int32
+	lastScaleOutCursor int32
+	// stabilityBias moves the replicas left over after the even split to the subsets which already have them.
+	stabilityBias bool
+
+	// maxSkew bounds the difference of the replicas between the unspecified subsets.
+	maxSkew *int32
+
+	// minDomains and failureDomains spread the replicas across at least minDomains failure domains.
+	minDomains     *int32
+	failureDomains map[string]string
+
+	// minNonEmptySubsets is the minimum number of subsets which should hold replicas.
+	minNonEmptySubsets *int32
+
+	// roundingAdjustments records the unspecified subsets whose replicas are adjusted from their rounded ideal shares.
+	roundingAdjustments map[string]appsv1alpha1.SubsetRoundingAdjustment
+	// unsatisfiedDomainsReason explains why the replicas are not spread across minDomains failure domains.
+	unsatisfiedDomainsReason string
+	// rationale explains why each subset gets its replicas. It is nil unless allocationRationale is enabled.
+	rationale map[string]string
+	// logger logs the allocation with the namespace and name of the UnitedDeployment if it is configured.
+	logger logr.Logger
+	// ctx gives up the allocation once it is cancelled. It is context.Background() unless it is configured.
+	ctx context.Context
+}
+
+// configureAllocator applies the allocation policies declared in UnitedDeployment.Spec.Topology to the allocator.
+// Without preferred weights declared, the replicas follow the traffic split reported by Providers.TrafficSplit if any.
+func configureAllocator(allocator *replicasAllocator, ud *appsv1alpha1.UnitedDeployment) {
+	topology := &ud.Spec.Topology
+	allocator.logger = allocationLoggerFor(ud)
+	if len(topology.PreferredWeights) > 0 {
+		allocator.preferredWeights = topology.PreferredWeights
+		allocator.preferredBiasPercent = 100
+		if topology.PreferredBiasPercent != nil {
+			allocator.preferredBiasPercent = *topology.PreferredBiasPercent
+		}
+	} else if weights := getMemoryHeadroomWeights(allocator.ctx, ud); len(weights) > 0 {
+		allocator.preferredWeights = weights
+		allocator.preferredBiasPercent = 100
+	} else if weights := getSubsetTrafficWeights(allocator.ctx, ud); len(weights) > 0 {
+		allocator.preferredWeights = weights
+		allocator.preferredBiasPercent = 100
+	}
+
+	allocator.interruptionRisks = getSubsetInterruptionRisks(allocator.ctx, ud)
+	allocator.schedulingSuccessRates = getSubsetSchedulingSuccessRates(allocator.ctx, ud)
+	if allocator.schedulingPriorities = getSubsetPriorities(allocator.ctx, ud); len(allocator.schedulingPriorities) > 0 {
+		allocator.less = chainSubsetComparators(lessByReplicas, lessByPriority(allocator.schedulingPriorities), allocator.less)
+		allocator.sortSubsets()
+	}
+	allocator.remainderPolicy = topology.RemainderPolicy
+	allocator.roundingMode = topology.RoundingMode
+	configureRotation(allocator, ud)
+	allocator.stabilityBias = topology.StabilityBias
+	allocator.scaleInPolicy = topology.ScaleInPolicy
+	allocator.minReplicasPerSubset = topology.MinReplicasPerSubset
+	allocator.overflowOrder = topology.OverflowOrder
+	allocator.maxSkew = topology.MaxSkew
+	allocator.minNonEmptySubsets = topology.MinNonEmptySubsets
+	if topology.HeadroomPercent != nil && !isBursting(ud) {
+		allocator.headroomPercent = *topology.HeadroomPercent
+	}
+	if topology.MaxCostBudget != nil {
+		allocator.subsetCosts = getSubsetCosts(allocator.ctx, ud)
+		allocator.maxCostBudget = topology.MaxCostBudget
+	}
+
+	allocator.maxActiveSubsets = topology.MaxActiveSubsets
+	for _, subset := range topology.Subsets {
+		allocator.subsetPriority = append(allocator.subsetPriority, subset.Name)
+	}
+
+	if topology.MinDomains != nil {
+		allocator.minDomains = topology.MinDomains
+		allocator.failureDomains = map[string]string{}
+		for _, subset := range topology.Subsets {
+			if subset.FailureDomain != "" {
+				allocator.failureDomains[subset.Name] = subset.FailureDomain
+			}
+		}
+	}
 }
 
 func (s *replicasAllocator) validateReplicas(replicas int32, subsetReplicasLimits *map[string]int32) error {
@@ -79,15 +537,30 @@ func (s *replicasAllocator) validateReplicas(replicas int32, subsetReplicasLimit
 		return nil
 	}
 
-	var specifiedReplicas int32
+	if err := s.validateSpecifiedSubsets(subsetReplicasLimits); err != nil {
+		return err
+	}
+	if err := s.validateCatchAll(); err != nil {
+		return err
+	}
+	if err := s.validateSpecifiedBounds(subsetReplicasLimits); err != nil {
+		return err
+	}
+
+	// sum up in int64, since the specified replicas of many subsets could overflow int32
+	var specifiedReplicas int64
 	for _, replicas := range *subsetReplicasLimits {
-		specifiedReplicas += replicas
+		specifiedReplicas += int64(replicas)
 	}
 
-	if specifiedReplicas > replicas {
-		return fmt.Errorf("specified subsets' replica (%d) is greater than UnitedDeployment replica (%d)",
-			specifiedReplicas, replicas)
-	} else if specifiedReplicas < replicas {
+	if specifiedReplicas > int64(replicas) {
+		var subsetNames []string
+		for _, subset := range *s.subsets {
+			subsetNames = append(subsetNames, subset.SubsetName)
+		}
+		return newAllocationError(OverSpecifiedAllocationReason, "specified subsets' replica (%d) is greater than UnitedDeployment replica (%d), increase replicas to at least %d",
+			specifiedReplicas, replicas, minimumEffectiveReplicas(*subsetReplicasLimits, subsetNames))
+	} else if specifiedReplicas < int64(replicas) {
 		specifiedCount := 0
 		for _, subset := range *s.subsets {
 			if _, exist := (*subsetReplicasLimits)[subset.SubsetName]; exist {
@@ -96,47 +569,530 @@ func (s *replicasAllocator) validateReplicas(replicas int32, subsetReplicasLimit
 		}
 
 		if specifiedCount == len(*s.subsets) {
-			return fmt.Errorf("specified subsets' replica (%d) is less than UnitedDeployment replica (%d)",
+			return newAllocationError(UnderSpecifiedAllocationReason, "specified subsets' replica (%d) is less than UnitedDeployment replica (%d)",
 				specifiedReplicas, replicas)
 		}
 	}
 
+	if err := s.validateProtectedSubsets(replicas-int32(specifiedReplicas), subsetReplicasLimits); err != nil {
+		return err
+	}
+
+	if s.minReplicasPerSubset {
+		var unspecifiedCount int32
+		for _, subset := range *s.subsets {
+			if _, exist := (*subsetReplicasLimits)[subset.SubsetName]; !exist {
+				unspecifiedCount++
+			}
+		}
+
+		if left := replicas - int32(specifiedReplicas); left < unspecifiedCount {
+			return newAllocationError(UnspecifiedSubsetsDrainedAllocationReason, "%d of UnitedDeployment replica (%d) left by specified subsets' replica (%d) can not keep one replica in each of the %d unspecified subsets",
+				left, replicas, specifiedReplicas, unspecifiedCount)
+		}
+	}
+
 	return nil
 }
 
-func getSpecifiedSubsetReplicas(ud *appsv1alpha1.UnitedDeployment) *map[string]int32 {
+// validateSpecifiedSubsets checks that every subset whose replicas are specified is in the topology, since the
+// replicas specified for an unknown subset are never applied but would still be counted against the total.
+func (s *replicasAllocator) validateSpecifiedSubsets(subsetReplicasLimits *map[string]int32) error {
+	known := sets.NewString()
+	for _, subset := range *s.subsets {
+		known.Insert(subset.SubsetName)
+	}
+
+	var unknown []string
+	for name := range *subsetReplicasLimits {
+		if !known.Has(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return newAllocationError(UnknownSubsetAllocationReason, "replicas are specified for subsets %v which are not in the topology", unknown)
+	}
+
+	return nil
+}
+
+// validateCatchAll checks that at most one subset is marked as catch-all, since the replicas left over can only
+// be given to one of them exactly.
+func (s *replicasAllocator) validateCatchAll() error {
+	var catchAll []string
+	for _, subset := range *s.subsets {
+		if subset.CatchAll {
+			catchAll = append(catchAll, subset.SubsetName)
+		}
+	}
+	if len(catchAll) > 1 {
+		sort.Strings(catchAll)
+		return newAllocationError(MultipleCatchAllAllocationReason, "subsets %v are all marked as catch-all, but at most one is allowed", catchAll)
+	}
+
+	return nil
+}
+
+// MinimumEffectiveReplicas returns the smallest replicas of the UnitedDeployment which its specified subset replicas
+// fit, i.e. the sum of the specified replicas if the replicas of all subsets are specified, or the sum plus one for
+// each subset whose replicas are not specified otherwise.
+func MinimumEffectiveReplicas(ud *appsv1alpha1.UnitedDeployment) (int32, error) {
+	// the replicas of a subset could not be specified over the replicas of the UnitedDeployment, so parse them as if
+	// the UnitedDeployment had at least the largest specified replicas
+	total := getUnitedDeploymentReplicas(ud)
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Replicas != nil && subsetDef.Replicas.Type == intstr.Int && subsetDef.Replicas.IntVal > total {
+			total = subsetDef.Replicas.IntVal
+		}
+	}
+	if total != getUnitedDeploymentReplicas(ud) {
+		ud = ud.DeepCopy()
+		ud.Spec.Replicas = &total
+	}
+
+	specifiedReplicas, err := getSpecifiedSubsetReplicas(ud)
+	if err != nil {
+		return 0, err
+	}
+
+	var subsetNames []string
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		subsetNames = append(subsetNames, subsetDef.Name)
+	}
+	minimum := minimumEffectiveReplicas(*specifiedReplicas, subsetNames)
+	if minimum > math.MaxInt32 {
+		return 0, newAllocationError(OverSpecifiedAllocationReason, "the minimum replicas (%d) which the specified replicas fit is out of int32 range", minimum)
+	}
+	return int32(minimum), nil
+}
+
+// minimumEffectiveReplicas returns the sum of the specified replicas plus one for each of the subsets whose replicas
+// are not specified. It is summed up in int64 to avoid overflow.
+func minimumEffectiveReplicas(specifiedReplicas map[string]int32, subsetNames []string) int64 {
+	var minimum int64
+	for _, replicas := range specifiedReplicas {
+		minimum += int64(replicas)
+	}
+	for _, name := range subsetNames {
+		if _, exist := specifiedReplicas[name]; !exist {
+			minimum++
+		}
+	}
+	return minimum
+}
+
+// validateProtectedSubsets checks that the replicas left by the specified subsets could keep the unspecified
+// protected subsets at their current replicas, even if all the unprotected ones are shrunk to zero.
+func (s *replicasAllocator) validateProtectedSubsets(left int32, subsetReplicasLimits *map[string]int32) error {
+	var protected []string
+	var floor int64
+	for _, subset := range *s.subsets {
+		if _, exist := (*subsetReplicasLimits)[subset.SubsetName]; exist || subset.MinReplicas == nil {
+			continue
+		}
+		protected = append(protected, subset.SubsetName)
+		floor += int64(*subset.MinReplicas)
+	}
+	if floor > int64(left) {
+		sort.Strings(protected)
+		return newAllocationError(ProtectedSubsetsAllocationReason, "%d replicas left by specified subsets can not keep the current replicas (%d) of protected subsets %v",
+			left, floor, protected)
+	}
+
+	return nil
+}
+
+// validateSpecifiedBounds checks the specified replicas of each subset against its own min/max replicas.
+// Specified replicas are applied to the subsets directly, so a violation must be rejected here,
+// even when the specified replicas of all subsets sum up to the UnitedDeployment replicas exactly.
+func (s *replicasAllocator) validateSpecifiedBounds(subsetReplicasLimits *map[string]int32) error {
+	for _, subset := range *s.subsets {
+		replicas, exist := (*subsetReplicasLimits)[subset.SubsetName]
+		if !exist {
+			continue
+		}
+
+		if subset.MaxReplicas != nil && replicas > *subset.MaxReplicas {
+			return newAllocationError(SpecifiedOutOfBoundsAllocationReason, "specified replicas (%d) of subset %s is greater than its max replicas (%d)",
+				replicas, subset.SubsetName, *subset.MaxReplicas)
+		}
+		if subset.MinReplicas != nil && replicas < *subset.MinReplicas {
+			return newAllocationError(SpecifiedOutOfBoundsAllocationReason, "specified replicas (%d) of subset %s is less than its min replicas (%d)",
+				replicas, subset.SubsetName, *subset.MinReplicas)
+		}
+	}
+
+	return nil
+}
+
+// getSpecifiedSubsetReplicas returns the replicas indicated for the subsets. The keyword last-stable is resolved
+// from Status.LastStableSubsetReplicas, and an error is returned if the subset has no stable replicas recorded yet.
+// The replicas pinned by the AnnotationSubsetReplicasOverride annotation take precedence over the topology.
+func getSpecifiedSubsetReplicas(ud *appsv1alpha1.UnitedDeployment) (*map[string]int32, error) {
 	replicaLimits := map[string]int32{}
 	if ud.Spec.Topology.Subsets == nil {
-		return &replicaLimits
+		return &replicaLimits, nil
 	}
 
+	var lastPercentSubset string
+	var percentCount int
+	var percentSum, percentReplicas int64
 	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Name == ud.Spec.Topology.ReservedEmptySubset {
+			replicaLimits[subsetDef.Name] = 0
+			continue
+		}
+
 		if subsetDef.Replicas == nil {
+			if subsetDef.Role == appsv1alpha1.LeaderSubsetRole {
+				replicaLimits[subsetDef.Name] = DefaultLeaderSubsetReplicas
+			}
 			continue
 		}
 
-		if specifiedReplicas, err := ParseSubsetReplicas(*ud.Spec.Replicas, *subsetDef.Replicas); err == nil {
+		if IsLastStableSubsetReplicas(subsetDef.Replicas) {
+			stableReplicas, exist := ud.Status.LastStableSubsetReplicas[subsetDef.Name]
+			if !exist {
+				return nil, newAllocationError(NoLastStableReplicasAllocationReason, "subset %s has no last stable replicas recorded yet", subsetDef.Name)
+			}
+			replicaLimits[subsetDef.Name] = stableReplicas
+			continue
+		}
+
+		specifiedReplicas, err := ParseSubsetReplicas(getUnitedDeploymentReplicas(ud), *subsetDef.Replicas)
+		var overflow *SubsetReplicasOverflowError
+		if errors.As(err, &overflow) {
+			if isBestEffortSchedule(ud) {
+				// leave the overflow to be scaled down with the other specified replicas
+				replicaLimits[subsetDef.Name] = overflow.SubsetReplicas
+				continue
+			}
+			if minimum, err := MinimumEffectiveReplicas(ud); err == nil {
+				return nil, newAllocationError(OverSpecifiedAllocationReason, "specified replicas of subset %s are invalid: %s, increase replicas to at least %d",
+					subsetDef.Name, overflow, minimum)
+			}
+			return nil, newAllocationError(OverSpecifiedAllocationReason, "specified replicas of subset %s are invalid: %s", subsetDef.Name, overflow)
+		}
+		if err == nil {
 			replicaLimits[subsetDef.Name] = specifiedReplicas
+			if percent, ok := SubsetReplicasPercent(*subsetDef.Replicas); ok {
+				lastPercentSubset = subsetDef.Name
+				percentCount++
+				percentSum += percent
+				percentReplicas += int64(specifiedReplicas)
+			}
 		} else {
-			klog.Warningf("Fail to consider the replicas of subset %s when parsing replicaLimits during managing replicas of UnitedDeployment %s/%s: %s",
-				subsetDef.Name, ud.Namespace, ud.Name, err)
+			allocationLoggerFor(ud).Error(err, "Fail to consider the replicas of subset when parsing replicaLimits", "subset", subsetDef.Name)
+		}
+	}
+
+	if lastPercentSubset != "" {
+		replicaLimits[lastPercentSubset] = AbsorbPercentageRounding(getUnitedDeploymentReplicas(ud), percentSum, percentReplicas,
+			replicaLimits[lastPercentSubset], percentCount == len(ud.Spec.Topology.Subsets))
+	}
+
+	if name, replicas, ok := getCanaryRampReplicas(ud); ok {
+		replicaLimits[name] = replicas
+	}
+
+	override, err := ParseSubsetReplicasOverride(ud)
+	if err != nil {
+		return nil, err
+	}
+	for name, replicas := range override {
+		replicaLimits[name] = replicas
+	}
+
+	frozen, err := ParseFrozenSubsets(ud)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range frozen {
+		replicaLimits[name] = ud.Status.SubsetReplicas[name]
+	}
+
+	if err := resolveRelativeReplicas(ud, replicaLimits); err != nil {
+		return nil, err
+	}
+
+	return &replicaLimits, nil
+}
+
+// AbsorbPercentageRounding returns the replicas of the last percentage-specified subset, lastReplicas as parsed by
+// ParseSubsetReplicas, adjusted to absorb the rounding errors of the percentages. Each percentage is rounded on its
+// own, so the percentage-specified subsets, which sum to percentSum percent and percentReplicas as parsed, are made
+// to sum up to percentSum percent of replicas rounded as a whole instead. If they are all the subsets of the topology
+// and their percentages are tolerated by ValidateSpecifiedPercentages, they are made to sum up to replicas.
+func AbsorbPercentageRounding(replicas int32, percentSum, percentReplicas int64, lastReplicas int32, allSubsets bool) int32 {
+	if allSubsets && percentSum >= 100-specifiedPercentagesTolerance && percentSum <= 100+specifiedPercentagesTolerance {
+		percentSum = 100
+	}
+	// round in float64 rather than by round, whose int result could overflow on 32-bit builds
+	expected := int64(math.Floor(float64(replicas)*float64(percentSum)/100 + 0.5))
+	adjusted := int64(lastReplicas) + expected - percentReplicas
+	if adjusted < 0 {
+		adjusted = 0
+	} else if adjusted > math.MaxInt32 {
+		adjusted = math.MaxInt32
+	}
+	return int32(adjusted)
+}
+
+// ParseSubsetReplicasOverride parses the replicas pinned by the AnnotationSubsetReplicasOverride annotation of the
+// UnitedDeployment. It returns an error if the annotation is malformed, or pins the replicas of unknown subsets.
+func ParseSubsetReplicasOverride(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	value, exist := ud.Annotations[appsv1alpha1.AnnotationSubsetReplicasOverride]
+	if !exist {
+		return nil, nil
+	}
+
+	override := map[string]int32{}
+	if err := json.Unmarshal([]byte(value), &override); err != nil {
+		return nil, newAllocationError(InvalidReplicasOverrideAllocationReason, "fail to parse annotation %s: %s", appsv1alpha1.AnnotationSubsetReplicasOverride, err)
+	}
+
+	known := sets.NewString()
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		known.Insert(subsetDef.Name)
+	}
+	var unknown []string
+	for name, replicas := range override {
+		if replicas < 0 {
+			return nil, newAllocationError(InvalidReplicasOverrideAllocationReason, "replicas (%d) of subset %s in annotation %s should not be less than 0",
+				replicas, name, appsv1alpha1.AnnotationSubsetReplicasOverride)
 		}
+		if !known.Has(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, newAllocationError(UnknownSubsetAllocationReason, "annotation %s overrides the replicas of subsets %v which are not in the topology",
+			appsv1alpha1.AnnotationSubsetReplicasOverride, unknown)
+	}
+
+	return override, nil
+}
+
+// specifiedPercentagesTolerance is how many percentage points the percentages of subsets could sum away from 100%,
+// e.g. 33% for each of three subsets, in which case the last of them takes the replicas left or exceeded.
+const specifiedPercentagesTolerance = 1
+
+// ValidateSpecifiedPercentages checks that the percentages of subsets sum to 100% within a tolerance, if the replicas
+// of every subset are specified by percentage, which catches typos like 30% for each of three subsets. It returns
+// nil if any subset is unspecified or specified otherwise, since the others take the rest then.
+func ValidateSpecifiedPercentages(ud *appsv1alpha1.UnitedDeployment) error {
+	if len(ud.Spec.Topology.Subsets) == 0 {
+		return nil
 	}
 
-	return &replicaLimits
+	var sum int64
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Replicas == nil {
+			return nil
+		}
+		percent, ok := SubsetReplicasPercent(*subsetDef.Replicas)
+		if !ok {
+			return nil
+		}
+		sum += percent
+	}
+
+	if sum > 100+specifiedPercentagesTolerance {
+		return newAllocationError(OverSpecifiedAllocationReason, "percentages of all subsets sum to %d%%, which is greater than 100%%", sum)
+	} else if sum < 100-specifiedPercentagesTolerance {
+		return newAllocationError(UnderSpecifiedAllocationReason, "percentages of all subsets sum to %d%%, which is less than 100%%", sum)
+	}
+	return nil
 }
 
-func getSubsetInfos(nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) *subsetInfos {
+// SubsetReplicasPercent returns the percentage of the subset replicas if they are in the form of "X%". Unlike
+// ParseSubsetReplicas, it does not clamp the percentage into [0, 100], so that it can be validated.
+func SubsetReplicasPercent(subsetReplicas intstr.IntOrString) (int64, bool) {
+	if subsetReplicas.Type != intstr.String || !strings.HasSuffix(subsetReplicas.StrVal, "%") {
+		return 0, false
+	}
+	percent, err := strconv.ParseInt(strings.TrimSuffix(subsetReplicas.StrVal, "%"), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return percent, true
+}
+
+// getSubsetInfos returns the allocation info of each subset in the order of Topology.Subsets. It returns an error
+// if subsets of the same name are declared, since they could not be told apart in the allocated replicas.
+func getSubsetInfos(ctx context.Context, nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) (*subsetInfos, error) {
+	capacities := getSubsetCapacities(ctx, ud)
+	warmingUp := getWarmingUpSubsets(ctx, ud)
+	onboarding := getOnboardingSubsets(ud, nameToSubset)
+	reserveSurge := ud.Spec.Topology.ReserveUpdateSurge && isUnitedDeploymentUpdating(ud)
 	infos := make(subsetInfos, len(ud.Spec.Topology.Subsets))
+	names := make(map[string]bool, len(ud.Spec.Topology.Subsets))
 	for idx, subsetDef := range ud.Spec.Topology.Subsets {
-		var replicas int32
+		// the subsets of the same name would collapse into one in the allocated replicas, losing the others' share
+		if names[subsetDef.Name] {
+			return nil, newAllocationError(DuplicateSubsetAllocationReason, "subset %s is declared more than once in the topology", subsetDef.Name)
+		}
+		names[subsetDef.Name] = true
+
+		var replicas, surge int32
+		var stepMaxReplicas *int32
+		var unschedulable bool
+		var lastScaledGeneration int64
 		if subset, exist := (*nameToSubset)[subsetDef.Name]; exist {
 			replicas = subset.Spec.Replicas
+			lastScaledGeneration = subset.Status.LastScaledGeneration
+			stepMaxReplicas = getRollingUpdateMaxReplicas(subset)
+			if reserveSurge && subset.Spec.UpdateStrategy.MaxSurge != nil {
+				surge = *subset.Spec.UpdateStrategy.MaxSurge
+			}
+			unschedulable = subset.Status.Unschedulable
+		}
+		// hold the subset which is unschedulable, or whose new nodes are warming up, at its current replicas
+		if held := replicas; (unschedulable || warmingUp[subsetDef.Name]) && (stepMaxReplicas == nil || *stepMaxReplicas > held) {
+			stepMaxReplicas = &held
+		}
+		// let the subset which is onboarding take at most the gradual step of replicas in this round
+		if onboarding[subsetDef.Name] {
+			if gradual := replicas + *ud.Spec.Topology.GradualStep; stepMaxReplicas == nil || *stepMaxReplicas > gradual {
+				stepMaxReplicas = &gradual
+			}
+		}
+		infos[idx] = &nameToReplicas{SubsetName: subsetDef.Name, Replicas: replicas, StepMaxReplicas: stepMaxReplicas, SoftMinReplicas: subsetDef.SoftMinReplicas,
+			LastScaledGeneration: lastScaledGeneration, CatchAll: subsetDef.CatchAll}
+
+		var reserved int32
+		if subsetDef.SystemReservedReplicas != nil && *subsetDef.SystemReservedReplicas > 0 {
+			reserved = *subsetDef.SystemReservedReplicas
+		}
+		if capacity, exist := capacities[subsetDef.Name]; exist {
+			capacity -= reserved
+			if capacity < 0 {
+				capacity = 0
+			}
+			infos[idx].MaxReplicas = &capacity
+			// defer the replicas over the capacity reserved for the update surge until the update completes
+			if reserved := capacity - surge; surge > 0 && (stepMaxReplicas == nil || *stepMaxReplicas > reserved) {
+				if reserved < 0 {
+					reserved = 0
+				}
+				infos[idx].StepMaxReplicas = &reserved
+			}
 		}
-		infos[idx] = &nameToReplicas{SubsetName: subsetDef.Name, Replicas: replicas}
+		if subsetDef.MaxReplicas != nil {
+			// the reserved pods run on the nodes bounded by the max replicas as well
+			maxReplicas := *subsetDef.MaxReplicas - reserved
+			if maxReplicas < 0 {
+				maxReplicas = 0
+			}
+			if infos[idx].MaxReplicas == nil || maxReplicas < *infos[idx].MaxReplicas {
+				infos[idx].MaxReplicas = &maxReplicas
+			}
+		}
+	}
+
+	return &infos, nil
+}
+
+// protectSubsets sets the min replicas of each protected subset whose replicas are not specified to its current
+// replicas, within its upper bound, so that it is never shrunk automatically.
+func protectSubsets(ud *appsv1alpha1.UnitedDeployment, infos *subsetInfos, specifiedReplicas *map[string]int32) {
+	protected := sets.NewString()
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Protected {
+			protected.Insert(subsetDef.Name)
+		}
+	}
+
+	for _, subset := range *infos {
+		if _, exist := (*specifiedReplicas)[subset.SubsetName]; exist || !protected.Has(subset.SubsetName) {
+			continue
+		}
+		floor := subset.Replicas
+		if bound := subset.upperBound(); bound != nil && *bound < floor {
+			floor = *bound
+		}
+		subset.MinReplicas = &floor
+	}
+}
+
+// isUnitedDeploymentUpdating returns whether the UnitedDeployment is being updated to a revision other than
+// its current revision, according to its status.
+func isUnitedDeploymentUpdating(ud *appsv1alpha1.UnitedDeployment) bool {
+	return ud.Status.UpdateStatus != nil && ud.Status.UpdateStatus.UpdatedRevision != "" &&
+		ud.Status.UpdateStatus.UpdatedRevision != ud.Status.CurrentRevision
+}
+
+// getSubsetPriorities returns the priority of each subset indicated by Subset.Priority, or reported by
+// Providers.Priority if not indicated. The subsets listed in Topology.FillOrder are given priorities above
+// the other subsets instead, in the order of the list.
+func getSubsetPriorities(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	priorities := map[string]int32{}
+	for name, priority := range getSubsetSchedulingPriorities(ctx, ud) {
+		priorities[name] = priority
+	}
+	for _, subset := range ud.Spec.Topology.Subsets {
+		if subset.Priority != nil {
+			priorities[subset.Name] = *subset.Priority
+		}
+	}
+	return applyFillOrder(ud, priorities)
+}
+
+// applyFillOrder raises the priorities of the subsets listed in Topology.FillOrder over the highest priority of
+// the subsets not listed, so that the first listed subset has the highest priority. Unknown and duplicated names
+// in the list are ignored.
+func applyFillOrder(ud *appsv1alpha1.UnitedDeployment, priorities map[string]int32) map[string]int32 {
+	var order []string
+	listed := sets.NewString()
+	for _, name := range ud.Spec.Topology.FillOrder {
+		if !listed.Has(name) && hasTopologySubset(ud, name) {
+			listed.Insert(name)
+			order = append(order, name)
+		}
+	}
+	if len(order) == 0 {
+		return priorities
 	}
 
-	return &infos
+	// the subsets without priority take 0, which the listed ones should be above as well
+	var base int32
+	for _, subset := range ud.Spec.Topology.Subsets {
+		if !listed.Has(subset.Name) && priorities[subset.Name] > base {
+			base = priorities[subset.Name]
+		}
+	}
+	if base > math.MaxInt32-int32(len(order)) {
+		base = math.MaxInt32 - int32(len(order))
+	}
+	for i, name := range order {
+		priorities[name] = base + int32(len(order)-i)
+	}
+	return priorities
+}
+
+// hasTopologySubset returns whether the subset of the name is declared in the topology.
+func hasTopologySubset(ud *appsv1alpha1.UnitedDeployment, name string) bool {
+	for _, subset := range ud.Spec.Topology.Subsets {
+		if subset.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getRollingUpdateMaxReplicas limits the growth of a subset under rolling update to its surge budget, so that
+// scaling it out does not break the surge calculation of the workload. It returns nil if the subset is not under
+// rolling update or does not surge.
+func getRollingUpdateMaxReplicas(subset *Subset) *int32 {
+	maxSurge := subset.Spec.UpdateStrategy.MaxSurge
+	if maxSurge == nil || subset.Status.UpdatedReplicas >= subset.Spec.Replicas-subset.Spec.UpdateStrategy.Partition {
+		return nil
+	}
+
+	maxReplicas := subset.Spec.Replicas + *maxSurge
+	return &maxReplicas
 }
 
 // AllocateReplicas will first try to check the specifiedSubsetReplicas is valid or not.
@@ -144,55 +1100,668 @@ func getSubsetInfos(nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDep
 // If not, it will return error
 func (s *replicasAllocator) AllocateReplicas(replicas int32, specifiedSubsetReplicas *map[string]int32) (
 	*map[string]int32, error) {
+	s.startOver()
+	replicas, reserved := s.reserveHeadroom(replicas, specifiedSubsetReplicas)
 	if err := s.validateReplicas(replicas, specifiedSubsetReplicas); err != nil {
 		return nil, err
 	}
 
-	return s.normalAllocate(replicas, specifiedSubsetReplicas), nil
+	if unallocatable := s.unallocatableReplicas(replicas, specifiedSubsetReplicas); unallocatable > 0 {
+		return nil, newAllocationError(AllCappedAllocationReason, "%d of UnitedDeployment replica (%d) can not be allocated, since all subsets have reached their max replicas",
+			unallocatable, replicas)
+	}
+
+	allocated, deferred := s.normalAllocate(replicas, specifiedSubsetReplicas)
+	if deferred > 0 {
+		s.logger.V(4).Info("Defer allocating replicas, since subsets have reached their max replicas of this round", "deferred", deferred, "replicas", replicas)
+	}
+	if err := allocationCancelled(s.ctx); err != nil {
+		return nil, err
+	}
+	if s.minDomains != nil {
+		before := allocated
+		s.unsatisfiedDomainsReason = s.spreadFailureDomains(replicas)
+		if err := allocationCancelled(s.ctx); err != nil {
+			return nil, err
+		}
+		if s.unsatisfiedDomainsReason != "" {
+			s.logger.Info("Replicas are not spread across enough failure domains", "replicas", replicas, "minDomains", *s.minDomains, "reason", s.unsatisfiedDomainsReason)
+		}
+		allocated = s.toSubsetReplicaMap()
+		explainChanges(s.rationale, before, allocated, "spread")
+	}
+	if unaffordable := s.fitCostBudget(); unaffordable > 0 {
+		s.logger.Info("Replicas can not be allocated within the cost budget", "unaffordable", unaffordable, "replicas", replicas, "maxCostBudget", *s.maxCostBudget)
+		before := allocated
+		allocated = s.toSubsetReplicaMap()
+		explainChanges(s.rationale, before, allocated, "cost budget")
+	}
+	if s.maxSkew != nil {
+		before := allocated
+		if err := s.limitSkew(); err != nil {
+			return nil, err
+		}
+		allocated = s.toSubsetReplicaMap()
+		explainChanges(s.rationale, before, allocated, "skew limited")
+	}
+	if s.minNonEmptySubsets != nil {
+		before := allocated
+		if err := s.spreadNonEmptySubsets(); err != nil {
+			return nil, err
+		}
+		allocated = s.toSubsetReplicaMap()
+		explainChanges(s.rationale, before, allocated, "spread")
+	}
+	s.explainHeadroom(reserved, specifiedSubsetReplicas)
+
+	return allocated, nil
+}
+
+// startOver resets the subsets and the state written by the last allocation, so that AllocateReplicas could be
+// called more than once on the same allocator.
+func (s *replicasAllocator) startOver() {
+	subsets := s.current.clone()
+	s.subsets = &subsets
+	s.scaleOutCursor = s.lastScaleOutCursor
+	s.roundingAdjustments = nil
+	s.unsatisfiedDomainsReason = ""
+	if s.rationale != nil {
+		s.rationale = map[string]string{}
+	}
 }
 
-func (s *replicasAllocator) normalAllocate(expectedReplicas int32, specifiedSubsetReplicas *map[string]int32) *map[string]int32 {
+// fitCostBudget refills the unspecified subsets in order of their costs if the allocated replicas cost more than
+// maxCostBudget, so that the cheapest subsets are filled to their max replicas first. It returns the replicas which
+// can not be afforded any more.
+func (s *replicasAllocator) fitCostBudget() int32 {
+	if s.maxCostBudget == nil {
+		return 0
+	}
+
+	budget := int64(*s.maxCostBudget)
+	var cost, replicas int64
+	var unspecified []*nameToReplicas
+	for _, subset := range *s.subsets {
+		cost += int64(s.subsetCosts[subset.SubsetName]) * int64(subset.Replicas)
+		if subset.Specified {
+			budget -= int64(s.subsetCosts[subset.SubsetName]) * int64(subset.Replicas)
+		} else {
+			replicas += int64(subset.Replicas)
+			unspecified = append(unspecified, subset)
+		}
+	}
+	if cost <= int64(*s.maxCostBudget) {
+		return 0
+	}
+
+	sort.SliceStable(unspecified, func(i, j int) bool {
+		return s.subsetCosts[unspecified[i].SubsetName] < s.subsetCosts[unspecified[j].SubsetName]
+	})
+	for _, subset := range unspecified {
+		share := replicas
+		if bound := subset.upperBound(); bound != nil && int64(*bound) < share {
+			share = int64(*bound)
+		}
+		if price := int64(s.subsetCosts[subset.SubsetName]); price > 0 {
+			if budget <= 0 {
+				share = 0
+			} else if affordable := budget / price; affordable < share {
+				share = affordable
+			}
+			budget -= price * share
+		}
+		subset.Replicas = int32(share)
+		replicas -= share
+	}
+
+	return int32(replicas)
+}
+
+// allSubsetsUnavailable returns true if every subset is either specified to 0 or limited to 0 max replicas.
+func (s *replicasAllocator) allSubsetsUnavailable(specifiedSubsetReplicas *map[string]int32) bool {
+	for _, subset := range *s.subsets {
+		if specified, exist := (*specifiedSubsetReplicas)[subset.SubsetName]; exist {
+			if specified > 0 {
+				return false
+			}
+			continue
+		}
+		if bound := subset.upperBound(); bound == nil || *bound > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// unallocatableReplicas returns the replicas which exceed the max replicas of all the unspecified subsets.
+func (s *replicasAllocator) unallocatableReplicas(replicas int32, specifiedSubsetReplicas *map[string]int32) int32 {
+	// subtract in int64, since the max replicas of many subsets could overflow int32
+	capacity := int64(replicas)
+	unspecifiedCount := 0
+	for _, subset := range *s.subsets {
+		if specified, exist := (*specifiedSubsetReplicas)[subset.SubsetName]; exist {
+			capacity -= int64(specified)
+			continue
+		}
+
+		unspecifiedCount++
+		if subset.MaxReplicas == nil {
+			return 0
+		}
+		capacity -= int64(*subset.MaxReplicas)
+	}
+
+	if unspecifiedCount == 0 || capacity < 0 {
+		return 0
+	}
+	return int32(capacity)
+}
+
+// normalAllocate returns the allocated replicas of each subset, and the number of replicas
+// which can not be allocated to any subset in this round because of the max replicas of subsets.
+func (s *replicasAllocator) normalAllocate(expectedReplicas int32, specifiedSubsetReplicas *map[string]int32) (*map[string]int32, int32) {
 	var specifiedReplicas int32
-	specifiedSubsetCount := 0
 	// Step 1: apply replicas to specified subsets, and mark them as specified = true.
 	for _, subset := range *s.subsets {
 		if replicas, exist := (*specifiedSubsetReplicas)[subset.SubsetName]; exist {
 			specifiedReplicas += replicas
 			subset.Replicas = replicas
 			subset.Specified = true
-			specifiedSubsetCount++
+			s.explain(subset.SubsetName, "specified=%d", replicas)
 		}
 	}
 
 	// Step 2: averagely allocate the rest replicas to left unspecified subsets.
-	leftSubsetCount := len(*s.subsets) - specifiedSubsetCount
-	if leftSubsetCount != 0 {
-		allocatableReplicas := expectedReplicas - specifiedReplicas
-		average := int(allocatableReplicas) / leftSubsetCount
-		remainder := int(allocatableReplicas) % leftSubsetCount
-
-		for i := len(*s.subsets) - 1; i >= 0; i-- {
-			subset := (*s.subsets)[i]
-			if subset.Specified {
-				continue
+	var unspecified []*nameToReplicas
+	for _, subset := range *s.subsets {
+		if !subset.Specified {
+			unspecified = append(unspecified, subset)
+		}
+	}
+	unspecified = s.activateSubsets(unspecified, expectedReplicas-specifiedReplicas)
+
+	// Step 3: leave the catch-all subset out of the averaging, and give it the rest replicas at last. The soft min
+	// replicas of the unspecified subsets are satisfied out of their shares then.
+	left := expectedReplicas - specifiedReplicas
+	catchAll, unspecified := splitCatchAll(unspecified)
+	if catchAll != nil {
+		left = left / int32(len(unspecified)+1) * int32(len(unspecified))
+	}
+
+	unallocated := s.allocateRest(unspecified, left)
+	if catchAll != nil {
+		unallocated = allocateCatchAll(catchAll, expectedReplicas-specifiedReplicas-(left-unallocated))
+		s.explain(catchAll.SubsetName, "catch-all")
+		// the replicas which the catch-all subset can not hold are given back to the other subsets
+		if unallocated > 0 && len(unspecified) > 0 {
+			unallocated = s.allocateRest(unspecified, expectedReplicas-specifiedReplicas-catchAll.Replicas)
+			s.explain(catchAll.SubsetName, "catch-all capped at max")
+		}
+	}
+	s.satisfySoftMins(unspecified)
+
+	return s.toSubsetReplicaMap(), unallocated
+}
+
+// allocateRest allocates the replicas left by the specified subsets to the unspecified ones as the policies of
+// allocator indicate, and returns the replicas which can not be allocated in this round.
+func (s *replicasAllocator) allocateRest(unspecified []*nameToReplicas, replicas int32) int32 {
+	if s.initialStrategy == appsv1alpha1.SingleSubsetInitialStrategyType || s.initialStrategy == appsv1alpha1.OrderedInitialStrategyType {
+		return s.allocateInitially(unspecified, replicas)
+	} else if len(s.overflowOrder) > 0 {
+		return s.allocateByTiers(s.overflowTiers(unspecified), replicas)
+	} else if len(s.schedulingPriorities) > 0 {
+		return s.allocateByPriorities(unspecified, replicas)
+	}
+	return s.allocateUnspecified(unspecified, replicas)
+}
+
+// splitCatchAll takes the catch-all subset out of the unspecified subsets. It returns nil if there is none.
+func splitCatchAll(unspecified []*nameToReplicas) (*nameToReplicas, []*nameToReplicas) {
+	for i, subset := range unspecified {
+		if subset.CatchAll {
+			rest := make([]*nameToReplicas, 0, len(unspecified)-1)
+			rest = append(rest, unspecified[:i]...)
+			return subset, append(rest, unspecified[i+1:]...)
+		}
+	}
+	return nil, unspecified
+}
+
+// allocateCatchAll gives the replicas to the catch-all subset within its upper bound, and returns the replicas
+// which it can not hold.
+func allocateCatchAll(catchAll *nameToReplicas, replicas int32) int32 {
+	catchAll.Replicas = replicas
+	if bound := catchAll.upperBound(); bound != nil && *bound < replicas {
+		catchAll.Replicas, catchAll.PinnedBy = *bound, pinnedByMax
+	}
+	return replicas - catchAll.Replicas
+}
+
+// allocateUnspecified distributes the replicas among the unspecified subsets by their weights, or averagely if
+// there are no weights, and returns the replicas which can not be allocated within the max replicas of subsets.
+func (s *replicasAllocator) allocateUnspecified(unspecified []*nameToReplicas, replicas int32) int32 {
+	if len(unspecified) == 0 {
+		return 0
+	}
+
+	weights := s.blendedPreferredWeights(unspecified)
+	weights = s.successAdjustedWeights(unspecified, s.riskAdjustedWeights(unspecified, weights))
+	var unallocated int32
+	var ideal map[string]float64
+	if weights != nil {
+		unallocated, ideal = allocateByWeights(unspecified, replicas, weights)
+		for _, subset := range unspecified {
+			s.explain(subset.SubsetName, "weighted")
+		}
+	} else {
+		current, before := s.currentReplicasOf(unspecified), s.replicasBeforeRotation(unspecified)
+		unallocated, ideal = allocateRoundedAverage(s.scaleInOrder(s.remainderOrder(unspecified), replicas), replicas, s.roundingMode)
+		s.preferCurrentReplicas(unspecified, current)
+		s.advanceScaleOutCursor(unspecified, before)
+		s.explainAverage(unspecified, replicas)
+	}
+	s.recordRoundingAdjustments(unspecified, ideal)
+	return unallocated
+}
+
+// remainderOrder reorders the unspecified subsets as remainderPolicy indicates, so that allocateAverage gives the
+// replicas left over after the even split to the subsets at the end. The subsets are kept as is if no policy is set.
+func (s *replicasAllocator) remainderOrder(unspecified []*nameToReplicas) []*nameToReplicas {
+	var less func(a, b *nameToReplicas) bool
+	switch s.remainderPolicy {
+	case appsv1alpha1.SpreadByNameRemainderPolicyType:
+		less = func(a, b *nameToReplicas) bool {
+			return a.SubsetName > b.SubsetName
+		}
+	case appsv1alpha1.SpreadBySmallestRemainderPolicyType:
+		less = func(a, b *nameToReplicas) bool {
+			if a.Replicas != b.Replicas {
+				return a.Replicas > b.Replicas
 			}
+			return a.SubsetName > b.SubsetName
+		}
+	case appsv1alpha1.SpreadByLargestRemainderPolicyType:
+		less = func(a, b *nameToReplicas) bool {
+			if a.Replicas != b.Replicas {
+				return a.Replicas < b.Replicas
+			}
+			return a.SubsetName > b.SubsetName
+		}
+	case appsv1alpha1.RotateRemainderPolicyType:
+		// the subsets holding the left over replicas keep them, and the others take the rest from the cursor
+		ranks := s.rotationRanks()
+		less = func(a, b *nameToReplicas) bool {
+			if a.Replicas != b.Replicas {
+				return a.Replicas < b.Replicas
+			}
+			return ranks[a.SubsetName] > ranks[b.SubsetName]
+		}
+	default:
+		return unspecified
+	}
 
-			if remainder > 0 {
-				subset.Replicas = int32(average + 1)
-				remainder--
+	ordered := make([]*nameToReplicas, len(unspecified))
+	copy(ordered, unspecified)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return less(ordered[i], ordered[j])
+	})
+	return ordered
+}
+
+// scaleInOrder moves the unspecified subsets which were scaled out most recently to the front among those with
+// the same current replicas as scaleInPolicy indicates, so that they lose the replicas left over after the even
+// split if the replicas are scaling in. The subsets with fewer replicas stay in front, so that no subset is scaled
+// out while the others are scaling in.
+func (s *replicasAllocator) scaleInOrder(unspecified []*nameToReplicas, replicas int32) []*nameToReplicas {
+	if s.scaleInPolicy != appsv1alpha1.MostRecentlyScaledOutScaleInPolicyType {
+		return unspecified
+	}
+
+	var current int32
+	for _, subset := range unspecified {
+		current += subset.Replicas
+	}
+	if replicas >= current {
+		return unspecified
+	}
+
+	ordered := make([]*nameToReplicas, len(unspecified))
+	copy(ordered, unspecified)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Replicas != ordered[j].Replicas {
+			return ordered[i].Replicas < ordered[j].Replicas
+		}
+		return ordered[i].LastScaledGeneration > ordered[j].LastScaledGeneration
+	})
+	return ordered
+}
+
+// currentReplicasOf returns the current replicas of the unspecified subsets before they are allocated if
+// stabilityBias is set, or nil.
+func (s *replicasAllocator) currentReplicasOf(unspecified []*nameToReplicas) map[string]int32 {
+	if !s.stabilityBias {
+		return nil
+	}
+
+	current := make(map[string]int32, len(unspecified))
+	for _, subset := range unspecified {
+		current[subset.SubsetName] = subset.Replicas
+	}
+	return current
+}
+
+// preferCurrentReplicas moves the replicas left over after the even split to the unspecified subsets whose current
+// replicas are no less than the even share plus one, which keep their pods then. The subsets already given the left
+// over replicas keep them if there are not enough such subsets. It does nothing if current is nil.
+func (s *replicasAllocator) preferCurrentReplicas(unspecified []*nameToReplicas, current map[string]int32) {
+	if current == nil || len(unspecified) == 0 {
+		return
+	}
+
+	high := unspecified[0].Replicas
+	for _, subset := range unspecified {
+		if subset.Replicas > high {
+			high = subset.Replicas
+		}
+	}
+
+	// the candidates are the subsets given the left over replicas, and the ones of the even share which could hold one more
+	var candidates []*nameToReplicas
+	leftOver := 0
+	for _, subset := range unspecified {
+		// the protected subset held at its current replicas keeps them
+		if subset.MinReplicas != nil && subset.Replicas <= *subset.MinReplicas {
+			continue
+		}
+		if subset.Replicas == high {
+			candidates = append(candidates, subset)
+			leftOver++
+		} else if bound := subset.upperBound(); subset.Replicas == high-1 && (bound == nil || *bound >= high) {
+			candidates = append(candidates, subset)
+		}
+	}
+	if leftOver == len(candidates) {
+		return
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iKept, jKept := current[candidates[i].SubsetName] >= high, current[candidates[j].SubsetName] >= high
+		if iKept != jKept {
+			return iKept
+		}
+		return candidates[i].Replicas > candidates[j].Replicas
+	})
+	for i, subset := range candidates {
+		if i < leftOver {
+			subset.Replicas = high
+		} else {
+			subset.Replicas = high - 1
+		}
+	}
+}
+
+// recordRoundingAdjustments records the unspecified subsets whose replicas differ from their unrounded ideal shares
+// rounded to the nearest integer, which happens when the rounded shares do not sum to the replicas to allocate.
+func (s *replicasAllocator) recordRoundingAdjustments(unspecified []*nameToReplicas, ideal map[string]float64) {
+	for _, subset := range unspecified {
+		share, exist := ideal[subset.SubsetName]
+		if !exist {
+			continue
+		}
+
+		adjustment := subset.Replicas - int32(math.Round(share))
+		if adjustment == 0 {
+			continue
+		}
+		reason := "got one of the replicas left after rounding down the shares for its larger remainder"
+		if adjustment < 0 {
+			reason = "lost its rounded-up replica to the subsets of larger remainders after rounding down the shares"
+		}
+		if s.roundingAdjustments == nil {
+			s.roundingAdjustments = map[string]appsv1alpha1.SubsetRoundingAdjustment{}
+		}
+		s.roundingAdjustments[subset.SubsetName] = appsv1alpha1.SubsetRoundingAdjustment{
+			IdealMilliReplicas: int64(math.Round(share * 1000)),
+			Adjustment:         adjustment,
+			Reason:             reason,
+		}
+		s.logger.V(4).Info("Subset gets replicas other than its ideal share", "subset", subset.SubsetName, "replicas", subset.Replicas, "share", share, "reason", reason)
+	}
+}
+
+// allocateInitially distributes the replicas among the unspecified subsets by the initial strategy, in the order
+// of subsetPriority. It returns the replicas which can not be allocated within the max replicas of subsets.
+func (s *replicasAllocator) allocateInitially(unspecified []*nameToReplicas, replicas int32) int32 {
+	nameToUnspecified := map[string]*nameToReplicas{}
+	for _, subset := range unspecified {
+		nameToUnspecified[subset.SubsetName] = subset
+		subset.Replicas = 0
+	}
+
+	var tiers [][]*nameToReplicas
+	for _, name := range s.subsetPriority {
+		if subset, exist := nameToUnspecified[name]; exist {
+			tiers = append(tiers, []*nameToReplicas{subset})
+		}
+	}
+	if s.initialStrategy == appsv1alpha1.SingleSubsetInitialStrategyType && len(tiers) > 1 {
+		tiers = tiers[:1]
+	}
+
+	return s.allocateByTiers(tiers, replicas)
+}
+
+// priorityTiers groups the unspecified subsets into tiers in order of their scheduling priorities. Subsets absent
+// from schedulingPriorities have priority 0.
+func (s *replicasAllocator) priorityTiers(unspecified []*nameToReplicas) [][]*nameToReplicas {
+	nameToTier := map[int32][]*nameToReplicas{}
+	var priorities []int32
+	for _, subset := range unspecified {
+		priority := s.schedulingPriorities[subset.SubsetName]
+		if _, exist := nameToTier[priority]; !exist {
+			priorities = append(priorities, priority)
+		}
+		nameToTier[priority] = append(nameToTier[priority], subset)
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i] > priorities[j]
+	})
+
+	tiers := make([][]*nameToReplicas, 0, len(priorities))
+	for _, priority := range priorities {
+		tiers = append(tiers, nameToTier[priority])
+	}
+	return tiers
+}
+
+// overflowTiers puts the unspecified subsets absent from overflowOrder into the first tier, followed by
+// one tier for each overflow subset in the order of overflowOrder.
+func (s *replicasAllocator) overflowTiers(unspecified []*nameToReplicas) [][]*nameToReplicas {
+	overflow := sets.NewString(s.overflowOrder...)
+	nameToUnspecified := map[string]*nameToReplicas{}
+	var primary []*nameToReplicas
+	for _, subset := range unspecified {
+		nameToUnspecified[subset.SubsetName] = subset
+		if !overflow.Has(subset.SubsetName) {
+			primary = append(primary, subset)
+		}
+	}
+
+	tiers := [][]*nameToReplicas{primary}
+	for _, name := range s.overflowOrder {
+		if subset, exist := nameToUnspecified[name]; exist {
+			tiers = append(tiers, []*nameToReplicas{subset})
+		}
+	}
+	return tiers
+}
+
+// allocateByTiers fills the tiers of subsets one by one, so that a tier receives replicas only if the tiers
+// before it are filled to their max replicas. It returns the replicas which can not be allocated.
+func (s *replicasAllocator) allocateByTiers(tiers [][]*nameToReplicas, replicas int32) int32 {
+	for _, tier := range tiers {
+		share := replicas
+		var capacity int64
+		bounded := true
+		for _, subset := range tier {
+			if bound := subset.upperBound(); bound != nil {
+				capacity += int64(*bound)
 			} else {
-				subset.Replicas = int32(average)
+				bounded = false
+			}
+		}
+		if bounded && capacity < int64(share) {
+			share = int32(capacity)
+		}
+
+		replicas -= share - s.allocateUnspecified(tier, share)
+	}
+
+	return replicas
+}
+
+// activateSubsets returns the unspecified subsets which should receive replicas, and scales the others to 0.
+// Subsets are activated in order of priority up to maxActiveSubsets, counting the specified subsets having replicas,
+// and further ones only if the active subsets can not hold the replicas.
+func (s *replicasAllocator) activateSubsets(unspecified []*nameToReplicas, replicas int32) []*nameToReplicas {
+	if s.maxActiveSubsets == nil {
+		return unspecified
+	}
+
+	slots := int(*s.maxActiveSubsets)
+	for _, subset := range *s.subsets {
+		if subset.Specified && subset.Replicas > 0 {
+			slots--
+		}
+	}
+
+	nameToUnspecified := map[string]*nameToReplicas{}
+	for _, subset := range unspecified {
+		nameToUnspecified[subset.SubsetName] = subset
+	}
+
+	active := sets.NewString()
+	var capacity int64
+	bounded := true
+	for _, name := range s.subsetPriority {
+		subset, exist := nameToUnspecified[name]
+		if !exist {
+			continue
+		}
+		if active.Len() >= slots && (!bounded || capacity >= int64(replicas)) {
+			break
+		}
+
+		active.Insert(name)
+		if bound := subset.upperBound(); bound != nil {
+			capacity += int64(*bound)
+		} else {
+			bounded = false
+		}
+	}
+
+	var activeSubsets []*nameToReplicas
+	for _, subset := range unspecified {
+		if active.Has(subset.SubsetName) {
+			activeSubsets = append(activeSubsets, subset)
+		} else {
+			subset.Replicas = 0
+		}
+	}
+	return activeSubsets
+}
+
+// allocateAverage averagely allocates replicas to the subsets, which are sorted in order of increment.
+// The remainder goes to the subsets at the end. A subset whose share exceeds its upper bound is capped,
+// and its excess is averaged among the others again. Likewise, a subset whose share is below its min replicas is
+// raised to them, and the others share what is left. It returns the replicas which can not be allocated, and the
+// unrounded share of each subset which is not capped or raised.
+func allocateAverage(subsets []*nameToReplicas, replicas int32) (int32, map[string]float64) {
+	return allocateRoundedAverage(subsets, replicas, appsv1alpha1.LargestRemainderRoundingModeType)
+}
+
+// allocateRoundedAverage is allocateAverage rounding the even split as mode indicates. With Floor, the replicas
+// left over after the even split are dropped rather than reported as unallocated, and with Ceil, the subsets at
+// the end get the rounded up shares until the replicas run out.
+func allocateRoundedAverage(subsets []*nameToReplicas, replicas int32, mode appsv1alpha1.RoundingModeType) (int32, map[string]float64) {
+	pending := subsets
+	for len(pending) > 0 {
+		shares := roundedShares(replicas, len(pending), mode)
+
+		var uncapped []*nameToReplicas
+		for i, subset := range pending {
+			if bound := subset.upperBound(); bound != nil && shares[i] > *bound {
+				subset.Replicas, subset.PinnedBy = *bound, pinnedByMax
+				replicas -= *bound
+				continue
+			}
+			if floor := subset.MinReplicas; floor != nil && shares[i] < *floor {
+				subset.Replicas, subset.PinnedBy = *floor, pinnedByMin
+				replicas -= *floor
+				continue
+			}
+			uncapped = append(uncapped, subset)
+		}
+
+		if len(uncapped) == len(pending) {
+			ideal := make(map[string]float64, len(pending))
+			for i, subset := range pending {
+				subset.Replicas = shares[i]
+				ideal[subset.SubsetName] = float64(replicas) / float64(len(pending))
 			}
+			return 0, ideal
+		}
+		pending = uncapped
+	}
 
-			leftSubsetCount--
+	return replicas, nil
+}
+
+// roundedShares splits replicas evenly into count shares rounded as mode indicates, and the rounding is adjusted
+// on the shares at the end.
+func roundedShares(replicas int32, count int, mode appsv1alpha1.RoundingModeType) []int32 {
+	average := int(replicas) / count
+	remainder := int(replicas) % count
 
-			if leftSubsetCount == 0 {
-				break
+	shares := make([]int32, count)
+	switch mode {
+	case appsv1alpha1.FloorRoundingModeType:
+		for i := range shares {
+			shares[i] = int32(average)
+		}
+	case appsv1alpha1.CeilRoundingModeType:
+		ceil := average
+		if remainder > 0 {
+			ceil++
+		}
+		left := int(replicas)
+		for i := count - 1; i >= 0; i-- {
+			if left < ceil {
+				shares[i] = int32(left)
+			} else {
+				shares[i] = int32(ceil)
+			}
+			left -= int(shares[i])
+		}
+	default:
+		for i := count - 1; i >= 0; i-- {
+			shares[i] = int32(average)
+			if remainder > 0 {
+				shares[i]++
+				remainder--
 			}
 		}
 	}
+	return shares
+}
 
-	return s.toSubsetReplicaMap()
+func (s *replicasAllocator) sortSubsets() {
+	less := s.less
+	if less == nil {
+		less = defaultSubsetComparator
+	}
+	sort.Sort(subsetSorter{subsetInfos: *s.subsets, less: less})
 }
 
 func (s *replicasAllocator) toSubsetReplicaMap() *map[string]int32 {
@@ -206,10 +1775,26 @@ func (s *replicasAllocator) toSubsetReplicaMap() *map[string]int32 {
 
 func (s *replicasAllocator) String() string {
 	result := ""
-	sort.Sort(s.subsets)
+	s.sortSubsets()
 	for _, subset := range *s.subsets {
 		result = fmt.Sprintf("%s %s -> %d;", result, subset.SubsetName, subset.Replicas)
 	}
 
 	return result
 }
+
+// StringByName is the form of String in the order of subset names rather than replicas, so that the output of
+// the same subsets could be diffed across allocations as their replicas change.
+func (s *replicasAllocator) StringByName() string {
+	return subsetReplicasStringByName(s.toSubsetReplicaMap())
+}
+
+// subsetReplicasStringByName formats the replicas of subsets as StringByName does, or returns "" if replicas is nil.
+func subsetReplicasStringByName(replicas *map[string]int32) string {
+	result := ""
+	for _, name := range sortedSubsetNames(replicas) {
+		result = fmt.Sprintf("%s %s -> %d;", result, name, (*replicas)[name])
+	}
+
+	return result
+}
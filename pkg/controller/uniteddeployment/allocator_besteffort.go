@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// SpecifiedReplicasAdjustment records how the BestEffort schedule strategy adjusts the specified replicas of a subset.
+type SpecifiedReplicasAdjustment struct {
+	// Specified is the replicas specified for the subset.
+	Specified int32
+	// Applied is the replicas applied to the subset instead.
+	Applied int32
+}
+
+// isBestEffortSchedule returns true if the specified replicas of subsets which do not fit should be adjusted
+// rather than failing the allocation.
+func isBestEffortSchedule(ud *appsv1alpha1.UnitedDeployment) bool {
+	return ud.Spec.Topology.ScheduleStrategy == appsv1alpha1.BestEffortScheduleStrategyType
+}
+
+// fitSpecifiedReplicas caps the specified replicas of each subset within its min and max replicas, and scales the
+// part above the min replicas down proportionally if the specified replicas sum to more than replicas. The replicas
+// lost by flooring the shares are given back to the subsets of the largest remainders, in the order of their names.
+// It returns the fitted replicas together with the adjustments of the subsets whose specified replicas are changed.
+// If even the min replicas of the specified subsets do not fit, they are kept for validateReplicas to reject.
+func fitSpecifiedReplicas(infos *subsetInfos, replicas int32, specifiedReplicas *map[string]int32) (*map[string]int32, map[string]SpecifiedReplicasAdjustment) {
+	fitted := make(map[string]int32, len(*specifiedReplicas))
+	for name, specified := range *specifiedReplicas {
+		fitted[name] = specified
+	}
+
+	floors := map[string]int32{}
+	for _, subset := range *infos {
+		specified, exist := fitted[subset.SubsetName]
+		if !exist {
+			continue
+		}
+		if subset.MaxReplicas != nil && specified > *subset.MaxReplicas {
+			specified = *subset.MaxReplicas
+		}
+		if subset.MinReplicas != nil && specified < *subset.MinReplicas {
+			specified = *subset.MinReplicas
+		}
+		fitted[subset.SubsetName] = specified
+		if subset.MinReplicas != nil {
+			floors[subset.SubsetName] = *subset.MinReplicas
+		}
+	}
+
+	// sum up in int64, since the specified replicas of many subsets could overflow int32
+	var sum, floorSum int64
+	for name, specified := range fitted {
+		sum += int64(specified)
+		floorSum += int64(floors[name])
+	}
+	if sum > int64(replicas) && floorSum <= int64(replicas) {
+		names := make([]string, 0, len(fitted))
+		for name := range fitted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		reducible, available := sum-floorSum, int64(replicas)-floorSum
+		remainders := map[string]int64{}
+		var allocated int64
+		for _, name := range names {
+			share := int64(fitted[name]-floors[name]) * available
+			fitted[name] = floors[name] + int32(share/reducible)
+			remainders[name] = share % reducible
+			allocated += int64(fitted[name])
+		}
+		sort.SliceStable(names, func(i, j int) bool {
+			return remainders[names[i]] > remainders[names[j]]
+		})
+		for i := 0; allocated < int64(replicas); i++ {
+			fitted[names[i]]++
+			allocated++
+		}
+	}
+
+	var adjustments map[string]SpecifiedReplicasAdjustment
+	for name, specified := range *specifiedReplicas {
+		if fitted[name] == specified {
+			continue
+		}
+
+		if adjustments == nil {
+			adjustments = map[string]SpecifiedReplicasAdjustment{}
+		}
+		adjustments[name] = SpecifiedReplicasAdjustment{Specified: specified, Applied: fitted[name]}
+	}
+	return &fitted, adjustments
+}
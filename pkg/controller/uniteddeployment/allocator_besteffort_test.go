@@ -0,0 +1,126 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestBestEffortSchedule(t *testing.T) {
+	two, six, eight := intstr.FromInt(2), intstr.FromInt(6), intstr.FromInt(8)
+	cases := []struct {
+		name        string
+		replicas    int32
+		strategy    appsv1alpha1.ScheduleStrategyType
+		subsets     []appsv1alpha1.Subset
+		expected    map[string]int32
+		adjustments map[string]SpecifiedReplicasAdjustment
+		reason      AllocationReasonCode
+	}{
+		{
+			name:     "specified replicas which fit are applied as they are",
+			replicas: 10,
+			strategy: appsv1alpha1.BestEffortScheduleStrategyType,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "a", Replicas: &two},
+				{Name: "b"},
+			},
+			expected: map[string]int32{"a": 2, "b": 8},
+		},
+		{
+			name:     "overshoot is scaled down proportionally",
+			replicas: 10,
+			strategy: appsv1alpha1.BestEffortScheduleStrategyType,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "a", Replicas: &six},
+				{Name: "b", Replicas: &eight},
+				{Name: "c"},
+			},
+			expected: map[string]int32{"a": 4, "b": 6, "c": 0},
+			adjustments: map[string]SpecifiedReplicasAdjustment{
+				"a": {Specified: 6, Applied: 4},
+				"b": {Specified: 8, Applied: 6},
+			},
+		},
+		{
+			name:     "specified replicas are capped at max replicas",
+			replicas: 10,
+			strategy: appsv1alpha1.BestEffortScheduleStrategyType,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "a", Replicas: &six, MaxReplicas: int32Ptr(4)},
+				{Name: "b"},
+				{Name: "c"},
+			},
+			expected: map[string]int32{"a": 4, "b": 3, "c": 3},
+			adjustments: map[string]SpecifiedReplicasAdjustment{
+				"a": {Specified: 6, Applied: 4},
+			},
+		},
+		{
+			name:     "single subset over the replicas is capped at the replicas",
+			replicas: 5,
+			strategy: appsv1alpha1.BestEffortScheduleStrategyType,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "a", Replicas: &eight},
+				{Name: "b"},
+			},
+			expected: map[string]int32{"a": 5, "b": 0},
+			adjustments: map[string]SpecifiedReplicasAdjustment{
+				"a": {Specified: 8, Applied: 5},
+			},
+		},
+		{
+			name:     "overshoot fails the strict allocation",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "a", Replicas: &six},
+				{Name: "b", Replicas: &eight},
+				{Name: "c"},
+			},
+			reason: OverSpecifiedAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			ud.Spec.Topology.ScheduleStrategy = c.strategy
+			result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if c.reason != "" {
+				if result.ReasonCode != c.reason {
+					t.Fatalf("expected reason %s, got %s (%s)", c.reason, result.ReasonCode, result.Message)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %s: %s", result.ReasonCode, result.Message)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+			if !reflect.DeepEqual(result.SpecifiedAdjustments, c.adjustments) {
+				t.Fatalf("expected adjustments %v, got %v", c.adjustments, result.SpecifiedAdjustments)
+			}
+		})
+	}
+}
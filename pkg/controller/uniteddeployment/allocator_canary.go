@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// getCanaryRampStatus returns the start of the ramp of Topology.CanaryRamp, which is the one recorded in
+// Status.CanaryRamp, or the present if the ramp is new or its canary subset changes. It returns nil if no
+// canary ramp is configured.
+func getCanaryRampStatus(ud *appsv1alpha1.UnitedDeployment) *appsv1alpha1.CanaryRampStatus {
+	ramp := ud.Spec.Topology.CanaryRamp
+	if ramp == nil {
+		return nil
+	}
+	if recorded := ud.Status.CanaryRamp; recorded != nil && recorded.Subset == ramp.Subset {
+		return recorded.DeepCopy()
+	}
+	return &appsv1alpha1.CanaryRampStatus{Subset: ramp.Subset, StartTime: metav1.NewTime(stabilizationClock.Now())}
+}
+
+// getCanaryRampPercent returns the share in percentage which the canary subset holds at present. It rises
+// linearly from 0 to the target percentage over the ramp duration.
+func getCanaryRampPercent(ud *appsv1alpha1.UnitedDeployment, status *appsv1alpha1.CanaryRampStatus) float64 {
+	ramp := ud.Spec.Topology.CanaryRamp
+	target := math.Min(math.Max(float64(ramp.TargetPercent), 0), 100)
+	duration := time.Duration(ramp.RampDurationSeconds) * time.Second
+	if duration <= 0 {
+		return target
+	}
+
+	elapsed := stabilizationClock.Now().Sub(status.StartTime.Time)
+	return target * math.Min(math.Max(float64(elapsed)/float64(duration), 0), 1)
+}
+
+// getCanaryRampReplicas returns the replicas of the canary subset at present, rounded half up like the
+// percentages of Subset.Replicas. It returns false if no canary ramp is configured for a subset in the topology.
+func getCanaryRampReplicas(ud *appsv1alpha1.UnitedDeployment) (string, int32, bool) {
+	ramp := ud.Spec.Topology.CanaryRamp
+	if ramp == nil {
+		return "", 0, false
+	}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Name == ramp.Subset {
+			percent := getCanaryRampPercent(ud, getCanaryRampStatus(ud))
+			return ramp.Subset, int32(math.Floor(float64(getUnitedDeploymentReplicas(ud))*percent/100 + 0.5)), true
+		}
+	}
+	return "", 0, false
+}
+
+// getCanaryRampRequeueAfter returns the duration after which the canary subset gets its next replica, or 0 if
+// the canary subset has reached its target or no canary ramp is configured.
+func getCanaryRampRequeueAfter(ud *appsv1alpha1.UnitedDeployment, status *appsv1alpha1.UnitedDeploymentStatus) time.Duration {
+	ramp := ud.Spec.Topology.CanaryRamp
+	replicas := getUnitedDeploymentReplicas(ud)
+	if ramp == nil || status.CanaryRamp == nil || ramp.TargetPercent <= 0 || ramp.RampDurationSeconds <= 0 || replicas <= 0 {
+		return 0
+	}
+	_, current, ok := getCanaryRampReplicas(ud)
+	if !ok {
+		return 0
+	}
+
+	// the next replica is rounded up once the share reaches half a replica more than the current ones
+	fraction := (float64(current) + 0.5) * 100 / float64(replicas) / math.Min(float64(ramp.TargetPercent), 100)
+	if fraction > 1 {
+		return 0
+	}
+	duration := time.Duration(ramp.RampDurationSeconds) * time.Second
+	after := status.CanaryRamp.StartTime.Add(time.Duration(fraction * float64(duration))).Sub(stabilizationClock.Now())
+	if after < time.Second {
+		after = time.Second
+	}
+	return after
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestCanaryRamp(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	origin := stabilizationClock
+	stabilizationClock = fakeClock
+	defer func() {
+		stabilizationClock = origin
+	}()
+
+	for name, c := range map[string]struct {
+		elapsed      *time.Duration
+		expected     map[string]int32
+		requeueAfter time.Duration
+	}{
+		"new ramp": {
+			expected:     map[string]int32{"t1": 5, "t2": 5, "t3": 0},
+			requeueAfter: 12500 * time.Millisecond,
+		},
+		"0% of the ramp": {
+			elapsed:      durationPtr(0),
+			expected:     map[string]int32{"t1": 5, "t2": 5, "t3": 0},
+			requeueAfter: 12500 * time.Millisecond,
+		},
+		"50% of the ramp": {
+			elapsed:      durationPtr(50 * time.Second),
+			expected:     map[string]int32{"t1": 4, "t2": 4, "t3": 2},
+			requeueAfter: 12500 * time.Millisecond,
+		},
+		"100% of the ramp": {
+			elapsed:  durationPtr(100 * time.Second),
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"after the ramp": {
+			elapsed:  durationPtr(time.Hour),
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+	} {
+		ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Spec.Topology.CanaryRamp = &appsv1alpha1.CanaryRamp{Subset: "t3", TargetPercent: 40, RampDurationSeconds: 100}
+		if c.elapsed != nil {
+			ud.Status.CanaryRamp = &appsv1alpha1.CanaryRampStatus{Subset: "t3", StartTime: metav1.NewTime(fakeClock.Now().Add(-*c.elapsed))}
+		}
+
+		next, _, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+
+		status := &appsv1alpha1.UnitedDeploymentStatus{CanaryRamp: getCanaryRampStatus(ud)}
+		if c.elapsed == nil && !status.CanaryRamp.StartTime.Time.Equal(fakeClock.Now()) {
+			t.Fatalf("%s: expected the ramp to start at present, got %v", name, status.CanaryRamp)
+		}
+		if after := getCanaryRampRequeueAfter(ud, status); after != c.requeueAfter {
+			t.Fatalf("%s: expected requeue after %v, got %v", name, c.requeueAfter, after)
+		}
+	}
+}
+
+func TestCanaryRampRestartsOnSubsetChange(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Spec.Topology.CanaryRamp = &appsv1alpha1.CanaryRamp{Subset: "t2", TargetPercent: 50, RampDurationSeconds: 60}
+	ud.Status.CanaryRamp = &appsv1alpha1.CanaryRampStatus{Subset: "t1", StartTime: metav1.NewTime(time.Now().Add(-time.Hour))}
+
+	next, _, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 10, "t2": 0}) {
+		t.Fatalf("expected the ramp of the new canary subset to start over, got %v", *next)
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
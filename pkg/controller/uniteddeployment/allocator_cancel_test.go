@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAllocationCancelled(t *testing.T) {
+	ud := createUnitedDeployment(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := GetAllocationResult(ctx, &map[string]*Subset{}, ud)
+	if result.Effective || result.ReasonCode != CancelledAllocationReason {
+		t.Fatalf("expected the allocation to be cancelled, got effective %v and reason %s", result.Effective, result.ReasonCode)
+	}
+	if result.SubsetReplicas != nil {
+		t.Fatalf("expected no replicas allocated, got %v", *result.SubsetReplicas)
+	}
+	if _, err := GetAllocatedReplicas(ctx, &map[string]*Subset{}, ud); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the error to wrap context.Canceled, got %v", err)
+	}
+}
+
+func TestAllocationCancelledWithinSkewLimit(t *testing.T) {
+	// moving the replicas one by one until the skew is within 1 takes about a billion rounds
+	allocator := subsetInfos{createSubset("t1", 1<<30), createSubset("t2", 0)}.SortToAllocator()
+	allocator.maxSkew = int32Ptr(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	allocator.ctx = ctx
+
+	done := make(chan error, 1)
+	go func() {
+		done <- allocator.limitSkew()
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) || allocationReasonOf(err) != CancelledAllocationReason {
+			t.Fatalf("expected the skew limit to be given up at the deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the skew limit to return soon after the deadline")
+	}
+}
@@ -0,0 +1,418 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// stabilizationClock is the clock used by the time-based rules of allocation, like the replicas history of
+// UnitedDeployments and the change times of subsets.
+var stabilizationClock clock.Clock = clock.RealClock{}
+
+// smoothAllocatedReplicas moves the replicas of each subset from the last allocated replicas recorded in
+// Status.SubsetReplicas toward the calculated replicas, following the ramp curve configured by Spec.Topology.
+// The Exponential curve applies the exponential moving average of Spec.Topology.SmoothingAlphaPercent, and the
+// other curves return the progress of their ramps to be recorded in status. Nothing is smoothed on the first
+// allocation of a UnitedDeployment, or when a rebalance is requested.
+func smoothAllocatedReplicas(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32) (*map[string]int32, map[string]appsv1alpha1.SubsetRamp) {
+	alpha := ud.Spec.Topology.SmoothingAlphaPercent
+	if alpha == nil || *alpha <= 0 || *alpha >= 100 || len(ud.Status.SubsetReplicas) == 0 || isRebalanceRequested(ud) {
+		return replicas, nil
+	}
+
+	curve := ud.Spec.Topology.RampCurve
+	if curve == appsv1alpha1.LinearRampCurveType || curve == appsv1alpha1.SCurveRampCurveType {
+		return rampAllocatedReplicas(ud, replicas, curve, *alpha)
+	}
+
+	smoothed := map[string]int32{}
+	exact := map[string]float64{}
+	var lastTotal, targetTotal int32
+	for name, target := range *replicas {
+		last := ud.Status.SubsetReplicas[name]
+		smoothed[name] = last + smoothStep(target-last, *alpha)
+		exact[name] = float64(last) + float64(target-last)*float64(*alpha)/100
+		lastTotal += last
+		targetTotal += target
+	}
+	keepSmoothedTotal(smoothed, exact, lastTotal+smoothStep(targetTotal-lastTotal, *alpha))
+
+	return &smoothed, nil
+}
+
+// keepSmoothedTotal corrects the replicas of the subsets rounded from their exact smoothed replicas one by one, so
+// that they sum to total, since rounding each subset on its own could place more or fewer replicas than the
+// UnitedDeployment has. The subsets rounded up the most give back a replica first if there are too many, and the
+// ones rounded down the most take one first if there are too few, so that each subset stays within a replica of
+// its exact share like the largest remainder method. Ties are broken by subset name.
+func keepSmoothedTotal(rounded map[string]int32, exact map[string]float64, total int32) {
+	var sum int32
+	names := make([]string, 0, len(rounded))
+	for name, replicas := range rounded {
+		sum += replicas
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for ; sum != total; sum += sign(total - sum) {
+		var picked string
+		var pickedExcess float64
+		for _, name := range names {
+			excess := float64(rounded[name]) - exact[name]
+			if sum < total {
+				excess = -excess
+			}
+			if picked == "" || excess > pickedExcess {
+				picked, pickedExcess = name, excess
+			}
+		}
+		if picked == "" {
+			return
+		}
+		rounded[picked] += sign(total - sum)
+	}
+}
+
+// sign returns 1 if n is positive, -1 if n is negative, or 0.
+func sign(n int32) int32 {
+	if n > 0 {
+		return 1
+	} else if n < 0 {
+		return -1
+	}
+	return 0
+}
+
+// rampAllocatedReplicas moves the replicas of each subset along the curve from the replicas where its ramp started
+// to the calculated replicas in 100/alphaPercent reconciles. A ramp restarts from the last allocated replicas
+// whenever the calculated replicas of the subset change.
+func rampAllocatedReplicas(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32, curve appsv1alpha1.RampCurveType, alphaPercent int32) (*map[string]int32, map[string]appsv1alpha1.SubsetRamp) {
+	rounds := math.Ceil(100 / float64(alphaPercent))
+	ramped := map[string]int32{}
+	exact := map[string]float64{}
+	ramps := map[string]appsv1alpha1.SubsetRamp{}
+	var exactTotal float64
+	for name, target := range *replicas {
+		last := ud.Status.SubsetReplicas[name]
+		if last == target {
+			ramped[name], exact[name] = target, float64(target)
+			exactTotal += exact[name]
+			continue
+		}
+
+		ramp, exist := ud.Status.SubsetRamps[name]
+		if !exist || ramp.To != target {
+			ramp = appsv1alpha1.SubsetRamp{From: last, To: target}
+		}
+		ramp.Step++
+
+		progress := rampProgress(curve, math.Min(float64(ramp.Step)/rounds, 1))
+		exact[name] = float64(ramp.From) + progress*float64(ramp.To-ramp.From)
+		exactTotal += exact[name]
+		ramped[name] = ramp.From + int32(math.Round(progress*float64(ramp.To-ramp.From)))
+		ramps[name] = ramp
+	}
+	keepSmoothedTotal(ramped, exact, int32(math.Round(exactTotal)))
+	for name := range ramps {
+		if ramped[name] == (*replicas)[name] {
+			delete(ramps, name)
+		}
+	}
+
+	if len(ramps) == 0 {
+		ramps = nil
+	}
+	return &ramped, ramps
+}
+
+// rampProgress maps the elapsed fraction of a ramp to the fraction of the difference it should have covered.
+func rampProgress(curve appsv1alpha1.RampCurveType, elapsed float64) float64 {
+	if curve == appsv1alpha1.SCurveRampCurveType {
+		return elapsed * elapsed * (3 - 2*elapsed)
+	}
+	return elapsed
+}
+
+// isRebalanceRequested returns true if the UnitedDeployment carries a rebalance-now annotation for its current generation.
+func isRebalanceRequested(ud *appsv1alpha1.UnitedDeployment) bool {
+	generation, exist := ud.Annotations[appsv1alpha1.AnnotationRebalanceNow]
+	return exist && generation == strconv.FormatInt(ud.Generation, 10)
+}
+
+// limitSubsetScaleIn limits the replicas each subset loses from the last allocated replicas recorded in
+// Status.SubsetReplicas to MaxScaleInPercent of them, and to at least one replica so that the subset converges.
+// The scale-out of the other subsets is held back by the replicas kept, so that the total is not exceeded.
+// Nothing is limited when a rebalance is requested.
+func limitSubsetScaleIn(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32) *map[string]int32 {
+	if isRebalanceRequested(ud) {
+		return replicas
+	}
+
+	limited := map[string]int32{}
+	for name, target := range *replicas {
+		limited[name] = target
+	}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.MaxScaleInPercent == nil {
+			continue
+		}
+		last, exist := ud.Status.SubsetReplicas[subsetDef.Name]
+		target := limited[subsetDef.Name]
+		if diff := target - last; exist && diff < 0 {
+			if step := smoothStep(last, *subsetDef.MaxScaleInPercent); -diff > step {
+				limited[subsetDef.Name] = last - step
+			}
+		}
+	}
+
+	holdBackMatchingChanges(ud, replicas, limited)
+	return &limited
+}
+
+// limitRebalance limits the replicas each subset loses from the last allocated replicas recorded in
+// Status.SubsetReplicas to Topology.MaxUnavailableDuringRebalance, and to at least one replica so that the subset
+// converges. The subsets gaining replicas only receive the replicas given up within this budget, so that the
+// intermediate plan keeps the total. It also returns whether any subset is limited, in which case the rebalance
+// continues in the following reconciles. Nothing is limited when a rebalance is requested.
+func limitRebalance(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32) (*map[string]int32, bool) {
+	budget := ud.Spec.Topology.MaxUnavailableDuringRebalance
+	if budget == nil || isRebalanceRequested(ud) {
+		return replicas, false
+	}
+
+	limited := map[string]int32{}
+	rebalancing := false
+	for name, target := range *replicas {
+		limited[name] = target
+		last, exist := ud.Status.SubsetReplicas[name]
+		if !exist || target >= last {
+			continue
+		}
+
+		step, err := intstr.GetScaledValueFromIntOrPercent(budget, int(last), true)
+		if err != nil {
+			allocationLoggerFor(ud).Error(err, "Ignore invalid maxUnavailableDuringRebalance", "maxUnavailableDuringRebalance", budget.String())
+			return replicas, false
+		}
+		if step < 1 {
+			step = 1
+		}
+		if last-target > int32(step) {
+			limited[name] = last - int32(step)
+			rebalancing = true
+		}
+	}
+
+	holdBackMatchingChanges(ud, replicas, limited)
+	return &limited, rebalancing
+}
+
+// smoothStep returns alphaPercent of diff, rounded away from zero so that the average always converges.
+func smoothStep(diff, alphaPercent int32) int32 {
+	if diff == 0 {
+		return 0
+	}
+
+	step := int32(math.Ceil(math.Abs(float64(diff)) * float64(alphaPercent) / 100))
+	if diff < 0 {
+		return -step
+	}
+	return step
+}
+
+// getReplicasHistory returns the replicas history of the UnitedDeployment with its current replicas recorded.
+// Records superseded before the scale down stabilization window starts are dropped, and nil is returned
+// if no window is configured.
+func getReplicasHistory(ud *appsv1alpha1.UnitedDeployment) []appsv1alpha1.ReplicasHistoryRecord {
+	window := ud.Spec.Topology.ScaleDownStabilizationWindowSeconds
+	if window == nil || *window <= 0 {
+		return nil
+	}
+
+	now := stabilizationClock.Now()
+	history := make([]appsv1alpha1.ReplicasHistoryRecord, 0, len(ud.Status.ReplicasHistory)+1)
+	for i := range ud.Status.ReplicasHistory {
+		history = append(history, *ud.Status.ReplicasHistory[i].DeepCopy())
+	}
+	if replicas := getUnitedDeploymentReplicas(ud); len(history) == 0 || history[len(history)-1].Replicas != replicas {
+		history = append(history, appsv1alpha1.ReplicasHistoryRecord{Replicas: replicas, Time: metav1.NewTime(now)})
+	}
+
+	start := now.Add(-time.Duration(*window) * time.Second)
+	for len(history) > 1 && !history[1].Time.After(start) {
+		history = history[1:]
+	}
+	return history
+}
+
+// getStabilizedReplicas returns the replicas to allocate to the subsets, which is the highest replicas desired
+// within the scale down stabilization window.
+func getStabilizedReplicas(ud *appsv1alpha1.UnitedDeployment) int32 {
+	replicas := getUnitedDeploymentReplicas(ud)
+	for _, record := range getReplicasHistory(ud) {
+		if record.Replicas > replicas {
+			replicas = record.Replicas
+		}
+	}
+	return replicas
+}
+
+// getStabilizationRequeueAfter returns the duration after which the oldest replicas in the history leave the
+// scale down stabilization window, or 0 if the current replicas are the only ones in effect.
+func getStabilizationRequeueAfter(ud *appsv1alpha1.UnitedDeployment) time.Duration {
+	history := getReplicasHistory(ud)
+	if len(history) < 2 {
+		return 0
+	}
+
+	window := time.Duration(*ud.Spec.Topology.ScaleDownStabilizationWindowSeconds) * time.Second
+	return history[1].Time.Add(window).Sub(stabilizationClock.Now())
+}
+
+// getMinSubsetReplicasChangeInterval returns the minimum interval between two changes of the replicas of a subset,
+// or 0 if it is not configured.
+func getMinSubsetReplicasChangeInterval(ud *appsv1alpha1.UnitedDeployment) time.Duration {
+	interval := ud.Spec.Topology.MinSubsetReplicasChangeIntervalSeconds
+	if interval == nil || *interval <= 0 {
+		return 0
+	}
+	return time.Duration(*interval) * time.Second
+}
+
+// deferSubsetReplicasChanges holds the subsets whose replicas changed within the minimum change interval at
+// the last allocated replicas recorded in Status.SubsetReplicas. The matching changes of the other subsets are
+// held back as well, so that deferring a scale-out does not let the replicas it replaces go away before it.
+// Nothing is deferred when a rebalance is requested.
+func deferSubsetReplicasChanges(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32) *map[string]int32 {
+	interval := getMinSubsetReplicasChangeInterval(ud)
+	if interval == 0 || isRebalanceRequested(ud) {
+		return replicas
+	}
+
+	now := stabilizationClock.Now()
+	deferred := map[string]int32{}
+	for name, target := range *replicas {
+		deferred[name] = target
+		last, exist := ud.Status.SubsetReplicas[name]
+		if !exist || last == target {
+			continue
+		}
+		if changeTime, exist := ud.Status.SubsetReplicasChangeTimes[name]; exist && now.Before(changeTime.Add(interval)) {
+			deferred[name] = last
+		}
+	}
+
+	holdBackMatchingChanges(ud, replicas, deferred)
+	return &deferred
+}
+
+// holdBackMatchingChanges moves the subsets which are not held back by a limit toward the last allocated replicas
+// recorded in Status.SubsetReplicas, so that the limited replicas sum to the calculated replicas again. The replicas
+// kept by a limited scale-in are taken from the scale-out of the other subsets, and the replicas missed by a limited
+// scale-out are kept by the scale-in of the other subsets. If the other subsets cannot make up for all of them, they
+// stay at their last replicas, so that the limited replicas sum to neither less than both the calculated and the
+// last total nor more than both of them. The difference is shared in proportion to how far each subset moves.
+func holdBackMatchingChanges(ud *appsv1alpha1.UnitedDeployment, replicas *map[string]int32, limited map[string]int32) {
+	var excess int64
+	names := make([]string, 0, len(limited))
+	for name, target := range *replicas {
+		excess += int64(limited[name]) - int64(target)
+		names = append(names, name)
+	}
+	if excess == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	// the subsets moving away from their last replicas in the direction the excess can be taken back from
+	var pending []int
+	var room []float64
+	var totalRoom int64
+	for _, name := range names {
+		moved := int64(limited[name]) - int64(ud.Status.SubsetReplicas[name])
+		if excess < 0 {
+			moved = -moved
+		}
+		if moved > 0 {
+			pending = append(pending, len(room))
+			totalRoom += moved
+		}
+		room = append(room, float64(moved))
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	heldBack, direction := excess, int32(-1)
+	if excess < 0 {
+		heldBack, direction = -excess, 1
+	}
+	if heldBack > totalRoom {
+		heldBack = totalRoom
+	}
+	shares, _ := weightedShares(int32(heldBack), pending, room)
+	for i, idx := range pending {
+		limited[names[idx]] += direction * shares[i]
+	}
+}
+
+// getSubsetReplicasChangeTimes returns the last time the replicas of each subset changed, with the subsets whose
+// replicas are changing to next replicas recorded at present. It returns nil if no minimum change interval is configured.
+func getSubsetReplicasChangeTimes(ud *appsv1alpha1.UnitedDeployment, next map[string]int32) map[string]metav1.Time {
+	if getMinSubsetReplicasChangeInterval(ud) == 0 {
+		return nil
+	}
+
+	now := metav1.NewTime(stabilizationClock.Now())
+	changeTimes := map[string]metav1.Time{}
+	for name, replicas := range next {
+		if last, exist := ud.Status.SubsetReplicas[name]; !exist || last != replicas {
+			changeTimes[name] = now
+		} else if changeTime, exist := ud.Status.SubsetReplicasChangeTimes[name]; exist {
+			changeTimes[name] = changeTime
+		}
+	}
+	return changeTimes
+}
+
+// getSubsetReplicasChangeRequeueAfter returns the duration after which the earliest minimum change interval recorded
+// in the status elapses, or 0 if none is in effect.
+func getSubsetReplicasChangeRequeueAfter(ud *appsv1alpha1.UnitedDeployment, status *appsv1alpha1.UnitedDeploymentStatus) time.Duration {
+	interval := getMinSubsetReplicasChangeInterval(ud)
+	if interval == 0 {
+		return 0
+	}
+
+	var requeueAfter time.Duration
+	now := stabilizationClock.Now()
+	for _, changeTime := range status.SubsetReplicasChangeTimes {
+		if after := changeTime.Add(interval).Sub(now); after > 0 && (requeueAfter == 0 || after < requeueAfter) {
+			requeueAfter = after
+		}
+	}
+	return requeueAfter
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestSmoothAllocatedReplicas(t *testing.T) {
+	t1Replicas := intstr.FromInt(10)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"})
+	alpha := int32(30)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 0, "t2": 10}
+
+	// the raw target steps from t1=0,t2=10 to t1=10,t2=0
+	expected := []map[string]int32{
+		{"t1": 3, "t2": 7},
+		{"t1": 6, "t2": 4},
+		{"t1": 8, "t2": 2},
+		{"t1": 9, "t2": 1},
+		{"t1": 10, "t2": 0},
+		{"t1": 10, "t2": 0},
+	}
+	for i, exp := range expected {
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, exp) {
+			t.Fatalf("step %d: expected %v, got %v", i, exp, *next)
+		}
+		ud.Status.SubsetReplicas = *next
+	}
+
+	alpha = 100
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 0, "t2": 10}
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 10, "t2": 0}) {
+		t.Fatalf("expected immediate allocation with alpha 100, got %v", *next)
+	}
+}
+
+func TestSmoothAllocatedReplicasKeepsTotal(t *testing.T) {
+	ud := createUnitedDeployment(3, appsv1alpha1.Subset{Name: "a"}, appsv1alpha1.Subset{Name: "b"}, appsv1alpha1.Subset{Name: "c"})
+	alpha := int32(50)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Status.SubsetReplicas = map[string]int32{"a": 3, "b": 0, "c": 0}
+
+	// rounding each subset on its own would step to a=2,b=1,c=1 and place 4 replicas
+	for i := 0; i < 5; i++ {
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		var sum int32
+		for _, replicas := range *next {
+			sum += replicas
+		}
+		if sum != 3 {
+			t.Fatalf("step %d: expected 3 replicas in total, got %v", i, *next)
+		}
+		ud.Status.SubsetReplicas = *next
+	}
+	if !reflect.DeepEqual(ud.Status.SubsetReplicas, map[string]int32{"a": 1, "b": 1, "c": 1}) {
+		t.Fatalf("expected the replicas to converge to a=1,b=1,c=1, got %v", ud.Status.SubsetReplicas)
+	}
+}
+
+func TestRebalanceNow(t *testing.T) {
+	t1Replicas := intstr.FromInt(10)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"})
+	alpha := int32(30)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 0, "t2": 10}
+	ud.Generation = 2
+
+	ud.Annotations = map[string]string{appsv1alpha1.AnnotationRebalanceNow: "1"}
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 7}) {
+		t.Fatalf("stale rebalance request should be ignored, got %v", *next)
+	}
+
+	ud.Annotations[appsv1alpha1.AnnotationRebalanceNow] = "2"
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 10, "t2": 0}) {
+		t.Fatalf("rebalance request should bypass smoothing, got %v", *next)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = appsv1alpha1.AddToScheme(scheme)
+	r := &ReconcileUnitedDeployment{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ud).Build()}
+	if err := r.clearRebalanceRequest(ud); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	consumed := &appsv1alpha1.UnitedDeployment{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(ud), consumed); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if isRebalanceRequested(consumed) {
+		t.Fatalf("rebalance request should be consumed, got annotations %v", consumed.Annotations)
+	}
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(consumed.Status.SubsetReplicas), consumed)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 7}) {
+		t.Fatalf("smoothing should resume after rebalance, got %v", *next)
+	}
+}
+
+func TestScaleDownStabilization(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	origin := stabilizationClock
+	stabilizationClock = fakeClock
+	defer func() {
+		stabilizationClock = origin
+	}()
+
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	window := int32(300)
+	ud.Spec.Topology.ScaleDownStabilizationWindowSeconds = &window
+
+	steps := []struct {
+		after    time.Duration
+		replicas int32
+		expected map[string]int32
+	}{
+		{after: 0, replicas: 10, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 10 * time.Second, replicas: 6, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 60 * time.Second, replicas: 10, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 30 * time.Second, replicas: 6, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 290 * time.Second, replicas: 6, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 10 * time.Second, replicas: 6, expected: map[string]int32{"t1": 3, "t2": 3}},
+		{after: 0, replicas: 12, expected: map[string]int32{"t1": 6, "t2": 6}},
+	}
+	for i, step := range steps {
+		fakeClock.Step(step.after)
+		replicas := step.replicas
+		ud.Spec.Replicas = &replicas
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, step.expected) {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, *next)
+		}
+		ud.Status.SubsetReplicas = *next
+		ud.Status.ReplicasHistory = getReplicasHistory(ud)
+	}
+
+	if len(ud.Status.ReplicasHistory) != 2 || getStabilizationRequeueAfter(ud) != 300*time.Second {
+		t.Fatalf("unexpected replicas history %v", ud.Status.ReplicasHistory)
+	}
+}
+
+func TestMinSubsetReplicasChangeInterval(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	origin := stabilizationClock
+	stabilizationClock = fakeClock
+	defer func() {
+		stabilizationClock = origin
+	}()
+
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	interval := int32(300)
+	ud.Spec.Topology.MinSubsetReplicasChangeIntervalSeconds = &interval
+
+	steps := []struct {
+		after    time.Duration
+		replicas int32
+		expected map[string]int32
+	}{
+		{after: 0, replicas: 10, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 60 * time.Second, replicas: 12, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: 239 * time.Second, replicas: 12, expected: map[string]int32{"t1": 5, "t2": 5}},
+		{after: time.Second, replicas: 12, expected: map[string]int32{"t1": 6, "t2": 6}},
+		{after: 10 * time.Second, replicas: 14, expected: map[string]int32{"t1": 6, "t2": 6}},
+	}
+	for i, step := range steps {
+		fakeClock.Step(step.after)
+		replicas := step.replicas
+		ud.Spec.Replicas = &replicas
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, step.expected) {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, *next)
+		}
+		ud.Status.SubsetReplicasChangeTimes = getSubsetReplicasChangeTimes(ud, *next)
+		ud.Status.SubsetReplicas = *next
+	}
+
+	if after := getSubsetReplicasChangeRequeueAfter(ud, &ud.Status); after != 290*time.Second {
+		t.Fatalf("expected to requeue after the interval elapses, got %v", after)
+	}
+}
+
+func TestMinSubsetReplicasChangeIntervalKeepsTotal(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	origin := stabilizationClock
+	stabilizationClock = fakeClock
+	defer func() {
+		stabilizationClock = origin
+	}()
+
+	t1Replicas := intstr.FromInt(0)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"})
+	interval := int32(300)
+	ud.Spec.Topology.MinSubsetReplicasChangeIntervalSeconds = &interval
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 10, "t2": 0}
+	ud.Status.SubsetReplicasChangeTimes = map[string]metav1.Time{"t2": metav1.NewTime(fakeClock.Now())}
+
+	// moving the replicas from t1 to t2 waits for t2, instead of scaling t1 in alone
+	for i, step := range []struct {
+		after    time.Duration
+		expected map[string]int32
+	}{
+		{after: 60 * time.Second, expected: map[string]int32{"t1": 10, "t2": 0}},
+		{after: 240 * time.Second, expected: map[string]int32{"t1": 0, "t2": 10}},
+	} {
+		fakeClock.Step(step.after)
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		var sum int32
+		for _, replicas := range *next {
+			sum += replicas
+		}
+		if sum != 10 || !reflect.DeepEqual(*next, step.expected) {
+			t.Fatalf("step %d: expected %v with 10 replicas in total, got %v", i, step.expected, *next)
+		}
+		ud.Status.SubsetReplicasChangeTimes = getSubsetReplicasChangeTimes(ud, *next)
+		ud.Status.SubsetReplicas = *next
+	}
+}
+
+func TestMaxScaleInPercent(t *testing.T) {
+	limit := int32(10)
+	ud := createUnitedDeployment(50, appsv1alpha1.Subset{Name: "t1", MaxScaleInPercent: &limit})
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 100}
+
+	for i := 0; ud.Status.SubsetReplicas["t1"] != 50; i++ {
+		if i >= 10 {
+			t.Fatalf("subset should converge to 50 replicas, got %d", ud.Status.SubsetReplicas["t1"])
+		}
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		last := ud.Status.SubsetReplicas["t1"]
+		if lost := last - (*next)["t1"]; lost <= 0 || lost > 10 || lost > (last+9)/10 {
+			t.Fatalf("round %d: subset of %d replicas should lose at most 10%%, but lost %d", i, last, lost)
+		}
+		ud.Status.SubsetReplicas = *next
+	}
+}
+
+func TestMaxScaleInPercentKeepsTotal(t *testing.T) {
+	limit := int32(10)
+	maxTotal := int32(10)
+	t1Replicas := intstr.FromInt(0)
+	ud := createUnitedDeployment(20, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas, MaxScaleInPercent: &limit}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Spec.Topology.MaxTotalReplicas = &maxTotal
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 10, "t2": 0}
+
+	// t2 only receives the replicas t1 gives up, so that the capped total is never exceeded
+	for i := 0; ud.Status.SubsetReplicas["t1"] != 0; i++ {
+		if i >= 10 {
+			t.Fatalf("subset should converge to 0 replicas, got %v", ud.Status.SubsetReplicas)
+		}
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if (*next)["t1"] != ud.Status.SubsetReplicas["t1"]-1 || (*next)["t1"]+(*next)["t2"] != maxTotal {
+			t.Fatalf("round %d: expected t1 to lose one replica to t2 within %d replicas in total, got %v", i, maxTotal, *next)
+		}
+		ud.Status.SubsetReplicas = *next
+	}
+}
+
+func TestMaxUnavailableDuringRebalance(t *testing.T) {
+	for name, c := range map[string]struct {
+		budget intstr.IntOrString
+		steps  []int32
+	}{
+		"absolute": {budget: intstr.FromInt(2), steps: []int32{10, 8, 6, 4}},
+		"percent":  {budget: intstr.FromString("20%"), steps: []int32{9, 7, 5, 4}},
+	} {
+		budget := c.budget
+		ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Spec.Topology.MaxUnavailableDuringRebalance = &budget
+		ud.Status.SubsetReplicas = map[string]int32{"t1": 12, "t2": 0, "t3": 0}
+
+		var steps []int32
+		for rebalancing := true; rebalancing; {
+			if len(steps) >= 10 {
+				t.Fatalf("%s: rebalance should be done in a few steps, got %v", name, steps)
+			}
+			next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			if sum := (*next)["t1"] + (*next)["t2"] + (*next)["t3"]; sum != 12 {
+				t.Fatalf("%s: expected 12 replicas in total, got %v", name, *next)
+			}
+			if diff := (*next)["t2"] - (*next)["t3"]; diff < -1 || diff > 1 {
+				t.Fatalf("%s: expected the replicas given up to be shared by t2 and t3, got %v", name, *next)
+			}
+			rebalancing = status.rebalancing
+			steps = append(steps, (*next)["t1"])
+			ud.Status.SubsetReplicas = *next
+		}
+		if !reflect.DeepEqual(steps, c.steps) {
+			t.Fatalf("%s: expected t1 to go through %v, got %v", name, c.steps, steps)
+		}
+	}
+
+	// nothing is limited when a rebalance is requested
+	budget := intstr.FromInt(2)
+	ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.MaxUnavailableDuringRebalance = &budget
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 12, "t2": 0, "t3": 0}
+	ud.Annotations = map[string]string{appsv1alpha1.AnnotationRebalanceNow: "0"}
+	next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if status.rebalancing || !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("expected rebalance in one step, got %v", *next)
+	}
+}
+
+func TestMaxUnavailableDuringRebalanceKeepsCappedTotal(t *testing.T) {
+	budget := intstr.FromInt(1)
+	maxTotal := int32(10)
+	t1Replicas := intstr.FromInt(0)
+	ud := createUnitedDeployment(20, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Spec.Topology.MaxUnavailableDuringRebalance = &budget
+	ud.Spec.Topology.MaxTotalReplicas = &maxTotal
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 10, "t2": 0}
+
+	for i := 0; ud.Status.SubsetReplicas["t1"] != 0; i++ {
+		if i >= 10 {
+			t.Fatalf("subset should converge to 0 replicas, got %v", ud.Status.SubsetReplicas)
+		}
+		next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !status.rebalancing && (*next)["t1"] != 0 {
+			t.Fatalf("round %d: expected more rebalancing needed, got %v", i, *next)
+		}
+		if (*next)["t1"] != ud.Status.SubsetReplicas["t1"]-1 || (*next)["t1"]+(*next)["t2"] != maxTotal {
+			t.Fatalf("round %d: expected t1 to lose one replica to t2 within %d replicas in total, got %v", i, maxTotal, *next)
+		}
+		ud.Status.SubsetReplicas = *next
+	}
+}
+
+func TestRampCurve(t *testing.T) {
+	t1Replicas := intstr.FromInt(100)
+	ud := createUnitedDeployment(100, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"})
+	alpha := int32(20)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+
+	for curve, expected := range map[appsv1alpha1.RampCurveType][]int32{
+		appsv1alpha1.SCurveRampCurveType: {10, 35, 65, 90, 100, 100},
+		appsv1alpha1.LinearRampCurveType: {20, 40, 60, 80, 100, 100},
+	} {
+		ud.Spec.Topology.RampCurve = curve
+		ud.Status.SubsetReplicas = map[string]int32{"t1": 0, "t2": 100}
+		ud.Status.SubsetRamps = nil
+		for i, exp := range expected {
+			next, allocation, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(ud.Status.SubsetReplicas), ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if (*next)["t1"] != exp || (*next)["t2"] != 100-exp {
+				t.Fatalf("%s step %d: expected t1 %d, got %v", curve, i, exp, *next)
+			}
+			if exp < 100 && allocation.subsetRamps["t1"].Step != int32(i+1) {
+				t.Fatalf("%s step %d: unexpected ramps %v", curve, i, allocation.subsetRamps)
+			}
+			if exp == 100 && allocation.subsetRamps != nil {
+				t.Fatalf("%s step %d: ramps should be done, got %v", curve, i, allocation.subsetRamps)
+			}
+			ud.Status.SubsetReplicas = *next
+			ud.Status.SubsetRamps = allocation.subsetRamps
+		}
+	}
+}
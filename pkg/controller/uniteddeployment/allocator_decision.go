@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+const (
+	// AllocationDecisionLabelKey is the label of allocation decision ConfigMaps, whose value is the name
+	// of the UnitedDeployment the decision belongs to.
+	AllocationDecisionLabelKey = "apps.kruise.io/allocation-decision-of"
+
+	eventTypeAllocationDecision = "RecordAllocationDecision"
+)
+
+// recordAllocationDecisions indicates whether to write a ConfigMap for each change of the subset replicas,
+// so that the allocation changes are auditable even after the Events are garbage-collected.
+var recordAllocationDecisions = false
+
+// newAllocationDecision returns the ConfigMap recording the change of subset replicas from previous to next.
+// It is owned by the UnitedDeployment, so that the decisions are deleted together with it.
+func newAllocationDecision(ud *appsv1alpha1.UnitedDeployment, previous, next map[string]int32) (*corev1.ConfigMap, error) {
+	previousData, err := json.Marshal(previous)
+	if err != nil {
+		return nil, err
+	}
+	nextData, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName:    fmt.Sprintf("%s-allocation-", ud.Name),
+			Namespace:       ud.Namespace,
+			Labels:          map[string]string{AllocationDecisionLabelKey: ud.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(ud, controllerKind)},
+		},
+		Data: map[string]string{
+			"generation":             strconv.FormatInt(ud.Generation, 10),
+			"replicas":               strconv.FormatInt(int64(getUnitedDeploymentReplicas(ud)), 10),
+			"previousSubsetReplicas": string(previousData),
+			"subsetReplicas":         string(nextData),
+		},
+	}, nil
+}
+
+// recordAllocationDecision writes an allocation decision ConfigMap if recordAllocationDecisions is enabled
+// and the subset replicas are changed. A failure is reported as an Event rather than failing the reconcile,
+// since the allocation has been applied.
+func (r *ReconcileUnitedDeployment) recordAllocationDecision(ud *appsv1alpha1.UnitedDeployment, previous, next map[string]int32) {
+	if !recordAllocationDecisions || reflect.DeepEqual(previous, next) {
+		return
+	}
+
+	decision, err := newAllocationDecision(ud, previous, next)
+	if err == nil {
+		err = r.Create(context.TODO(), decision)
+	}
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to record allocation decision")
+		r.recorder.Event(ud.DeepCopy(), corev1.EventTypeWarning, fmt.Sprintf("Failed%s", eventTypeAllocationDecision), err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestRecordAllocationDecision(t *testing.T) {
+	origin := recordAllocationDecisions
+	recordAllocationDecisions = true
+	defer func() {
+		recordAllocationDecisions = origin
+	}()
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = appsv1alpha1.AddToScheme(scheme)
+	r := &ReconcileUnitedDeployment{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Generation = 3
+	r.recordAllocationDecision(ud, map[string]int32{"t1": 2, "t2": 2}, map[string]int32{"t1": 5, "t2": 5})
+	r.recordAllocationDecision(ud, map[string]int32{"t1": 5, "t2": 5}, map[string]int32{"t1": 5, "t2": 5})
+
+	decisions := &corev1.ConfigMapList{}
+	if err := r.List(context.TODO(), decisions, client.InNamespace(ud.Namespace), client.MatchingLabels{AllocationDecisionLabelKey: ud.Name}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(decisions.Items) != 1 {
+		t.Fatalf("expected exactly one decision, got %d", len(decisions.Items))
+	}
+
+	decision := decisions.Items[0]
+	expected := map[string]string{
+		"generation":             "3",
+		"replicas":               "10",
+		"previousSubsetReplicas": `{"t1":2,"t2":2}`,
+		"subsetReplicas":         `{"t1":5,"t2":5}`,
+	}
+	for key, value := range expected {
+		if decision.Data[key] != value {
+			t.Fatalf("expected %s of decision to be %s, got %s", key, value, decision.Data[key])
+		}
+	}
+	if owner := decision.OwnerReferences; len(owner) != 1 || owner[0].Name != ud.Name || owner[0].Kind != controllerKind.Kind {
+		t.Fatalf("unexpected owner references %v", owner)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+)
+
+// DiffAllocation returns the subsets whose replicas differ between the old and new allocations, split into the ones
+// scaling out and the ones scaling in, each mapped to its new replicas. A subset absent from one of the allocations
+// is regarded as having 0 replicas there.
+func DiffAllocation(old, new map[string]int32) (scaleOut, scaleIn map[string]int32) {
+	scaleOut, scaleIn = map[string]int32{}, map[string]int32{}
+	for name, replicas := range new {
+		if last := old[name]; replicas > last {
+			scaleOut[name] = replicas
+		} else if replicas < last {
+			scaleIn[name] = replicas
+		}
+	}
+	for name, last := range old {
+		if _, exist := new[name]; !exist && last > 0 {
+			scaleIn[name] = 0
+		}
+	}
+
+	return scaleOut, scaleIn
+}
+
+// SubsetReplicasChange is the change of the replicas of a subset between two allocations.
+type SubsetReplicasChange struct {
+	// Subset is the name of the subset.
+	Subset string
+	// From and To are the replicas of the subset in the old and new allocations.
+	From int32
+	To   int32
+}
+
+// DiffAllocationChanges returns the changes of the subsets found by DiffAllocation together with their old replicas,
+// sorted by subset name.
+func DiffAllocationChanges(old, new map[string]int32) []SubsetReplicasChange {
+	scaleOut, scaleIn := DiffAllocation(old, new)
+	changes := make([]SubsetReplicasChange, 0, len(scaleOut)+len(scaleIn))
+	for _, diff := range []map[string]int32{scaleOut, scaleIn} {
+		for name, replicas := range diff {
+			changes = append(changes, SubsetReplicasChange{Subset: name, From: old[name], To: replicas})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Subset < changes[j].Subset
+	})
+	return changes
+}
+
+// churnWarningRatio is the churn ratio above which the controller warns that an allocation relocates many replicas.
+var churnWarningRatio = 0.5
+
+// ChurnRatio returns the ratio of the replicas relocated between subsets from the current to the target allocation
+// to the total target replicas, or the total current replicas if there is no target replica. The relocated replicas
+// are the ones both removed from some subsets and added to others, so pure scaling does not count as churn, while
+// renaming a subset relocates all of its replicas.
+func ChurnRatio(current, target map[string]int32) float64 {
+	scaleOut, scaleIn := DiffAllocation(current, target)
+	var added, removed, total int64
+	for name, replicas := range scaleOut {
+		added += int64(replicas - current[name])
+	}
+	for name, replicas := range scaleIn {
+		removed += int64(current[name] - replicas)
+	}
+	for _, replicas := range target {
+		total += int64(replicas)
+	}
+	if total == 0 {
+		for _, replicas := range current {
+			total += int64(replicas)
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	relocated := added
+	if removed < relocated {
+		relocated = removed
+	}
+	return float64(relocated) / float64(total)
+}
+
+// Converged returns whether the target replicas of the subsets equal their current replicas, i.e. the allocation
+// is a fixed point and applying it changes nothing. A subset present on one side only is still to be created or
+// deleted, so it means not converged.
+func Converged(current, target map[string]int32) bool {
+	if len(current) != len(target) {
+		return false
+	}
+	for name, replicas := range target {
+		if last, exist := current[name]; !exist || last != replicas {
+			return false
+		}
+	}
+	return true
+}
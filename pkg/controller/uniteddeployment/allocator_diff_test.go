@@ -0,0 +1,266 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestDiffAllocation(t *testing.T) {
+	for name, c := range map[string]struct {
+		old, new          map[string]int32
+		scaleOut, scaleIn map[string]int32
+	}{
+		"unchanged": {
+			old:      map[string]int32{"t1": 3, "t2": 3},
+			new:      map[string]int32{"t1": 3, "t2": 3},
+			scaleOut: map[string]int32{},
+			scaleIn:  map[string]int32{},
+		},
+		"rebalanced": {
+			old:      map[string]int32{"t1": 5, "t2": 1, "t3": 3},
+			new:      map[string]int32{"t1": 3, "t2": 3, "t3": 3},
+			scaleOut: map[string]int32{"t2": 3},
+			scaleIn:  map[string]int32{"t1": 3},
+		},
+		"subset only in new": {
+			old:      map[string]int32{"t1": 6},
+			new:      map[string]int32{"t1": 3, "t2": 3, "t3": 0},
+			scaleOut: map[string]int32{"t2": 3},
+			scaleIn:  map[string]int32{"t1": 3},
+		},
+		"subset only in old": {
+			old:      map[string]int32{"t1": 3, "t2": 3, "t3": 0},
+			new:      map[string]int32{"t1": 6},
+			scaleOut: map[string]int32{"t1": 6},
+			scaleIn:  map[string]int32{"t2": 0},
+		},
+		"nil old": {
+			new:      map[string]int32{"t1": 2, "t2": 0},
+			scaleOut: map[string]int32{"t1": 2},
+			scaleIn:  map[string]int32{},
+		},
+	} {
+		scaleOut, scaleIn := DiffAllocation(c.old, c.new)
+		if !reflect.DeepEqual(scaleOut, c.scaleOut) {
+			t.Errorf("%s: expected scale out %v, got %v", name, c.scaleOut, scaleOut)
+		}
+		if !reflect.DeepEqual(scaleIn, c.scaleIn) {
+			t.Errorf("%s: expected scale in %v, got %v", name, c.scaleIn, scaleIn)
+		}
+	}
+}
+
+func TestConverged(t *testing.T) {
+	for name, c := range map[string]struct {
+		current, target map[string]int32
+		converged       bool
+	}{
+		"equal":              {current: map[string]int32{"t1": 3, "t2": 0}, target: map[string]int32{"t1": 3, "t2": 0}, converged: true},
+		"both empty":         {converged: true},
+		"replicas differ":    {current: map[string]int32{"t1": 3, "t2": 1}, target: map[string]int32{"t1": 2, "t2": 2}},
+		"subset to create":   {current: map[string]int32{"t1": 3}, target: map[string]int32{"t1": 3, "t2": 0}},
+		"subset to delete":   {current: map[string]int32{"t1": 3, "t2": 0}, target: map[string]int32{"t1": 3}},
+		"subset substituted": {current: map[string]int32{"t1": 3, "t2": 0}, target: map[string]int32{"t1": 3, "t3": 0}},
+	} {
+		if converged := Converged(c.current, c.target); converged != c.converged {
+			t.Errorf("%s: expected converged %v, got %v", name, c.converged, converged)
+		}
+	}
+}
+
+// TestAllocationConverges feeds the allocated replicas back as the current replicas of subsets repeatedly, as
+// the controller does in the following reconciles, and checks that the allocation reaches a fixed point.
+func TestAllocationConverges(t *testing.T) {
+	const maxIterations = 20
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	maxUnavailable := intstr.FromInt(1)
+	cases := []struct {
+		name        string
+		incremental bool
+		replicas    int32
+		subsets     []appsv1alpha1.Subset
+		current     map[string]int32
+		topology    func(topology *appsv1alpha1.Topology)
+	}{
+		{
+			name:     "capped subsets",
+			replicas: 20,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: int32Ptr(2)}, {Name: "t2", MaxReplicas: int32Ptr(5)}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 7, "t2": 7, "t3": 6},
+		},
+		{
+			name:     "protected subset over its cap",
+			replicas: 12,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true, MaxReplicas: int32Ptr(4)}, {Name: "t2", Protected: true}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 6, "t2": 5, "t3": 5},
+		},
+		{
+			name:        "protected subset during incremental allocation",
+			replicas:    10,
+			subsets:     []appsv1alpha1.Subset{{Name: "t1", Protected: true}, {Name: "t2"}, {Name: "t3"}},
+			current:     map[string]int32{"t1": 7, "t2": 3, "t3": 4},
+			incremental: true,
+		},
+		{
+			name:     "catch-all subset with a cap",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3", CatchAll: true, MaxReplicas: int32Ptr(1)}},
+			current:  map[string]int32{"t1": 0, "t2": 0, "t3": 10},
+		},
+		{
+			name:     "stability bias",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 4, "t2": 3, "t3": 4},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.RemainderPolicy = appsv1alpha1.SpreadBySmallestRemainderPolicyType
+				topology.StabilityBias = true
+			},
+		},
+		{
+			name:     "preferred weights with a cap",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: int32Ptr(3)}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 0, "t2": 5, "t3": 5},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.PreferredWeights = map[string]int32{"t1": 5, "t2": 3, "t3": 2}
+			},
+		},
+		{
+			name:     "gradual onboarding",
+			replicas: 12,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 6, "t2": 6},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.GradualStep = int32Ptr(1)
+			},
+		},
+		{
+			name:     "limited scale-in and rebalance",
+			replicas: 9,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxScaleInPercent: int32Ptr(10)}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 9, "t2": 0, "t3": 0},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.MaxUnavailableDuringRebalance = &maxUnavailable
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			incrementalAllocation = c.incremental
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			if c.topology != nil {
+				c.topology(&ud.Spec.Topology)
+			}
+			ud.Generation = 1
+			ud.Status.ObservedGeneration = 1
+			ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 4}
+			current := c.current
+			for i := 0; i < maxIterations; i++ {
+				next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(current), ud)
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if Converged(current, *next) {
+					return
+				}
+				ud.Status.SubsetReplicas = *next
+				ud.Status.OnboardingSubsets = status.onboardingSubsets
+				ud.Status.SubsetRamps = status.subsetRamps
+				current = *next
+			}
+			t.Fatalf("allocation does not converge in %d iterations, the last replicas are %v", maxIterations, current)
+		})
+	}
+}
+
+func TestDiffAllocationChanges(t *testing.T) {
+	changes := DiffAllocationChanges(map[string]int32{"t1": 3, "t2": 4, "t3": 2}, map[string]int32{"t1": 5, "t2": 4, "t4": 1})
+	expected := []SubsetReplicasChange{
+		{Subset: "t1", From: 3, To: 5},
+		{Subset: "t3", From: 2, To: 0},
+		{Subset: "t4", From: 0, To: 1},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+	if changes := DiffAllocationChanges(map[string]int32{"t1": 3}, map[string]int32{"t1": 3}); len(changes) != 0 {
+		t.Fatalf("expected no change, got %v", changes)
+	}
+}
+
+func TestChurnRatio(t *testing.T) {
+	for name, c := range map[string]struct {
+		current, target map[string]int32
+		churn           float64
+	}{
+		"unchanged":           {current: map[string]int32{"t1": 3, "t2": 3}, target: map[string]int32{"t1": 3, "t2": 3}},
+		"scaled out":          {current: map[string]int32{"t1": 3, "t2": 3}, target: map[string]int32{"t1": 5, "t2": 5}},
+		"scaled to 0":         {current: map[string]int32{"t1": 3, "t2": 3}, target: map[string]int32{"t1": 0, "t2": 0}},
+		"both empty":          {},
+		"rebalanced":          {current: map[string]int32{"t1": 6, "t2": 2}, target: map[string]int32{"t1": 4, "t2": 4}, churn: 0.25},
+		"scaled in and moved": {current: map[string]int32{"t1": 8, "t2": 2}, target: map[string]int32{"t1": 2, "t2": 3}, churn: 0.2},
+	} {
+		if churn := ChurnRatio(c.current, c.target); churn != c.churn {
+			t.Errorf("%s: expected churn ratio %v, got %v", name, c.churn, churn)
+		}
+	}
+}
+
+func TestChurnRatioOfSubsetRename(t *testing.T) {
+	for name, c := range map[string]struct {
+		current map[string]int32
+		subsets []appsv1alpha1.Subset
+		churn   float64
+	}{
+		"one of two subsets renamed": {
+			current: map[string]int32{"t1": 5, "t2": 5},
+			subsets: []appsv1alpha1.Subset{{Name: "t1-renamed"}, {Name: "t2"}},
+			churn:   0.5,
+		},
+		"the only subset renamed": {
+			current: map[string]int32{"t1": 10},
+			subsets: []appsv1alpha1.Subset{{Name: "t1-renamed"}},
+			churn:   1,
+		},
+		"subset added": {
+			current: map[string]int32{"t1": 10},
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}},
+			churn:   0.5,
+		},
+	} {
+		result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), createUnitedDeployment(10, c.subsets...))
+		if !result.Effective {
+			t.Fatalf("%s: unexpected ineffective allocation %+v", name, result)
+		}
+		if result.ChurnRatio != c.churn {
+			t.Errorf("%s: expected churn ratio %v, got %v with next replicas %v", name, c.churn, result.ChurnRatio, *result.SubsetReplicas)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+)
+
+// failureDomainOf returns the failure domain of the subset, which is the subset itself if it has none.
+func (s *replicasAllocator) failureDomainOf(subset *nameToReplicas) string {
+	if domain := s.failureDomains[subset.SubsetName]; domain != "" {
+		return domain
+	}
+	return subset.SubsetName
+}
+
+// spreadFailureDomains moves replicas one by one from the most crowded failure domains holding more than one replica
+// to the empty ones, until at least minDomains domains hold replicas. Only the unspecified subsets within their bounds
+// give or receive replicas. If there are fewer replicas or domains than minDomains, the replicas are spread across as
+// many domains as possible. It returns the reason if the replicas are not spread across minDomains domains.
+func (s *replicasAllocator) spreadFailureDomains(replicas int32) string {
+	domainReplicas := map[string]int32{}
+	for _, subset := range *s.subsets {
+		domainReplicas[s.failureDomainOf(subset)] += subset.Replicas
+	}
+
+	target, reason := int(*s.minDomains), ""
+	if len(domainReplicas) < target {
+		target, reason = len(domainReplicas), fmt.Sprintf("there are only %d failure domains", len(domainReplicas))
+	}
+	if int(replicas) < target {
+		target, reason = int(replicas), fmt.Sprintf("replicas (%d) are fewer than the min domains", replicas)
+	}
+
+	for s.ctx.Err() == nil {
+		var occupied int
+		for _, count := range domainReplicas {
+			if count > 0 {
+				occupied++
+			}
+		}
+		if occupied >= target {
+			return reason
+		}
+
+		var donor, receiver *nameToReplicas
+		for _, subset := range *s.subsets {
+			if subset.Specified {
+				continue
+			}
+
+			domain := s.failureDomainOf(subset)
+			if domainReplicas[domain] == 0 && receiver == nil {
+				if bound := subset.upperBound(); bound == nil || *bound > subset.Replicas {
+					receiver = subset
+				}
+			}
+			if domainReplicas[domain] > 1 && subset.Replicas > 0 && (subset.MinReplicas == nil || subset.Replicas > *subset.MinReplicas) {
+				if donor == nil || domainReplicas[domain] > domainReplicas[s.failureDomainOf(donor)] ||
+					domainReplicas[domain] == domainReplicas[s.failureDomainOf(donor)] && subset.Replicas > donor.Replicas {
+					donor = subset
+				}
+			}
+		}
+		if donor == nil || receiver == nil {
+			return fmt.Sprintf("only %d failure domains could hold replicas", occupied)
+		}
+
+		donor.Replicas--
+		domainReplicas[s.failureDomainOf(donor)]--
+		receiver.Replicas++
+		domainReplicas[s.failureDomainOf(receiver)]++
+	}
+	// the allocation is cancelled, and AllocateReplicas gives up on it
+	return reason
+}
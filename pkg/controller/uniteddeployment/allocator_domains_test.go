@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestMinDomains(t *testing.T) {
+	ud := createUnitedDeployment(3,
+		appsv1alpha1.Subset{Name: "t1", FailureDomain: "a"},
+		appsv1alpha1.Subset{Name: "t2", FailureDomain: "a"},
+		appsv1alpha1.Subset{Name: "t3", FailureDomain: "b"},
+		appsv1alpha1.Subset{Name: "t4", FailureDomain: "c"},
+	)
+	// the highest priority subset t1 takes all the replicas without the min domains
+	withProviders(t, AllocationProviders{
+		Priority: &fakeSchedulingPriorityProvider{priorities: map[string]int32{"t1": 10}},
+	})
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	for name, c := range map[string]struct {
+		replicas    int32
+		minDomains  *int32
+		expected    map[string]int32
+		unsatisfied bool
+	}{
+		"no min domains": {
+			replicas: 3,
+			expected: map[string]int32{"t1": 3, "t2": 0, "t3": 0, "t4": 0},
+		},
+		"min domains satisfied": {
+			replicas:   3,
+			minDomains: int32Ptr(3),
+			expected:   map[string]int32{"t1": 1, "t2": 0, "t3": 1, "t4": 1},
+		},
+		"replicas fewer than min domains": {
+			replicas:    2,
+			minDomains:  int32Ptr(3),
+			expected:    map[string]int32{"t1": 1, "t2": 0, "t3": 1, "t4": 0},
+			unsatisfied: true,
+		},
+		"domains fewer than min domains": {
+			replicas:    5,
+			minDomains:  int32Ptr(4),
+			expected:    map[string]int32{"t1": 3, "t2": 0, "t3": 1, "t4": 1},
+			unsatisfied: true,
+		},
+	} {
+		replicas := c.replicas
+		ud.Spec.Replicas = &replicas
+		ud.Spec.Topology.MinDomains = c.minDomains
+		next, allocation, err := allocateSubsetReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+		if unsatisfied := allocation.unsatisfiedDomainsReason != ""; unsatisfied != c.unsatisfied {
+			t.Fatalf("%s: expected unsatisfied %v, got reason %q", name, c.unsatisfied, allocation.unsatisfiedDomainsReason)
+		}
+	}
+}
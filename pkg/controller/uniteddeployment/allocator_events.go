@@ -0,0 +1,48 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+const eventTypeSubsetScaled = "SubsetScaled"
+
+// recordAllocationEvents emits a Normal event for each subset whose target replicas are changed from previous to
+// next, such as "subset=zone-a from=3 to=5", so that the allocation changes are traced on the UnitedDeployment.
+func (r *ReconcileUnitedDeployment) recordAllocationEvents(ud *appsv1alpha1.UnitedDeployment, previous, next map[string]int32) {
+	for _, change := range DiffAllocationChanges(previous, next) {
+		r.recorder.Eventf(ud.DeepCopy(), corev1.EventTypeNormal, eventTypeSubsetScaled, "subset=%s from=%d to=%d", change.Subset, change.From, change.To)
+	}
+}
+
+// recordIneffectiveAllocation emits a Warning event telling the reason code and message of the allocation which
+// can not satisfy the spec.
+func (r *ReconcileUnitedDeployment) recordIneffectiveAllocation(ud *appsv1alpha1.UnitedDeployment, err error) {
+	reason := allocationReasonOf(err)
+	if reason == AllSubsetsUnavailableAllocationReason {
+		r.recorder.Eventf(ud.DeepCopy(), corev1.EventTypeWarning, fmt.Sprintf("Failed %s", eventTypeSpecifySubbsetReplicas),
+			"Keep the current subset replicas (%s): %s", reason, err.Error())
+		return
+	}
+	r.recorder.Eventf(ud.DeepCopy(), corev1.EventTypeWarning, fmt.Sprintf("Failed %s", eventTypeSpecifySubbsetReplicas),
+		"Specified subset replicas is ineffective (%s): %s", reason, err.Error())
+}
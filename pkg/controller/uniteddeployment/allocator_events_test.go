@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestRecordAllocationEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileUnitedDeployment{recorder: recorder}
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "zone-a"}, appsv1alpha1.Subset{Name: "zone-b"}, appsv1alpha1.Subset{Name: "zone-c"})
+
+	r.recordAllocationEvents(ud, map[string]int32{"zone-a": 3, "zone-b": 5, "zone-c": 2}, map[string]int32{"zone-a": 5, "zone-b": 5, "zone-d": 1})
+	r.recordAllocationEvents(ud, map[string]int32{"zone-a": 5}, map[string]int32{"zone-a": 5})
+	expected := []string{
+		"Normal SubsetScaled subset=zone-a from=3 to=5",
+		"Normal SubsetScaled subset=zone-c from=2 to=0",
+		"Normal SubsetScaled subset=zone-d from=0 to=1",
+	}
+	if events := drainEvents(recorder); !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+
+	r.recordIneffectiveAllocation(ud, newAllocationError(OverSpecifiedAllocationReason, "too many"))
+	r.recordIneffectiveAllocation(ud, errAllSubsetsUnavailable)
+	r.recordIneffectiveAllocation(ud, fmt.Errorf("unknown"))
+	expected = []string{
+		"Warning Failed SpecifySubsetReplicas Specified subset replicas is ineffective (OverSpecified): too many",
+		"Warning Failed SpecifySubsetReplicas Keep the current subset replicas (AllSubsetsUnavailable): " + errAllSubsetsUnavailable.Error(),
+		"Warning Failed SpecifySubsetReplicas Specified subset replicas is ineffective (Unknown): unknown",
+	}
+	if events := drainEvents(recorder); !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+}
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// ParseFrozenSubsets parses the names of the subsets frozen by the AnnotationFrozenSubsets annotation of the
+// UnitedDeployment, in the order of the annotation. It returns an error if the annotation freezes unknown subsets.
+func ParseFrozenSubsets(ud *appsv1alpha1.UnitedDeployment) ([]string, error) {
+	value := ud.Annotations[appsv1alpha1.AnnotationFrozenSubsets]
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	known := sets.NewString()
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		known.Insert(subsetDef.Name)
+	}
+	frozen := sets.NewString()
+	var names, unknown []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" || frozen.Has(name) {
+			continue
+		}
+		frozen.Insert(name)
+		names = append(names, name)
+		if !known.Has(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, newAllocationError(UnknownSubsetAllocationReason, "annotation %s freezes subsets %v which are not in the topology",
+			appsv1alpha1.AnnotationFrozenSubsets, unknown)
+	}
+
+	return names, nil
+}
+
+// validateFrozenSubsets checks that the subsets which are not frozen could still take the rest of the replicas,
+// so that freezing subsets does not make the allocation ineffective. The specified replicas are left to
+// validateReplicas if no subset is frozen.
+func validateFrozenSubsets(ud *appsv1alpha1.UnitedDeployment, replicas int32, specifiedReplicas *map[string]int32) error {
+	frozen, err := ParseFrozenSubsets(ud)
+	if err != nil || len(frozen) == 0 || isBestEffortSchedule(ud) {
+		return err
+	}
+
+	// sum up in int64, since the specified replicas of many subsets could overflow int32
+	var specified int64
+	for _, subsetReplicas := range *specifiedReplicas {
+		specified += int64(subsetReplicas)
+	}
+	if specified > int64(replicas) {
+		return newAllocationError(FrozenSubsetsAllocationReason, "subsets %v are frozen, but the specified replicas (%d) are greater than UnitedDeployment replicas (%d)",
+			frozen, specified, replicas)
+	}
+	if specified < int64(replicas) && len(*specifiedReplicas) >= len(ud.Spec.Topology.Subsets) {
+		return newAllocationError(FrozenSubsetsAllocationReason, "subsets %v are frozen, and no other subset could take %d of UnitedDeployment replicas (%d)",
+			frozen, int64(replicas)-specified, replicas)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestFrozenSubsets(t *testing.T) {
+	for name, c := range map[string]struct {
+		replicas int32
+		frozen   string
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		"scale out without frozen subsets": {
+			replicas: 12,
+			expected: map[string]int32{"t1": 4, "t2": 4, "t3": 4},
+		},
+		"scale out with one frozen": {
+			replicas: 12,
+			frozen:   "t2",
+			expected: map[string]int32{"t1": 4, "t2": 3, "t3": 5},
+		},
+		"scale in with one frozen": {
+			replicas: 5,
+			frozen:   " t2 ,",
+			expected: map[string]int32{"t1": 1, "t2": 3, "t3": 1},
+		},
+		"all frozen without a scale change": {
+			replicas: 9,
+			frozen:   "t1,t2,t3",
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 3},
+		},
+		"all frozen during a scale change": {
+			replicas: 12,
+			frozen:   "t1,t2,t3",
+			reason:   FrozenSubsetsAllocationReason,
+		},
+		"frozen replicas greater than the total": {
+			replicas: 5,
+			frozen:   "t1,t2",
+			reason:   FrozenSubsetsAllocationReason,
+		},
+		"unknown frozen subset": {
+			replicas: 12,
+			frozen:   "t2,t4",
+			reason:   UnknownSubsetAllocationReason,
+		},
+	} {
+		ud := createUnitedDeployment(c.replicas, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Annotations = map[string]string{appsv1alpha1.AnnotationFrozenSubsets: c.frozen}
+		ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 3}
+		result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{"t1": 3, "t2": 3, "t3": 3}), ud)
+		if result.ReasonCode != c.reason {
+			t.Fatalf("%s: expected reason %q, got %+v", name, c.reason, result)
+		}
+		if c.reason == "" && !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *result.SubsetReplicas)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// getGroupSpecifiedReplicas splits the replicas of each group in Topology.GroupReplicas, or taken by its percentage in
+// Topology.GroupPercentages out of replicas, among its member subsets, and returns the specified replicas of subsets
+// together with the ones split from the groups. The replicas left by the specified members of a group are averaged
+// among its other members within their upper bounds.
+func getGroupSpecifiedReplicas(ud *appsv1alpha1.UnitedDeployment, infos *subsetInfos, replicas int32, specifiedReplicas *map[string]int32) (*map[string]int32, error) {
+	groupReplicas := getGroupReplicas(ud, replicas)
+	if len(groupReplicas) == 0 {
+		return specifiedReplicas, nil
+	}
+
+	groupMembers := map[string][]*nameToReplicas{}
+	for idx, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Group != "" {
+			groupMembers[subsetDef.Group] = append(groupMembers[subsetDef.Group], (*infos)[idx])
+		}
+	}
+
+	groups := make([]string, 0, len(groupReplicas))
+	for group := range groupReplicas {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	expanded := make(map[string]int32, len(*specifiedReplicas))
+	for name, replicas := range *specifiedReplicas {
+		expanded[name] = replicas
+	}
+	for _, group := range groups {
+		members, exist := groupMembers[group]
+		if !exist {
+			return nil, newAllocationError(UnknownSubsetAllocationReason, "replicas are indicated for group %s which no subset belongs to", group)
+		}
+
+		left := groupReplicas[group]
+		var unspecified []*nameToReplicas
+		for _, member := range members {
+			if replicas, exist := expanded[member.SubsetName]; exist {
+				left -= replicas
+				continue
+			}
+			// split the replicas on a copy of the member, leaving the subset infos for the allocation as they are
+			clone := *member
+			unspecified = append(unspecified, &clone)
+		}
+		if left < 0 {
+			return nil, newAllocationError(OverSpecifiedAllocationReason, "specified replicas of the subsets in group %s are greater than its replicas (%d)",
+				group, groupReplicas[group])
+		}
+		if len(unspecified) == 0 {
+			if left > 0 {
+				return nil, newAllocationError(UnderSpecifiedAllocationReason, "specified replicas of the subsets in group %s are less than its replicas (%d)",
+					group, groupReplicas[group])
+			}
+			continue
+		}
+
+		sort.Sort(subsetSorter{subsetInfos: unspecified, less: defaultSubsetComparator})
+		if unallocated, _ := allocateAverage(unspecified, left); unallocated > 0 {
+			return nil, newAllocationError(AllCappedAllocationReason, "%d of the replicas (%d) of group %s can not be allocated, since its subsets have reached their max replicas",
+				unallocated, groupReplicas[group], group)
+		}
+		for _, member := range unspecified {
+			expanded[member.SubsetName] = member.Replicas
+		}
+	}
+
+	return &expanded, nil
+}
+
+// getGroupReplicas returns Topology.GroupReplicas if indicated, or the replicas of each group in
+// Topology.GroupPercentages out of replicas, which are rounded by the largest remainder to sum to replicas.
+func getGroupReplicas(ud *appsv1alpha1.UnitedDeployment, replicas int32) map[string]int32 {
+	percentages := ud.Spec.Topology.GroupPercentages
+	if len(ud.Spec.Topology.GroupReplicas) > 0 || len(percentages) == 0 {
+		return ud.Spec.Topology.GroupReplicas
+	}
+
+	groups := make([]string, 0, len(percentages))
+	for group := range percentages {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	pending := make([]int, len(groups))
+	weights := make([]float64, len(groups))
+	for i, group := range groups {
+		pending[i] = i
+		weights[i] = float64(percentages[group])
+	}
+	shares, _ := weightedShares(replicas, pending, weights)
+
+	groupReplicas := make(map[string]int32, len(groups))
+	for i, group := range groups {
+		groupReplicas[group] = shares[i]
+	}
+	return groupReplicas
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestGroupReplicas(t *testing.T) {
+	two := intstr.FromInt(2)
+	cases := []struct {
+		name          string
+		replicas      int32
+		groupReplicas map[string]int32
+		z1Replicas    *intstr.IntOrString
+		expected      map[string]int32
+		reason        AllocationReasonCode
+	}{
+		{
+			name:          "group replicas are split evenly within the group",
+			replicas:      10,
+			groupReplicas: map[string]int32{"r1": 6},
+			expected:      map[string]int32{"z1": 3, "z2": 3, "z3": 2, "z4": 2},
+		},
+		{
+			name:          "replicas of every group are specified",
+			replicas:      10,
+			groupReplicas: map[string]int32{"r1": 7, "r2": 3},
+			expected:      map[string]int32{"z1": 3, "z2": 4, "z3": 1, "z4": 2},
+		},
+		{
+			name:          "specified member takes its replicas out of the group",
+			replicas:      10,
+			groupReplicas: map[string]int32{"r1": 6},
+			z1Replicas:    &two,
+			expected:      map[string]int32{"z1": 2, "z2": 4, "z3": 2, "z4": 2},
+		},
+		{
+			name:          "replicas of unknown group",
+			replicas:      10,
+			groupReplicas: map[string]int32{"r3": 6},
+			reason:        UnknownSubsetAllocationReason,
+		},
+		{
+			name:          "specified member exceeds the group",
+			replicas:      10,
+			groupReplicas: map[string]int32{"r1": 1},
+			z1Replicas:    &two,
+			reason:        OverSpecifiedAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas,
+				appsv1alpha1.Subset{Name: "z1", Group: "r1", Replicas: c.z1Replicas},
+				appsv1alpha1.Subset{Name: "z2", Group: "r1"},
+				appsv1alpha1.Subset{Name: "z3", Group: "r2"},
+				appsv1alpha1.Subset{Name: "z4", Group: "r2"},
+			)
+			ud.Spec.Topology.GroupReplicas = c.groupReplicas
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if c.reason != "" {
+				if reason := allocationReasonOf(err); reason != c.reason {
+					t.Fatalf("expected reason %s, got %s (%v)", c.reason, reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(*next, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *next)
+			}
+		})
+	}
+}
+
+func TestGroupPercentages(t *testing.T) {
+	cases := []struct {
+		name          string
+		replicas      int32
+		groupReplicas map[string]int32
+		expected      map[string]int32
+	}{
+		{
+			name:     "70% on two spot subsets and 30% on one on-demand subset",
+			replicas: 10,
+			expected: map[string]int32{"spot-a": 3, "spot-b": 4, "on-demand": 3},
+		},
+		{
+			name:     "replicas of the groups are rounded by the largest remainder",
+			replicas: 7,
+			expected: map[string]int32{"spot-a": 2, "spot-b": 3, "on-demand": 2},
+		},
+		{
+			name:          "group replicas take precedence",
+			replicas:      10,
+			groupReplicas: map[string]int32{"spot": 4, "on-demand": 6},
+			expected:      map[string]int32{"spot-a": 2, "spot-b": 2, "on-demand": 6},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas,
+				appsv1alpha1.Subset{Name: "spot-a", Group: "spot"},
+				appsv1alpha1.Subset{Name: "spot-b", Group: "spot"},
+				appsv1alpha1.Subset{Name: "on-demand", Group: "on-demand"},
+			)
+			ud.Spec.Topology.GroupPercentages = map[string]int32{"spot": 70, "on-demand": 30}
+			ud.Spec.Topology.GroupReplicas = c.groupReplicas
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(*next, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *next)
+			}
+		})
+	}
+}
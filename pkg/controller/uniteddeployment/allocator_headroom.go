@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// isBursting returns true if the AnnotationBurst annotation asks to fill the headroom of the UnitedDeployment.
+func isBursting(ud *appsv1alpha1.UnitedDeployment) bool {
+	return ud.Annotations[appsv1alpha1.AnnotationBurst] == "true"
+}
+
+// reserveHeadroom returns the replicas to allocate after leaving headroomPercent of replicas unallocated, together
+// with the reserved replicas. The headroom is reduced so as not to take the replicas specified for subsets.
+func (s *replicasAllocator) reserveHeadroom(replicas int32, specifiedSubsetReplicas *map[string]int32) (int32, int32) {
+	if s.headroomPercent <= 0 || replicas <= 0 {
+		return replicas, 0
+	}
+
+	reserved := int64(replicas) * int64(s.headroomPercent) / 100
+	if specifiedSubsetReplicas != nil {
+		// sum up in int64, since the specified replicas of many subsets could overflow int32
+		var specified int64
+		for _, subsetReplicas := range *specifiedSubsetReplicas {
+			specified += int64(subsetReplicas)
+		}
+		if left := int64(replicas) - specified; reserved > left {
+			reserved = left
+		}
+	}
+	if reserved <= 0 {
+		return replicas, 0
+	}
+	return replicas - int32(reserved), int32(reserved)
+}
+
+// explainHeadroom appends the reserved headroom to the rationale of the unspecified subsets, whose replicas are
+// taken from the replicas left by the headroom. It does nothing if no headroom is reserved or the rationale is nil.
+func (s *replicasAllocator) explainHeadroom(reserved int32, specifiedSubsetReplicas *map[string]int32) {
+	if s.rationale == nil || reserved == 0 {
+		return
+	}
+
+	for _, subset := range *s.subsets {
+		if specifiedSubsetReplicas != nil {
+			if _, exist := (*specifiedSubsetReplicas)[subset.SubsetName]; exist {
+				continue
+			}
+		}
+		if s.rationale[subset.SubsetName] == "" {
+			s.rationale[subset.SubsetName] = fmt.Sprintf("headroom reserved=%d", reserved)
+		} else {
+			s.rationale[subset.SubsetName] = fmt.Sprintf("%s, headroom reserved=%d", s.rationale[subset.SubsetName], reserved)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestHeadroom(t *testing.T) {
+	eighteen := intstr.FromInt(18)
+	cases := []struct {
+		name     string
+		replicas int32
+		headroom *int32
+		burst    bool
+		subsets  []appsv1alpha1.Subset
+		expected map[string]int32
+		sum      int32
+	}{
+		{
+			name:     "headroom is left unallocated",
+			replicas: 20,
+			headroom: int32Ptr(10),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 6, "t2": 6, "t3": 6},
+			sum:      18,
+		},
+		{
+			name:     "reserved replicas are rounded down",
+			replicas: 25,
+			headroom: int32Ptr(10),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 7, "t2": 8, "t3": 8},
+			sum:      23,
+		},
+		{
+			name:     "headroom is filled while bursting",
+			replicas: 20,
+			headroom: int32Ptr(10),
+			burst:    true,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}},
+			expected: map[string]int32{"t1": 10, "t2": 10},
+			sum:      20,
+		},
+		{
+			name:     "headroom does not take specified replicas",
+			replicas: 20,
+			headroom: int32Ptr(50),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &eighteen}, {Name: "t2"}},
+			expected: map[string]int32{"t1": 18, "t2": 0},
+			sum:      18,
+		},
+		{
+			name:     "no headroom",
+			replicas: 20,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}},
+			expected: map[string]int32{"t1": 10, "t2": 10},
+			sum:      20,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			ud.Spec.Topology.HeadroomPercent = c.headroom
+			if c.burst {
+				ud.Annotations = map[string]string{appsv1alpha1.AnnotationBurst: "true"}
+			}
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(*next, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *next)
+			}
+
+			var sum int32
+			for _, replicas := range *next {
+				sum += replicas
+			}
+			if sum != c.sum {
+				t.Fatalf("expected allocated sum %d, got %d", c.sum, sum)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// keepHighWaterMarks raises the min replicas of the unspecified subsets to their high-water marks recorded in
+// Status.SubsetHighWaterMarks within their upper bounds, if Topology.PreventScaleInBelowHighWaterMark is enabled.
+// Like protected subsets, the incremental allocation falls back to the full one if it would shrink a subset below
+// its floor.
+func keepHighWaterMarks(ud *appsv1alpha1.UnitedDeployment, infos *subsetInfos, specifiedReplicas *map[string]int32) {
+	if !ud.Spec.Topology.PreventScaleInBelowHighWaterMark {
+		return
+	}
+
+	for _, subset := range *infos {
+		floor, exist := ud.Status.SubsetHighWaterMarks[subset.SubsetName]
+		if !exist {
+			continue
+		}
+		if _, exist := (*specifiedReplicas)[subset.SubsetName]; exist {
+			continue
+		}
+		if bound := subset.upperBound(); bound != nil && *bound < floor {
+			floor = *bound
+		}
+		if subset.MinReplicas == nil || *subset.MinReplicas < floor {
+			subset.MinReplicas = &floor
+		}
+	}
+}
+
+// getSubsetHighWaterMarks returns the high-water marks of the subsets in the topology raised by their next replicas,
+// which are recorded in Status.SubsetHighWaterMarks once the subsets are scaled. It returns nil if
+// Topology.PreventScaleInBelowHighWaterMark is disabled, so that the marks are dropped.
+func getSubsetHighWaterMarks(ud *appsv1alpha1.UnitedDeployment, nextReplicas map[string]int32) map[string]int32 {
+	if !ud.Spec.Topology.PreventScaleInBelowHighWaterMark {
+		return nil
+	}
+
+	marks := map[string]int32{}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		mark := ud.Status.SubsetHighWaterMarks[subsetDef.Name]
+		if replicas := nextReplicas[subsetDef.Name]; replicas > mark {
+			mark = replicas
+		}
+		if mark > 0 {
+			marks[subsetDef.Name] = mark
+		}
+	}
+	return marks
+}
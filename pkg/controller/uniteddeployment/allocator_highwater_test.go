@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestPreventScaleInBelowHighWaterMark(t *testing.T) {
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Spec.Topology.PreventScaleInBelowHighWaterMark = true
+
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 4, "t2": 4, "t3": 4}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	ud.Status.SubsetHighWaterMarks = getSubsetHighWaterMarks(ud, *next)
+	if !reflect.DeepEqual(ud.Status.SubsetHighWaterMarks, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("the high-water marks should be raised to the peak, got %v", ud.Status.SubsetHighWaterMarks)
+	}
+
+	// the subsets at their peaks refuse to shrink
+	ud.Spec.Replicas = int32Ptr(9)
+	result := GetAllocationResult(context.TODO(), createNameToSubset(*next), ud)
+	if result.Effective || result.ReasonCode != ProtectedSubsetsAllocationReason {
+		t.Fatalf("expected the scale-in below the high-water marks to be rejected, got %v", result)
+	}
+
+	// only the subset at its peak is kept, and the others take the scale-in
+	ud.Status.SubsetHighWaterMarks = map[string]int32{"t1": 6, "t2": 2, "t3": 1}
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 6, "t2": 3, "t3": 3}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 6, "t2": 2, "t3": 1}) {
+		t.Fatalf("the subsets should be kept at their high-water marks, got %v", *next)
+	}
+	if marks := getSubsetHighWaterMarks(ud, map[string]int32{"t1": 3, "t2": 5, "t3": 1}); !reflect.DeepEqual(marks, map[string]int32{"t1": 6, "t2": 5, "t3": 1}) {
+		t.Fatalf("the high-water marks should never go down, got %v", marks)
+	}
+
+	ud.Spec.Topology.PreventScaleInBelowHighWaterMark = false
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 6, "t2": 3, "t3": 3}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 3}) {
+		t.Fatalf("the high-water marks should be ignored once disabled, got %v", *next)
+	}
+	if marks := getSubsetHighWaterMarks(ud, *next); marks != nil {
+		t.Fatalf("the high-water marks should be dropped once disabled, got %v", marks)
+	}
+}
+
+func TestAllocateIncrementallyBelowHighWaterMark(t *testing.T) {
+	origin := incrementalAllocation
+	incrementalAllocation = true
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Spec.Topology.PreventScaleInBelowHighWaterMark = true
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 4}
+	ud.Status.SubsetHighWaterMarks = map[string]int32{"t1": 7, "t2": 3, "t3": 4}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 7, "t2": 3, "t3": 4})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err == nil {
+		t.Fatalf("expected the subsets at their high-water marks to refuse the scale-in, got %v", *next)
+	}
+
+	ud.Status.SubsetHighWaterMarks = map[string]int32{"t1": 7}
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if (*next)["t1"] != 7 || (*next)["t2"]+(*next)["t3"] != 3 {
+		t.Fatalf("the drifted subset should be kept at its high-water mark, and the others shrunk, got %v", *next)
+	}
+}
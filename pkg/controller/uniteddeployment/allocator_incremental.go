@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"sort"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// incrementalAllocation indicates whether to adjust only the drifted subset from the last allocated replicas,
+// instead of recomputing the allocation of all subsets, when the replicas of one subset drifted from it.
+var incrementalAllocation = false
+
+// allocateIncrementally returns the last allocated replicas recorded in Status.SubsetReplicas with the minimal
+// adjustment for the only subset whose current replicas drifted from them. It returns nil if the allocation should
+// be recomputed, which is the case if the UnitedDeployment changed since the last allocation, no subset or more
+// than one subset drifted, or the last allocated replicas do not fit the max replicas of subsets any more, or
+// would shrink a protected subset below its current replicas. It only replaces the built-in allocation, and the
+// result is smoothed, limited, deferred and reviewed like the one of the built-in allocation.
+func allocateIncrementally(ctx context.Context, ud *appsv1alpha1.UnitedDeployment, infos *subsetInfos, specifiedReplicas *map[string]int32) *map[string]int32 {
+	prior := ud.Status.SubsetReplicas
+	if !incrementalAllocation || len(prior) != len(*infos) || len(ud.Status.SubsetRamps) > 0 ||
+		ud.Generation != ud.Status.ObservedGeneration || isRebalanceRequested(ud) {
+		return nil
+	}
+
+	var sum int64
+	var changed *nameToReplicas
+	for _, subset := range *infos {
+		replicas, exist := prior[subset.SubsetName]
+		if !exist {
+			return nil
+		}
+		if specified, exist := (*specifiedReplicas)[subset.SubsetName]; exist && specified != replicas {
+			return nil
+		}
+		if subset.Replicas != replicas {
+			if changed != nil {
+				return nil
+			}
+			changed = subset
+		}
+		sum += int64(replicas)
+	}
+	if changed == nil || sum != int64(getStabilizedReplicas(ud)) {
+		return nil
+	}
+
+	next := map[string]int32{}
+	var others []*nameToReplicas
+	for _, subset := range *infos {
+		next[subset.SubsetName] = prior[subset.SubsetName]
+		if subset.MinReplicas != nil && next[subset.SubsetName] < *subset.MinReplicas {
+			return nil
+		}
+		if subset == changed {
+			continue
+		}
+		if bound := subset.upperBound(); bound != nil && next[subset.SubsetName] > *bound {
+			return nil
+		}
+		if _, exist := (*specifiedReplicas)[subset.SubsetName]; !exist {
+			others = append(others, subset)
+		}
+	}
+
+	bound := changed.upperBound()
+	if bound == nil || next[changed.SubsetName] <= *bound {
+		return &next
+	}
+	if _, exist := (*specifiedReplicas)[changed.SubsetName]; exist {
+		return nil
+	}
+
+	// move the excess of the drifted subset to the others one by one, each time to the one with the fewest
+	// replicas and then by name, and to the standby subsets only if the others are full
+	priorities := getSubsetPriorities(ctx, ud)
+	excess := next[changed.SubsetName] - *bound
+	next[changed.SubsetName] = *bound
+	for ; excess > 0; excess-- {
+		sort.Slice(others, func(i, j int) bool {
+			iStandby, jStandby := isStandbyPriority(priorities[others[i].SubsetName]), isStandbyPriority(priorities[others[j].SubsetName])
+			if iStandby != jStandby {
+				return jStandby
+			}
+			if iStandby && priorities[others[i].SubsetName] != priorities[others[j].SubsetName] {
+				return priorities[others[i].SubsetName] > priorities[others[j].SubsetName]
+			}
+			if next[others[i].SubsetName] != next[others[j].SubsetName] {
+				return next[others[i].SubsetName] < next[others[j].SubsetName]
+			}
+			return lessBySubsetName(others[i], others[j])
+		})
+		moved := false
+		for _, subset := range others {
+			if bound := subset.upperBound(); bound == nil || next[subset.SubsetName] < *bound {
+				next[subset.SubsetName]++
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			return nil
+		}
+	}
+
+	return &next
+}
+
+// scaleOutIncrementally rebases a scale-out planned by the preferred weights on the current replicas of subsets,
+// so that no subset is scaled in to reach the weighted target. The replicas added to the unspecified subsets are
+// split only among the ones below their weighted targets, in proportion to how far below they are. The specified
+// subsets take their targets as they are. It returns nil if the target is kept, which is the case if the incremental
+// allocation is disabled, no preferred weights are indicated, the unspecified subsets do not grow in total, some
+// of them are out of their bounds, or the target is shaped by MaxSkew, MinDomains or MinNonEmptySubsets which the
+// rebased replicas could violate.
+func scaleOutIncrementally(ud *appsv1alpha1.UnitedDeployment, infos *subsetInfos, specifiedReplicas, target *map[string]int32) *map[string]int32 {
+	topology := &ud.Spec.Topology
+	if !incrementalAllocation || len(topology.PreferredWeights) == 0 || len(ud.Status.SubsetRamps) > 0 || isRebalanceRequested(ud) ||
+		topology.MaxSkew != nil || topology.MinDomains != nil || topology.MinNonEmptySubsets != nil {
+		return nil
+	}
+
+	next := map[string]int32{}
+	var added int64
+	var below []*nameToReplicas
+	var deficits []float64
+	for _, subset := range *infos {
+		if _, exist := (*specifiedReplicas)[subset.SubsetName]; exist {
+			next[subset.SubsetName] = (*target)[subset.SubsetName]
+			continue
+		}
+		if bound := subset.upperBound(); bound != nil && subset.Replicas > *bound {
+			return nil
+		}
+		if subset.MinReplicas != nil && subset.Replicas < *subset.MinReplicas {
+			return nil
+		}
+
+		next[subset.SubsetName] = subset.Replicas
+		added += int64((*target)[subset.SubsetName]) - int64(subset.Replicas)
+		if deficit := (*target)[subset.SubsetName] - subset.Replicas; deficit > 0 {
+			below = append(below, subset)
+			deficits = append(deficits, float64(deficit))
+		}
+	}
+	if added <= 0 {
+		return nil
+	}
+
+	// the deficits sum up to at least the added replicas, so no share exceeds the deficit and thus the target
+	pending := make([]int, len(below))
+	for i := range pending {
+		pending[i] = i
+	}
+	shares, _ := weightedShares(int32(added), pending, deficits)
+	for i, subset := range below {
+		next[subset.SubsetName] += shares[i]
+	}
+	return &next
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestAllocateIncrementally(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 4}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 7, "t2": 3, "t3": 4})
+
+	incrementalAllocation = false
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 3, "t3": 3}) {
+		t.Fatalf("recomputing should move the remainder to the drifted subset, got %v", *next)
+	}
+
+	incrementalAllocation = true
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 4}) {
+		t.Fatalf("only the drifted subset should be adjusted, got %v", *next)
+	}
+
+	ud.Generation = 2
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 3, "t3": 3}) {
+		t.Fatalf("the allocation should be recomputed once the UnitedDeployment changed, got %v", *next)
+	}
+}
+
+func TestAllocateIncrementallyOverMaxReplicas(t *testing.T) {
+	origin := incrementalAllocation
+	incrementalAllocation = true
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 4, "t2": 4, "t3": 4}
+	infos := subsetInfos{createSubset("t1", 2), createSubset("t2", 4), createSubset("t3", 4)}
+	bound := int32(1)
+	infos[0].MaxReplicas = &bound
+
+	next := allocateIncrementally(context.TODO(), ud, &infos, &map[string]int32{})
+	if next == nil || !reflect.DeepEqual(*next, map[string]int32{"t1": 1, "t2": 6, "t3": 5}) {
+		t.Fatalf("the excess of the drifted subset should be moved to the others, got %v", next)
+	}
+}
+
+func TestAllocateIncrementallyProtectedSubset(t *testing.T) {
+	origin := incrementalAllocation
+	incrementalAllocation = true
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", Protected: true},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 4}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 7, "t2": 3, "t3": 4})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if (*next)["t1"] != 7 || (*next)["t2"]+(*next)["t3"] != 3 {
+		t.Fatalf("the drifted protected subset should be kept, and the others shrunk, got %v", *next)
+	}
+}
+
+func TestAllocateIncrementallyDampedAndReviewed(t *testing.T) {
+	origin := incrementalAllocation
+	incrementalAllocation = true
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	limit := int32(10)
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", Protected: true},
+		appsv1alpha1.Subset{Name: "t2", MaxScaleInPercent: &limit},
+		appsv1alpha1.Subset{Name: "t3", MaxScaleInPercent: &limit},
+	)
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "t3": 4}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 7, "t2": 3, "t3": 4})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if (*next)["t2"] < 2 || (*next)["t3"] < 3 {
+		t.Fatalf("the subsets shrunk for the drifted subset should lose at most one replica each, got %v", *next)
+	}
+
+	url, _ := serveFakeAllocationReviewer(t, &AllocationReviewResponse{Allowed: false, Reason: "quota exceeded"}, 0)
+	withProviders(t, AllocationProviders{Reviewer: NewHTTPAllocationReviewer(url)})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 7, "t2": 3, "t3": 4}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("the rejected incremental allocation should keep the current replicas %v, got %v", expected, *next)
+	}
+}
+
+func TestUnschedulableSubset(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+	incrementalAllocation = true
+
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 3, "t2": 3, "t3": 3})
+	(*nameToSubset)["t1"].Status.Unschedulable = true
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 3, "t2": 4, "t3": 5}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("the unschedulable subset should be held, expected %v, got %v", expected, *next)
+	}
+
+	// the subset recovers after the allocation is applied
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = *next
+	nameToSubset = createNameToSubset(*next)
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 4, "t2": 4, "t3": 4}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("the recovered subset should be rebalanced, expected %v, got %v", expected, *next)
+	}
+}
+
+// randomAllocationInput returns a UnitedDeployment and the current replicas of its subsets generated by r, where
+// the subsets are often tied by their current replicas, and the last allocation differs from them in one subset.
+func randomAllocationInput(r *rand.Rand) (*appsv1alpha1.UnitedDeployment, map[string]int32) {
+	count := 2 + r.Intn(5)
+	replicas := int32(r.Intn(30))
+	var subsets []appsv1alpha1.Subset
+	current := map[string]int32{}
+	prior := map[string]int32{}
+	for i := 0; i < count; i++ {
+		subset := appsv1alpha1.Subset{Name: fmt.Sprintf("t%d", i)}
+		if r.Intn(4) == 0 {
+			maxReplicas := int32(r.Intn(10))
+			subset.MaxReplicas = &maxReplicas
+		}
+		if r.Intn(6) == 0 {
+			specified := intstr.FromInt(r.Intn(3))
+			subset.Replicas = &specified
+		}
+		subsets = append(subsets, subset)
+		current[subset.Name] = int32(r.Intn(3))
+		prior[subset.Name] = current[subset.Name]
+	}
+	prior[subsets[r.Intn(count)].Name] += int32(r.Intn(3))
+	// keep the replicas of the last allocation half of the time, so that the incremental path is taken
+	if r.Intn(2) == 0 {
+		replicas = 0
+		for _, priorReplicas := range prior {
+			replicas += priorReplicas
+		}
+	}
+
+	ud := createUnitedDeployment(replicas, subsets...)
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = prior
+	return ud, current
+}
+
+func TestAllocationDeterminism(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	for seed := int64(0); seed < 500; seed++ {
+		ud, current := randomAllocationInput(rand.New(rand.NewSource(seed)))
+		for _, incremental := range []bool{false, true} {
+			incrementalAllocation = incremental
+
+			var expected *map[string]int32
+			var expectedErr error
+			for i := 0; i < 5; i++ {
+				// rebuild the subsets each time, so that the iteration order of maps differs between runs
+				next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(current), ud.DeepCopy())
+				if i == 0 {
+					expected, expectedErr = next, err
+					continue
+				}
+				if fmt.Sprint(err) != fmt.Sprint(expectedErr) || (next == nil) != (expected == nil) ||
+					next != nil && !reflect.DeepEqual(*next, *expected) {
+					t.Fatalf("seed %d incremental %v: allocation of %v is not deterministic", seed, incremental, current)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+var (
+	allocatedReplicasMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kruise_uniteddeployment_allocated_replicas",
+			Help: "Gauge the replicas allocated to each subset of UnitedDeployment",
+		},
+		[]string{"namespace", "name", "subset"},
+	)
+	ineffectiveAllocationsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kruise_uniteddeployment_ineffective_allocations_total",
+			Help: "Count the allocations of UnitedDeployment which could not be done as specified",
+		},
+		[]string{"namespace", "name", "reason"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(allocatedReplicasMetric, ineffectiveAllocationsMetric)
+}
+
+// recordAllocationMetrics records the result of an allocation of the UnitedDeployment.
+func recordAllocationMetrics(ud *appsv1alpha1.UnitedDeployment, result *AllocationResult) {
+	if !result.Effective {
+		ineffectiveAllocationsMetric.WithLabelValues(ud.Namespace, ud.Name, string(result.ReasonCode)).Inc()
+	}
+	if result.SubsetReplicas == nil {
+		return
+	}
+	for subset, replicas := range *result.SubsetReplicas {
+		allocatedReplicasMetric.WithLabelValues(ud.Namespace, ud.Name, subset).Set(float64(replicas))
+	}
+}
+
+// deleteAllocationMetrics removes the allocated replicas of the subsets which are no longer in the UnitedDeployment.
+func deleteAllocationMetrics(ud *appsv1alpha1.UnitedDeployment, subsets []string) {
+	for _, subset := range subsets {
+		allocatedReplicasMetric.DeleteLabelValues(ud.Namespace, ud.Name, subset)
+	}
+}
+
+// deleteUnitedDeploymentMetrics removes all the metrics of the UnitedDeployment once it is deleted.
+func deleteUnitedDeploymentMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	deletePartialMatch(allocatedReplicasMetric.MetricVec, labels)
+	deletePartialMatch(ineffectiveAllocationsMetric.MetricVec, labels)
+}
+
+// deletePartialMatch deletes the metrics of vec whose labels contain all the given labels, like the
+// DeletePartialMatch of MetricVec in later versions of client_golang.
+func deletePartialMatch(vec *prometheus.MetricVec, labels prometheus.Labels) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+
+	var matched []prometheus.Labels
+	for metric := range ch {
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			continue
+		}
+		metricLabels := prometheus.Labels{}
+		for _, pair := range m.GetLabel() {
+			metricLabels[pair.GetName()] = pair.GetValue()
+		}
+		if containsLabels(metricLabels, labels) {
+			matched = append(matched, metricLabels)
+		}
+	}
+	// metrics can only be deleted after the collection, which holds the lock of vec
+	for _, metricLabels := range matched {
+		vec.Delete(metricLabels)
+	}
+}
+
+func containsLabels(metricLabels, labels prometheus.Labels) bool {
+	for name, value := range labels {
+		if metricLabels[name] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestAllocationMetrics(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Name = "metrics"
+	recordAllocationMetrics(ud, GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud))
+	if value, _ := gatherMetric(t, "kruise_uniteddeployment_allocated_replicas", "metrics", "subset", "t1"); value != 5 {
+		t.Fatalf("expected 5 replicas allocated to t1, got %v", value)
+	}
+
+	over := intstr.FromInt(11)
+	ud.Spec.Topology.Subsets[0].Replicas = &over
+	for i := 0; i < 2; i++ {
+		recordAllocationMetrics(ud, GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud))
+	}
+	if value, _ := gatherMetric(t, "kruise_uniteddeployment_ineffective_allocations_total", "metrics", "reason", string(OverSpecifiedAllocationReason)); value != 2 {
+		t.Fatalf("expected 2 ineffective allocations, got %v", value)
+	}
+
+	deleteAllocationMetrics(ud, []string{"t1"})
+	if _, found := gatherMetric(t, "kruise_uniteddeployment_allocated_replicas", "metrics", "subset", "t1"); found {
+		t.Fatalf("expected the metric of the deleted subset to be removed")
+	}
+
+	other := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	other.Name = "other-metrics"
+	recordAllocationMetrics(other, GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), other))
+	deleteUnitedDeploymentMetrics(ud.Namespace, ud.Name)
+	if _, found := gatherMetric(t, "kruise_uniteddeployment_allocated_replicas", "metrics", "subset", "t2"); found {
+		t.Fatalf("expected the allocated replicas of the deleted UnitedDeployment to be removed")
+	}
+	if _, found := gatherMetric(t, "kruise_uniteddeployment_ineffective_allocations_total", "metrics", "reason", string(OverSpecifiedAllocationReason)); found {
+		t.Fatalf("expected the ineffective allocations of the deleted UnitedDeployment to be removed")
+	}
+	if _, found := gatherMetric(t, "kruise_uniteddeployment_allocated_replicas", "other-metrics", "subset", "t1"); !found {
+		t.Fatalf("expected the metrics of other UnitedDeployments to be kept")
+	}
+}
+
+// gatherMetric returns the value of the metric of the named UnitedDeployment with the given label.
+func gatherMetric(t *testing.T, metricName, udName, labelName, labelValue string) (float64, bool) {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != metricName {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["name"] != udName || labels[labelName] != labelValue {
+				continue
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue(), true
+			}
+			return metric.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
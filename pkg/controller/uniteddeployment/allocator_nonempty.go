@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+// spreadNonEmptySubsets moves replicas one by one from the unspecified subsets holding the most replicas, if more
+// than one, to the empty unspecified ones, until at least minNonEmptySubsets subsets hold replicas. It returns an
+// error if there are fewer replicas or subsets than minNonEmptySubsets, or the bounds of subsets do not allow.
+func (s *replicasAllocator) spreadNonEmptySubsets() error {
+	target := *s.minNonEmptySubsets
+	var total int32
+	for _, subset := range *s.subsets {
+		total += subset.Replicas
+	}
+	if total < target || int32(len(*s.subsets)) < target {
+		return newAllocationError(InsufficientNonEmptySubsetsAllocationReason, "%d replicas can not be spread across %d of %d subsets",
+			total, target, len(*s.subsets))
+	}
+
+	for {
+		if err := allocationCancelled(s.ctx); err != nil {
+			return err
+		}
+		var occupied int32
+		var donor, receiver *nameToReplicas
+		for _, subset := range *s.subsets {
+			if subset.Replicas > 0 {
+				occupied++
+			}
+			if subset.Specified {
+				continue
+			}
+			if subset.Replicas == 0 && receiver == nil && canGrow(subset) {
+				receiver = subset
+			}
+			if subset.Replicas > 1 && canShrink(subset) && (donor == nil || subset.Replicas > donor.Replicas) {
+				donor = subset
+			}
+		}
+		if occupied >= target {
+			return nil
+		}
+		if donor == nil || receiver == nil {
+			return newAllocationError(InsufficientNonEmptySubsetsAllocationReason, "only %d subsets could hold replicas, fewer than min non-empty subsets (%d)",
+				occupied, target)
+		}
+
+		donor.Replicas--
+		receiver.Replicas++
+	}
+}
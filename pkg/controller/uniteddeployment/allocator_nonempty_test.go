@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestMinNonEmptySubsets(t *testing.T) {
+	// the highest priority subset t1 takes all the replicas without the min non-empty subsets
+	withProviders(t, AllocationProviders{
+		Priority: &fakeSchedulingPriorityProvider{priorities: map[string]int32{"t1": 10}},
+	})
+
+	for name, c := range map[string]struct {
+		replicas           int32
+		minNonEmptySubsets *int32
+		t3MaxReplicas      *int32
+		expected           map[string]int32
+		reason             AllocationReasonCode
+	}{
+		"no min non-empty subsets": {
+			replicas: 3,
+			expected: map[string]int32{"t1": 3, "t2": 0, "t3": 0},
+		},
+		"exactly satisfiable": {
+			replicas:           3,
+			minNonEmptySubsets: int32Ptr(3),
+			expected:           map[string]int32{"t1": 1, "t2": 1, "t3": 1},
+		},
+		"already satisfied": {
+			replicas:           5,
+			minNonEmptySubsets: int32Ptr(2),
+			expected:           map[string]int32{"t1": 4, "t2": 1, "t3": 0},
+		},
+		"replicas fewer than min non-empty subsets": {
+			replicas:           2,
+			minNonEmptySubsets: int32Ptr(3),
+			reason:             InsufficientNonEmptySubsetsAllocationReason,
+		},
+		"subsets fewer than min non-empty subsets": {
+			replicas:           5,
+			minNonEmptySubsets: int32Ptr(4),
+			reason:             InsufficientNonEmptySubsetsAllocationReason,
+		},
+		"max replicas leave a subset empty": {
+			replicas:           3,
+			minNonEmptySubsets: int32Ptr(3),
+			t3MaxReplicas:      int32Ptr(0),
+			reason:             InsufficientNonEmptySubsetsAllocationReason,
+		},
+	} {
+		ud := createUnitedDeployment(c.replicas,
+			appsv1alpha1.Subset{Name: "t1"},
+			appsv1alpha1.Subset{Name: "t2"},
+			appsv1alpha1.Subset{Name: "t3", MaxReplicas: c.t3MaxReplicas},
+		)
+		ud.Spec.Topology.MinNonEmptySubsets = c.minNonEmptySubsets
+		result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if c.reason != "" {
+			if result.Effective || result.ReasonCode != c.reason {
+				t.Fatalf("%s: expected ineffective allocation of reason %s, got %+v", name, c.reason, result)
+			}
+			continue
+		}
+		if !result.Effective {
+			t.Fatalf("%s: unexpected ineffective allocation %+v", name, result)
+		}
+		if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *result.SubsetReplicas)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// getOnboardingSubsets returns the subsets onboarded gradually by Topology.GradualStep. A subset starts onboarding
+// if it is missing from the last allocated replicas recorded in Status.SubsetReplicas, its replicas are not
+// specified and it has no replicas yet, and keeps onboarding while it is recorded in Status.OnboardingSubsets.
+// It returns nil if GradualStep is not set or nothing has been allocated yet.
+func getOnboardingSubsets(ud *appsv1alpha1.UnitedDeployment, nameToSubset *map[string]*Subset) map[string]bool {
+	step := ud.Spec.Topology.GradualStep
+	if step == nil || *step < 1 || len(ud.Status.SubsetReplicas) == 0 {
+		return nil
+	}
+
+	recorded := sets.NewString(ud.Status.OnboardingSubsets...)
+	onboarding := map[string]bool{}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.Replicas != nil {
+			continue
+		}
+		if recorded.Has(subsetDef.Name) {
+			onboarding[subsetDef.Name] = true
+			continue
+		}
+		if _, allocated := ud.Status.SubsetReplicas[subsetDef.Name]; allocated {
+			continue
+		}
+		if subset, exist := (*nameToSubset)[subsetDef.Name]; exist && subset.Spec.Replicas > 0 {
+			continue
+		}
+		onboarding[subsetDef.Name] = true
+	}
+	return onboarding
+}
+
+// getNextOnboardingSubsets returns the onboarding subsets which receive the whole gradual step in the next replicas,
+// so that they keep onboarding in the following reconciles. The others have been balanced with the other subsets.
+func getNextOnboardingSubsets(ud *appsv1alpha1.UnitedDeployment, nameToSubset *map[string]*Subset, next *map[string]int32) []string {
+	onboarding := getOnboardingSubsets(ud, nameToSubset)
+	if len(onboarding) == 0 || next == nil {
+		return nil
+	}
+
+	var names []string
+	for name := range onboarding {
+		var current int32
+		if subset, exist := (*nameToSubset)[name]; exist {
+			current = subset.Spec.Replicas
+		}
+		if (*next)[name] >= current+*ud.Spec.Topology.GradualStep {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestGradualOnboarding(t *testing.T) {
+	newUnitedDeployment := func() *appsv1alpha1.UnitedDeployment {
+		ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Status.SubsetReplicas = map[string]int32{"t1": 6, "t2": 6}
+		return ud
+	}
+
+	// the subset appended to the topology is balanced at once by default
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 6, "t2": 6}), newUnitedDeployment())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("expected the new subset to be balanced at once, got %v", *next)
+	}
+
+	ud := newUnitedDeployment()
+	ud.Spec.Topology.GradualStep = int32Ptr(1)
+	current := map[string]int32{"t1": 6, "t2": 6}
+	expectedSteps := []struct {
+		replicas   map[string]int32
+		onboarding []string
+	}{
+		{replicas: map[string]int32{"t1": 5, "t2": 6, "t3": 1}, onboarding: []string{"t3"}},
+		{replicas: map[string]int32{"t1": 5, "t2": 5, "t3": 2}, onboarding: []string{"t3"}},
+		{replicas: map[string]int32{"t1": 4, "t2": 5, "t3": 3}, onboarding: []string{"t3"}},
+		{replicas: map[string]int32{"t1": 4, "t2": 4, "t3": 4}, onboarding: []string{"t3"}},
+		{replicas: map[string]int32{"t1": 4, "t2": 4, "t3": 4}},
+	}
+	for i, expected := range expectedSteps {
+		next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(current), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v in step %d", err, i)
+		}
+		if !reflect.DeepEqual(*next, expected.replicas) {
+			t.Fatalf("expected %v in step %d, got %v", expected.replicas, i, *next)
+		}
+		if !reflect.DeepEqual(status.onboardingSubsets, expected.onboarding) {
+			t.Fatalf("expected onboarding subsets %v in step %d, got %v", expected.onboarding, i, status.onboardingSubsets)
+		}
+		current = *next
+		ud.Status.SubsetReplicas = *next
+		ud.Status.OnboardingSubsets = status.onboardingSubsets
+	}
+
+	// a subset of the first allocation is not onboarded gradually
+	ud = createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.GradualStep = int32Ptr(1)
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("expected the first allocation to be balanced at once, got %v", *next)
+	}
+}
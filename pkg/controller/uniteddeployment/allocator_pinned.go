@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+const (
+	// pinnedByMax means the subset is capped at its max replicas, or its max replicas of this round.
+	pinnedByMax = "max"
+	// pinnedByMin means the subset is raised to its min replicas, e.g. the current replicas of a protected subset.
+	pinnedByMin = "min"
+	// pinnedBySkew means replicas are moved from or to the subset to keep the difference within maxSkew.
+	pinnedBySkew = "skew"
+)
+
+// pinnedSubsets returns a mapping from the name of each unspecified subset pinned at a boundary in the last
+// allocation to the constraint pinning it, or nil if none is pinned. A subset capped or raised to a bound is left
+// out if its replicas are moved away from the bound afterwards, e.g. to spread the failure domains.
+func (s *replicasAllocator) pinnedSubsets() map[string]string {
+	var pinned map[string]string
+	for _, subset := range *s.subsets {
+		if subset.Specified || subset.PinnedBy == "" {
+			continue
+		}
+		switch subset.PinnedBy {
+		case pinnedByMax:
+			if bound := subset.upperBound(); bound == nil || subset.Replicas != *bound {
+				continue
+			}
+		case pinnedByMin:
+			if subset.MinReplicas == nil || subset.Replicas != *subset.MinReplicas {
+				continue
+			}
+		}
+		if pinned == nil {
+			pinned = map[string]string{}
+		}
+		pinned[subset.SubsetName] = subset.PinnedBy
+	}
+	return pinned
+}
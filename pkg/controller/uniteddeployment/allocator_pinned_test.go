@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestPinnedSubsets(t *testing.T) {
+	for name, c := range map[string]struct {
+		subsets  []appsv1alpha1.Subset
+		current  map[string]int32
+		topology func(topology *appsv1alpha1.Topology)
+		expected map[string]int32
+		pinned   map[string]string
+	}{
+		"no constraint": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"one at max and one at min": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: int32Ptr(2)}, {Name: "t2", Protected: true}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 2, "t2": 5, "t3": 3},
+			expected: map[string]int32{"t1": 2, "t2": 5, "t3": 3},
+			pinned:   map[string]string{"t1": pinnedByMax, "t2": pinnedByMin},
+		},
+		"max within the share": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: int32Ptr(4)}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"skew": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.PreferredWeights = map[string]int32{"t1": 8, "t2": 1, "t3": 1}
+				topology.MaxSkew = int32Ptr(2)
+			},
+			expected: map[string]int32{"t1": 4, "t2": 3, "t3": 3},
+			pinned:   map[string]string{"t1": pinnedBySkew, "t2": pinnedBySkew, "t3": pinnedBySkew},
+		},
+	} {
+		ud := createUnitedDeployment(10, c.subsets...)
+		if c.topology != nil {
+			c.topology(&ud.Spec.Topology)
+		}
+		result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), ud)
+		if !result.Effective {
+			t.Fatalf("%s: unexpected ineffective allocation %+v", name, result)
+		}
+		if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *result.SubsetReplicas)
+		}
+		if !reflect.DeepEqual(result.PinnedSubsets, c.pinned) {
+			t.Fatalf("%s: expected pinned subsets %v, got %v", name, c.pinned, result.PinnedSubsets)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/rpc/jsonrpc"
+	"time"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+const rpcAllocationPluginTimeout = 5 * time.Second
+
+// AllocationPlugin calculates the replicas of each subset by an external allocation policy.
+type AllocationPlugin interface {
+	// Allocate returns a mapping from subset name to its next replicas for the input. It should give up once
+	// ctx is done.
+	Allocate(ctx context.Context, input *AllocationInput) (map[string]int32, error)
+}
+
+// AllocationInput is the serialized input of an allocation passed to AllocationPlugin.
+type AllocationInput struct {
+	Namespace string                  `json:"namespace"`
+	Name      string                  `json:"name"`
+	Replicas  int32                   `json:"replicas"`
+	Subsets   []AllocationInputSubset `json:"subsets"`
+}
+
+// AllocationInputSubset describes a subset in AllocationInput. The output of the plugin should equal
+// SpecifiedReplicas if it is set, and be in range [MinReplicas, MaxReplicas].
+type AllocationInputSubset struct {
+	Name              string `json:"name"`
+	CurrentReplicas   int32  `json:"currentReplicas"`
+	SpecifiedReplicas *int32 `json:"specifiedReplicas,omitempty"`
+	MinReplicas       *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas       *int32 `json:"maxReplicas,omitempty"`
+}
+
+// NewRPCAllocationPlugin returns an AllocationPlugin which calls the method AllocationPlugin.Allocate
+// of a JSON-RPC server listening on the unix socket.
+func NewRPCAllocationPlugin(socketPath string) AllocationPlugin {
+	return &rpcAllocationPlugin{socketPath: socketPath}
+}
+
+type rpcAllocationPlugin struct {
+	socketPath string
+}
+
+func (p *rpcAllocationPlugin) Allocate(ctx context.Context, input *AllocationInput) (map[string]int32, error) {
+	deadline := time.Now().Add(rpcAllocationPluginTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "unix", p.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+
+	var output map[string]int32
+	call := client.Go("AllocationPlugin.Allocate", input, &output, nil)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.Done:
+	}
+	if call.Error != nil {
+		return nil, call.Error
+	}
+	return output, nil
+}
+
+// allocationInput describes the allocation of the replicas among the subsets of the allocator.
+func (s *replicasAllocator) allocationInput(ud *appsv1alpha1.UnitedDeployment, replicas int32, specifiedSubsetReplicas *map[string]int32) *AllocationInput {
+	input := &AllocationInput{Namespace: ud.Namespace, Name: ud.Name, Replicas: replicas}
+	for _, subset := range *s.subsets {
+		inputSubset := AllocationInputSubset{
+			Name:            subset.SubsetName,
+			CurrentReplicas: subset.Replicas,
+			MinReplicas:     subset.MinReplicas,
+			MaxReplicas:     subset.upperBound(),
+		}
+		if specified, exist := (*specifiedSubsetReplicas)[subset.SubsetName]; exist {
+			inputSubset.SpecifiedReplicas = &specified
+		}
+		input.Subsets = append(input.Subsets, inputSubset)
+	}
+	return input
+}
+
+// allocateByPlugin returns the replicas of each subset calculated by Providers.Plugin. It returns nil if there is
+// no plugin, or if the plugin fails or violates the specified replicas and bounds of subsets, so that the built-in
+// allocation is used instead.
+func allocateByPlugin(ctx context.Context, ud *appsv1alpha1.UnitedDeployment, input *AllocationInput) *map[string]int32 {
+	plugin := providersOf(ctx).Plugin
+	if plugin == nil {
+		return nil
+	}
+
+	output, err := plugin.Allocate(ctx, input)
+	if err == nil {
+		err = validatePluginReplicas(input, output)
+	}
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Reject allocation plugin, use built-in allocation instead")
+		return nil
+	}
+
+	return &output
+}
+
+// validatePluginReplicas checks the output of a plugin covers exactly the input subsets, sums to the input replicas,
+// and respects the specified replicas and bounds of each subset.
+func validatePluginReplicas(input *AllocationInput, output map[string]int32) error {
+	if len(output) != len(input.Subsets) {
+		return fmt.Errorf("output has %d subsets, but expected %d", len(output), len(input.Subsets))
+	}
+
+	var sum int64
+	for _, subset := range input.Subsets {
+		replicas, exist := output[subset.Name]
+		if !exist {
+			return fmt.Errorf("output misses subset %s", subset.Name)
+		}
+		if replicas < 0 {
+			return fmt.Errorf("replicas (%d) of subset %s is less than 0", replicas, subset.Name)
+		}
+		if subset.SpecifiedReplicas != nil && replicas != *subset.SpecifiedReplicas {
+			return fmt.Errorf("replicas (%d) of subset %s is not the specified replicas (%d)", replicas, subset.Name, *subset.SpecifiedReplicas)
+		}
+		if subset.MinReplicas != nil && replicas < *subset.MinReplicas {
+			return fmt.Errorf("replicas (%d) of subset %s is less than its min replicas (%d)", replicas, subset.Name, *subset.MinReplicas)
+		}
+		if subset.MaxReplicas != nil && replicas > *subset.MaxReplicas {
+			return fmt.Errorf("replicas (%d) of subset %s is greater than its max replicas (%d)", replicas, subset.Name, *subset.MaxReplicas)
+		}
+		sum += int64(replicas)
+	}
+
+	if sum != int64(input.Replicas) {
+		return fmt.Errorf("sum of output replicas (%d) is not the UnitedDeployment replicas (%d)", sum, input.Replicas)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+type fakeRPCPlugin struct {
+	output map[string]int32
+	input  *AllocationInput
+}
+
+func (p *fakeRPCPlugin) Allocate(input *AllocationInput, output *map[string]int32) error {
+	p.input = input
+	*output = p.output
+	return nil
+}
+
+func serveFakeRPCPlugin(t *testing.T, plugin *fakeRPCPlugin) string {
+	dir, err := os.MkdirTemp("", "ud-plugin")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	socketPath := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	})
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("AllocationPlugin", plugin); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return socketPath
+}
+
+func TestRPCAllocationPlugin(t *testing.T) {
+	t1Replicas := intstr.FromInt(2)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 4, "t3": 4})
+
+	plugin := &fakeRPCPlugin{output: map[string]int32{"t1": 2, "t2": 7, "t3": 1}}
+	withProviders(t, AllocationProviders{Plugin: NewRPCAllocationPlugin(serveFakeRPCPlugin(t, plugin))})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, plugin.output) {
+		t.Fatalf("expected allocation of plugin, got %v", *next)
+	}
+	if plugin.input.Replicas != 10 || len(plugin.input.Subsets) != 3 {
+		t.Fatalf("unexpected plugin input %v", plugin.input)
+	}
+
+	for _, output := range []map[string]int32{
+		{"t1": 2, "t2": 7, "t3": 2},
+		{"t1": 3, "t2": 6, "t3": 1},
+		{"t1": 2, "t2": 8},
+		{"t1": 2, "t2": 9, "t3": -1},
+	} {
+		plugin.output = output
+		next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, map[string]int32{"t1": 2, "t2": 4, "t3": 4}) {
+			t.Fatalf("invalid plugin output %v should be rejected, got %v", output, *next)
+		}
+	}
+}
+
+func TestRPCAllocationPluginCancelled(t *testing.T) {
+	plugin := NewRPCAllocationPlugin(serveFakeRPCPlugin(t, &fakeRPCPlugin{output: map[string]int32{"t1": 1}}))
+	if _, err := plugin.Allocate(context.TODO(), &AllocationInput{Replicas: 1}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err := plugin.Allocate(ctx, &AllocationInput{Replicas: 1}); err == nil {
+		t.Fatalf("expected the plugin call to fail with a cancelled context")
+	}
+}
+
+func TestValidatePluginReplicasOverflow(t *testing.T) {
+	input := &AllocationInput{
+		Replicas: 10,
+		Subsets:  []AllocationInputSubset{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+	}
+	// the output would sum to 10 if the replicas wrapped around in int32
+	output := map[string]int32{"a": math.MaxInt32, "b": math.MaxInt32, "c": 12}
+	if err := validatePluginReplicas(input, output); err == nil {
+		t.Fatalf("expected overflowing plugin output %v to be rejected", output)
+	}
+}
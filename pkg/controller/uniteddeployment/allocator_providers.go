@@ -0,0 +1,342 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// SubsetCapacityProvider reports the max number of pods each subset of a UnitedDeployment could hold.
+type SubsetCapacityProvider interface {
+	// GetSubsetCapacities returns a mapping from subset name to its capacity. Subsets which are absent
+	// from the mapping are considered to have unlimited capacity.
+	GetSubsetCapacities(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// TrafficSplitProvider reports the share of traffic served by each subset of a UnitedDeployment, e.g. from
+// the backend weights of a Gateway API HTTPRoute.
+type TrafficSplitProvider interface {
+	// GetSubsetTrafficWeights returns a mapping from subset name to the weight of traffic it serves.
+	// Subsets which are absent from the mapping are considered to serve no traffic.
+	GetSubsetTrafficWeights(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// InterruptionRiskProvider reports how likely each subset of a UnitedDeployment is to be interrupted soon,
+// e.g. the spot instances of a subset whose lease is near expiry.
+type InterruptionRiskProvider interface {
+	// GetSubsetInterruptionRisks returns a mapping from subset name to its interruption risk in percentage,
+	// which is in range [0, 100]. Subsets which are absent from the mapping are considered to have no risk.
+	GetSubsetInterruptionRisks(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// DisruptionBudgetProvider reports how many pods of each subset of a UnitedDeployment could be disrupted now,
+// e.g. from the PodDisruptionBudgets covering the pods of the subsets.
+type DisruptionBudgetProvider interface {
+	// GetSubsetDisruptionsAllowed returns a mapping from subset name to the number of its pods allowed to be
+	// disrupted. Subsets which are absent from the mapping are not limited.
+	GetSubsetDisruptionsAllowed(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// SchedulingSuccessProvider reports how often the pods of each subset of a UnitedDeployment were scheduled
+// successfully over a recent window.
+type SchedulingSuccessProvider interface {
+	// GetSubsetSchedulingSuccessRates returns a mapping from subset name to its scheduling success rate in
+	// percentage, which is in range [0, 100]. Subsets which are absent from the mapping are considered to
+	// always succeed.
+	GetSubsetSchedulingSuccessRates(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// SchedulingPriorityProvider reports the scheduling priority of each subset of a UnitedDeployment, such as
+// the value of the PriorityClass its pods run with.
+type SchedulingPriorityProvider interface {
+	// GetSubsetSchedulingPriorities returns a mapping from subset name to its priority, where a higher value
+	// means a higher priority. Subsets which are absent from the mapping have priority 0.
+	GetSubsetSchedulingPriorities(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// SubsetCostProvider reports the cost of running one replica in each subset of a UnitedDeployment,
+// e.g. the hourly price of the nodes of the subsets.
+type SubsetCostProvider interface {
+	// GetSubsetCosts returns a mapping from subset name to the cost of one replica in it. Subsets which
+	// are absent from the mapping are considered to be free.
+	GetSubsetCosts(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// NodeProvisioningProvider reports when nodes were added to each subset of a UnitedDeployment most recently,
+// e.g. by the cluster autoscaler.
+type NodeProvisioningProvider interface {
+	// GetSubsetNodeAdditionTimes returns a mapping from subset name to the last time nodes were added to it.
+	// Subsets which are absent from the mapping are considered to have no recent node addition.
+	GetSubsetNodeAdditionTimes(ud *appsv1alpha1.UnitedDeployment) (map[string]metav1.Time, error)
+}
+
+// MemoryHeadroomProvider reports the aggregate memory available on the nodes of each subset of a UnitedDeployment.
+type MemoryHeadroomProvider interface {
+	// GetSubsetMemoryHeadroom returns a mapping from subset name to its available memory in bytes. Subsets
+	// which are absent from the mapping are considered to have no available memory.
+	GetSubsetMemoryHeadroom(ud *appsv1alpha1.UnitedDeployment) (map[string]int64, error)
+}
+
+// SubsetTargetStore reads the authoritative replicas of each subset of a UnitedDeployment from an external
+// key-value store, such as etcd or Consul, which is shared by multiple controllers coordinating capacity.
+type SubsetTargetStore interface {
+	// GetSubsetTargets returns a mapping from subset name to its target replicas. The targets should cover
+	// all the subsets and sum to the replicas of the UnitedDeployment.
+	GetSubsetTargets(ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error)
+}
+
+// AllocationProviders holds the external data sources consulted when allocating replicas to subsets.
+// Each of them is optional. If a provider is nil or fails, the allocator behaves as if it had no such data.
+type AllocationProviders struct {
+	Capacity         SubsetCapacityProvider
+	TrafficSplit     TrafficSplitProvider
+	InterruptionRisk InterruptionRiskProvider
+	DisruptionBudget DisruptionBudgetProvider
+	Scheduling       SchedulingSuccessProvider
+	Priority         SchedulingPriorityProvider
+	Cost             SubsetCostProvider
+	NodeProvisioning NodeProvisioningProvider
+	MemoryHeadroom   MemoryHeadroomProvider
+	// Plugin replaces the built-in allocation with an external policy if its output is valid.
+	Plugin AllocationPlugin
+	// TargetStore enables the coordination mode, in which its targets are regarded as specified replicas of subsets.
+	TargetStore SubsetTargetStore
+	// Reviewer approves, rejects or adjusts the allocation before it is applied to the subsets.
+	Reviewer AllocationReviewer
+}
+
+// Providers is the set of data sources used by GetAllocatedReplicas. It should be set up before the
+// controller starts.
+var Providers = AllocationProviders{}
+
+// providersKey is the key of the AllocationProviders carried by the context of an allocation.
+type providersKey struct{}
+
+// withoutProviders returns a context in which the allocation consults none of the providers, so that it only
+// depends on the UnitedDeployment and the current replicas of its subsets.
+func withoutProviders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, providersKey{}, &AllocationProviders{})
+}
+
+// withReadOnlyProviders returns a context in which the allocation consults the data sources of the providers of ctx,
+// but neither the plugin nor the reviewer, so that a simulated allocation has no effect on external policies.
+func withReadOnlyProviders(ctx context.Context) context.Context {
+	providers := *providersOf(ctx)
+	providers.Plugin, providers.Reviewer = nil, nil
+	return context.WithValue(ctx, providersKey{}, &providers)
+}
+
+// providersOf returns the providers consulted by the allocation of the context, which are Providers unless they
+// are replaced in the context.
+func providersOf(ctx context.Context) *AllocationProviders {
+	if providers, ok := ctx.Value(providersKey{}).(*AllocationProviders); ok {
+		return providers
+	}
+	return &Providers
+}
+
+func getSubsetCapacities(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.Capacity == nil {
+		return nil
+	}
+
+	capacities, err := providers.Capacity.GetSubsetCapacities(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset capacities, ignore them")
+		return nil
+	}
+
+	return capacities
+}
+
+func getSubsetTrafficWeights(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.TrafficSplit == nil {
+		return nil
+	}
+
+	weights, err := providers.TrafficSplit.GetSubsetTrafficWeights(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset traffic weights, ignore them")
+		return nil
+	}
+
+	return weights
+}
+
+func getSubsetInterruptionRisks(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.InterruptionRisk == nil {
+		return nil
+	}
+
+	risks, err := providers.InterruptionRisk.GetSubsetInterruptionRisks(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset interruption risks, ignore them")
+		return nil
+	}
+
+	return risks
+}
+
+func getSubsetDisruptionsAllowed(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.DisruptionBudget == nil {
+		return nil
+	}
+
+	allowed, err := providers.DisruptionBudget.GetSubsetDisruptionsAllowed(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset disruptions allowed, ignore them")
+		return nil
+	}
+
+	return allowed
+}
+
+func getSubsetSchedulingSuccessRates(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.Scheduling == nil {
+		return nil
+	}
+
+	rates, err := providers.Scheduling.GetSubsetSchedulingSuccessRates(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset scheduling success rates, ignore them")
+		return nil
+	}
+
+	return rates
+}
+
+func getSubsetSchedulingPriorities(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.Priority == nil {
+		return nil
+	}
+
+	priorities, err := providers.Priority.GetSubsetSchedulingPriorities(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset scheduling priorities, ignore them")
+		return nil
+	}
+
+	return priorities
+}
+
+// getExternalSubsetTargets returns the targets in the SubsetTargetStore, or nil if they are unavailable or invalid.
+func getExternalSubsetTargets(ctx context.Context, ud *appsv1alpha1.UnitedDeployment, replicas int32) *map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.TargetStore == nil {
+		return nil
+	}
+
+	targets, err := providers.TargetStore.GetSubsetTargets(ud)
+	if err == nil {
+		err = validateExternalSubsetTargets(ud, targets, replicas)
+	}
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset targets from the store, allocate by itself instead")
+		return nil
+	}
+
+	return &targets
+}
+
+func validateExternalSubsetTargets(ud *appsv1alpha1.UnitedDeployment, targets map[string]int32, replicas int32) error {
+	if len(targets) != len(ud.Spec.Topology.Subsets) {
+		return fmt.Errorf("store has %d subsets, but expected %d", len(targets), len(ud.Spec.Topology.Subsets))
+	}
+
+	var sum int64
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		target, exist := targets[subsetDef.Name]
+		if !exist {
+			return fmt.Errorf("store has no target of subset %s", subsetDef.Name)
+		}
+		if target < 0 {
+			return fmt.Errorf("target (%d) of subset %s is less than 0", target, subsetDef.Name)
+		}
+		sum += int64(target)
+	}
+	if sum != int64(replicas) {
+		return fmt.Errorf("sum of targets (%d) is not the UnitedDeployment replicas (%d)", sum, replicas)
+	}
+
+	return nil
+}
+
+func getSubsetCosts(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	providers := providersOf(ctx)
+	if providers.Cost == nil {
+		return nil
+	}
+
+	costs, err := providers.Cost.GetSubsetCosts(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset costs, ignore them")
+		return nil
+	}
+
+	return costs
+}
+
+// getWarmingUpSubsets returns the names of subsets whose nodes were added within Spec.Topology.NodeWarmupSeconds.
+func getWarmingUpSubsets(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]bool {
+	providers := providersOf(ctx)
+	warmup := ud.Spec.Topology.NodeWarmupSeconds
+	if providers.NodeProvisioning == nil || warmup == nil || *warmup <= 0 {
+		return nil
+	}
+
+	additionTimes, err := providers.NodeProvisioning.GetSubsetNodeAdditionTimes(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset node addition times, ignore them")
+		return nil
+	}
+
+	now := stabilizationClock.Now()
+	warmingUp := map[string]bool{}
+	for name, additionTime := range additionTimes {
+		if now.Before(additionTime.Add(time.Duration(*warmup) * time.Second)) {
+			warmingUp[name] = true
+		}
+	}
+	return warmingUp
+}
+
+func getSubsetMemoryHeadroom(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int64 {
+	providers := providersOf(ctx)
+	if providers.MemoryHeadroom == nil {
+		return nil
+	}
+
+	headroom, err := providers.MemoryHeadroom.GetSubsetMemoryHeadroom(ud)
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Fail to get subset memory headroom, ignore them")
+		return nil
+	}
+
+	return headroom
+}
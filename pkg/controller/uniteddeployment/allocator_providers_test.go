@@ -0,0 +1,626 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+type fakeCapacityProvider struct {
+	capacities map[string]int32
+	err        error
+}
+
+func (p *fakeCapacityProvider) GetSubsetCapacities(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.capacities, p.err
+}
+
+type fakeTrafficSplitProvider struct {
+	weights map[string]int32
+	err     error
+}
+
+func (p *fakeTrafficSplitProvider) GetSubsetTrafficWeights(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.weights, p.err
+}
+
+type fakeInterruptionRiskProvider struct {
+	risks map[string]int32
+}
+
+func (p *fakeInterruptionRiskProvider) GetSubsetInterruptionRisks(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.risks, nil
+}
+
+type fakeDisruptionBudgetProvider struct {
+	allowed map[string]int32
+}
+
+func (p *fakeDisruptionBudgetProvider) GetSubsetDisruptionsAllowed(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.allowed, nil
+}
+
+type fakeSchedulingSuccessProvider struct {
+	rates map[string]int32
+}
+
+func (p *fakeSchedulingSuccessProvider) GetSubsetSchedulingSuccessRates(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.rates, nil
+}
+
+type fakeSchedulingPriorityProvider struct {
+	priorities map[string]int32
+}
+
+func (p *fakeSchedulingPriorityProvider) GetSubsetSchedulingPriorities(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.priorities, nil
+}
+
+type fakeSubsetTargetStore struct {
+	targets map[string]int32
+	err     error
+}
+
+func (s *fakeSubsetTargetStore) GetSubsetTargets(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return s.targets, s.err
+}
+
+type fakeSubsetCostProvider struct {
+	costs map[string]int32
+}
+
+func (p *fakeSubsetCostProvider) GetSubsetCosts(_ *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	return p.costs, nil
+}
+
+type fakeNodeProvisioningProvider struct {
+	additionTimes map[string]metav1.Time
+}
+
+func (p *fakeNodeProvisioningProvider) GetSubsetNodeAdditionTimes(_ *appsv1alpha1.UnitedDeployment) (map[string]metav1.Time, error) {
+	return p.additionTimes, nil
+}
+
+type fakeMemoryHeadroomProvider struct {
+	headroom map[string]int64
+}
+
+func (p *fakeMemoryHeadroomProvider) GetSubsetMemoryHeadroom(_ *appsv1alpha1.UnitedDeployment) (map[string]int64, error) {
+	return p.headroom, nil
+}
+
+func withProviders(t *testing.T, providers AllocationProviders) {
+	origin := Providers
+	Providers = providers
+	t.Cleanup(func() {
+		Providers = origin
+	})
+}
+
+func TestSystemReservedReplicas(t *testing.T) {
+	reserved := int32(2)
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1", SystemReservedReplicas: &reserved},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 5}}})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 4, "t3": 5}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	ud.Spec.Topology.Subsets[0].SystemReservedReplicas = nil
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	reserved = 6
+	ud.Spec.Topology.Subsets[0].SystemReservedReplicas = &reserved
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 0, "t2": 6, "t3": 6}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{err: fmt.Errorf("unavailable")}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+	// without any capacity provider, the reserved pods are subtracted from the max replicas
+	withProviders(t, AllocationProviders{})
+	reserved = 2
+	ud.Spec.Topology.Subsets[0].MaxReplicas = int32Ptr(5)
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 4, "t3": 5}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+}
+
+func TestReserveUpdateSurge(t *testing.T) {
+	ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.ReserveUpdateSurge = true
+	ud.Status.CurrentRevision = "r1"
+	ud.Status.UpdateStatus = &appsv1alpha1.UpdateStatus{UpdatedRevision: "r2"}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 4, "t2": 4, "t3": 4})
+	surge := int32(1)
+	for _, subset := range *nameToSubset {
+		subset.Spec.UpdateStrategy.MaxSurge = &surge
+		subset.Status.UpdatedReplicas = subset.Spec.Replicas
+	}
+	withProviders(t, AllocationProviders{
+		Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 4, "t2": 4, "t3": 4}},
+	})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 3, "t2": 3, "t3": 3}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("expected surge headroom during update %v, got %v", expected, *next)
+	}
+
+	ud.Status.CurrentRevision = "r2"
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 4, "t2": 4, "t3": 4}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("expected full capacity after update %v, got %v", expected, *next)
+	}
+}
+
+func TestTrafficSplitWeights(t *testing.T) {
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	withProviders(t, AllocationProviders{TrafficSplit: &fakeTrafficSplitProvider{weights: map[string]int32{"t1": 50, "t2": 30, "t3": 20}}})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 5, "t2": 3, "t3": 2}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	ud.Spec.Topology.PreferredWeights = map[string]int32{"t1": 1, "t2": 1, "t3": 8}
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 1, "t2": 1, "t3": 8}) {
+		t.Fatalf("preferred weights should take precedence, got %v", *next)
+	}
+
+	ud.Spec.Topology.PreferredWeights = nil
+	withProviders(t, AllocationProviders{TrafficSplit: &fakeTrafficSplitProvider{err: fmt.Errorf("unavailable")}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 4}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+}
+
+func TestMaxActiveSubsets(t *testing.T) {
+	maxActiveSubsets := int32(2)
+	ud := createUnitedDeployment(6,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Spec.Topology.MaxActiveSubsets = &maxActiveSubsets
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 2, "t3": 2})
+
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 5, "t2": 5, "t3": 5}}})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 0}) {
+		t.Fatalf("replicas should be consolidated, got %v", *next)
+	}
+
+	ud.Spec.Replicas = int32Ptr(12)
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4, "t3": 4}) {
+		t.Fatalf("more subsets should be activated, got %v", *next)
+	}
+
+	maxActiveSubsets = 1
+	ud.Spec.Replicas = int32Ptr(6)
+	withProviders(t, AllocationProviders{})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 6, "t2": 0, "t3": 0}) {
+		t.Fatalf("replicas should be consolidated, got %v", *next)
+	}
+}
+
+func TestInterruptionRisks(t *testing.T) {
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 4, "t2": 4, "t3": 4})
+
+	for _, c := range []struct {
+		risks    map[string]int32
+		expected map[string]int32
+	}{
+		{risks: nil, expected: map[string]int32{"t1": 4, "t2": 4, "t3": 4}},
+		{risks: map[string]int32{"t3": 50}, expected: map[string]int32{"t1": 5, "t2": 5, "t3": 2}},
+		{risks: map[string]int32{"t3": 80}, expected: map[string]int32{"t1": 5, "t2": 6, "t3": 1}},
+		{risks: map[string]int32{"t3": 100}, expected: map[string]int32{"t1": 6, "t2": 6, "t3": 0}},
+		{risks: map[string]int32{"t1": 100, "t2": 100, "t3": 100}, expected: map[string]int32{"t1": 4, "t2": 4, "t3": 4}},
+	} {
+		withProviders(t, AllocationProviders{InterruptionRisk: &fakeInterruptionRiskProvider{risks: c.risks}})
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("risks %v: expected %v, got %v", c.risks, c.expected, *next)
+		}
+	}
+}
+
+func TestSchedulingSuccessRates(t *testing.T) {
+	ud := createUnitedDeployment(24,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 4, "t2": 4, "t3": 4})
+
+	withProviders(t, AllocationProviders{Scheduling: &fakeSchedulingSuccessProvider{}})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 8, "t2": 8, "t3": 8}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	withProviders(t, AllocationProviders{Scheduling: &fakeSchedulingSuccessProvider{rates: map[string]int32{"t1": 100, "t3": 50}}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 9, "t2": 10, "t3": 5}) {
+		t.Fatalf("flaky subset should receive less of the scale-out, got %v", *next)
+	}
+}
+
+func TestSchedulingPriorities(t *testing.T) {
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	withProviders(t, AllocationProviders{
+		Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 4, "t2": 8, "t3": 8}},
+		Priority: &fakeSchedulingPriorityProvider{priorities: map[string]int32{"t1": 1000, "t2": 100}},
+	})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 6, "t3": 0}) {
+		t.Fatalf("high priority subsets should be satisfied first, got %v", *next)
+	}
+
+	replicas := int32(20)
+	ud.Spec.Replicas = &replicas
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 8, "t3": 8}) {
+		t.Fatalf("low priority subsets should receive the rest, got %v", *next)
+	}
+}
+
+func TestOverflowOrder(t *testing.T) {
+	ud := createUnitedDeployment(5,
+		appsv1alpha1.Subset{Name: "o2"},
+		appsv1alpha1.Subset{Name: "p1"},
+		appsv1alpha1.Subset{Name: "o1"},
+		appsv1alpha1.Subset{Name: "p2"},
+	)
+	ud.Spec.Topology.OverflowOrder = []string{"o1", "o2"}
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"p1": 3, "p2": 3, "o1": 2}}})
+
+	for _, c := range []struct {
+		replicas int32
+		expected map[string]int32
+	}{
+		{replicas: 5, expected: map[string]int32{"p1": 2, "p2": 3, "o1": 0, "o2": 0}},
+		{replicas: 7, expected: map[string]int32{"p1": 3, "p2": 3, "o1": 1, "o2": 0}},
+		{replicas: 12, expected: map[string]int32{"p1": 3, "p2": 3, "o1": 2, "o2": 4}},
+	} {
+		replicas := c.replicas
+		ud.Spec.Replicas = &replicas
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("replicas %d: expected %v, got %v", c.replicas, c.expected, *next)
+		}
+	}
+}
+
+func TestAllSubsetsUnavailable(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.ReservedEmptySubset = "t3"
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 6, "t2": 4})
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 0, "t2": 0}}})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != errAllSubsetsUnavailable {
+		t.Fatalf("expected error %v, got %v", errAllSubsetsUnavailable, err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 6, "t2": 4, "t3": 0}) {
+		t.Fatalf("current replicas should be kept, got %v", *next)
+	}
+
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 0}}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 0, "t2": 10, "t3": 0}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+}
+
+func TestExternalSubsetTargets(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 5, "t2": 5})
+
+	for name, c := range map[string]struct {
+		store    *fakeSubsetTargetStore
+		expected map[string]int32
+	}{
+		"valid targets": {
+			store:    &fakeSubsetTargetStore{targets: map[string]int32{"t1": 8, "t2": 2}},
+			expected: map[string]int32{"t1": 8, "t2": 2},
+		},
+		"targets not summing to replicas": {
+			store:    &fakeSubsetTargetStore{targets: map[string]int32{"t1": 8, "t2": 3}},
+			expected: map[string]int32{"t1": 5, "t2": 5},
+		},
+		"targets missing subsets": {
+			store:    &fakeSubsetTargetStore{targets: map[string]int32{"t1": 10}},
+			expected: map[string]int32{"t1": 5, "t2": 5},
+		},
+		"unreachable store": {
+			store:    &fakeSubsetTargetStore{err: fmt.Errorf("unreachable")},
+			expected: map[string]int32{"t1": 5, "t2": 5},
+		},
+	} {
+		withProviders(t, AllocationProviders{TargetStore: c.store})
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+}
+
+func TestExternalSubsetTargetsOverflow(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	// the targets would sum to 10 if they wrapped around in int32
+	targets := map[string]int32{"t1": math.MaxInt32, "t2": math.MaxInt32, "t3": 12}
+	if err := validateExternalSubsetTargets(ud, targets, 10); err == nil {
+		t.Fatalf("expected overflowing targets %v to be rejected", targets)
+	}
+}
+
+func TestMaxCostBudget(t *testing.T) {
+	t3Replicas := intstr.FromInt(1)
+	ud := createUnitedDeployment(12,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3", Replicas: &t3Replicas},
+	)
+	withProviders(t, AllocationProviders{
+		Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t2": 5}},
+		Cost:     &fakeSubsetCostProvider{costs: map[string]int32{"t1": 3, "t2": 1, "t3": 2}},
+	})
+
+	for _, c := range []struct {
+		budget      int32
+		expected    map[string]int32
+		unallocated int32
+	}{
+		{budget: 100, expected: map[string]int32{"t1": 6, "t2": 5, "t3": 1}},
+		{budget: 25, expected: map[string]int32{"t1": 6, "t2": 5, "t3": 1}},
+		{budget: 20, expected: map[string]int32{"t1": 4, "t2": 5, "t3": 1}, unallocated: 2},
+		{budget: 5, expected: map[string]int32{"t1": 0, "t2": 3, "t3": 1}, unallocated: 8},
+	} {
+		budget := c.budget
+		ud.Spec.Topology.MaxCostBudget = &budget
+
+		infos, err := getSubsetInfos(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		allocator := infos.SortToAllocator()
+		configureAllocator(allocator, ud)
+		specified, err := getSpecifiedSubsetReplicas(ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		allocator.normalAllocate(12, specified)
+		if unallocated := allocator.fitCostBudget(); unallocated != c.unallocated {
+			t.Fatalf("budget %d: expected %d unallocated replicas, got %d", c.budget, c.unallocated, unallocated)
+		}
+		if next := allocator.toSubsetReplicaMap(); !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("budget %d: expected %v, got %v", c.budget, c.expected, *next)
+		}
+	}
+}
+
+func TestInitialStrategy(t *testing.T) {
+	withProviders(t, AllocationProviders{Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t2": 4}}})
+
+	for strategy, initial := range map[appsv1alpha1.InitialStrategyType]map[string]int32{
+		appsv1alpha1.EvenInitialStrategyType:         {"t1": 0, "t2": 3, "t3": 3},
+		appsv1alpha1.SingleSubsetInitialStrategyType: {"t1": 0, "t2": 4, "t3": 0},
+		appsv1alpha1.OrderedInitialStrategyType:      {"t1": 0, "t2": 4, "t3": 2},
+	} {
+		t1Replicas := intstr.FromInt(0)
+		ud := createUnitedDeployment(6,
+			appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas},
+			appsv1alpha1.Subset{Name: "t2"},
+			appsv1alpha1.Subset{Name: "t3"},
+		)
+		ud.Spec.Topology.InitialStrategy = strategy
+
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", strategy, err)
+		}
+		if !reflect.DeepEqual(*next, initial) {
+			t.Fatalf("%s: expected first allocation %v, got %v", strategy, initial, *next)
+		}
+
+		ud.Status.SubsetReplicas = *next
+		next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(*next), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", strategy, err)
+		}
+		if expected := map[string]int32{"t1": 0, "t2": 3, "t3": 3}; !reflect.DeepEqual(*next, expected) {
+			t.Fatalf("%s: expected later allocation %v, got %v", strategy, expected, *next)
+		}
+	}
+}
+
+func TestNodeWarmup(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	origin := stabilizationClock
+	stabilizationClock = fakeClock
+	defer func() {
+		stabilizationClock = origin
+	}()
+
+	ud := createUnitedDeployment(9, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	warmup := int32(60)
+	ud.Spec.Topology.NodeWarmupSeconds = &warmup
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 2, "t3": 2})
+	withProviders(t, AllocationProviders{NodeProvisioning: &fakeNodeProvisioningProvider{
+		additionTimes: map[string]metav1.Time{"t1": metav1.NewTime(fakeClock.Now().Add(-30 * time.Second))},
+	}})
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 2, "t2": 3, "t3": 4}) {
+		t.Fatalf("subset with new nodes should not be scaled out, got %v", *next)
+	}
+
+	fakeClock.Step(30 * time.Second)
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 3}) {
+		t.Fatalf("subset should be scaled out after warming up, got %v", *next)
+	}
+}
+
+func TestMemoryHeadroomWeighting(t *testing.T) {
+	const gi = int64(1) << 30
+	ud := createUnitedDeployment(20, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	withProviders(t, AllocationProviders{MemoryHeadroom: &fakeMemoryHeadroomProvider{}})
+	ud.Spec.Topology.MemoryHeadroomWeighting = &appsv1alpha1.MemoryHeadroomWeighting{}
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 6, "t2": 7, "t3": 7}) {
+		t.Fatalf("replicas should be averaged without memory headroom, got %v", *next)
+	}
+
+	withProviders(t, AllocationProviders{MemoryHeadroom: &fakeMemoryHeadroomProvider{headroom: map[string]int64{"t1": 64 * gi, "t2": 32 * gi, "t3": 4 * gi}}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 13, "t2": 6, "t3": 1}) {
+		t.Fatalf("replicas should be proportional to memory headroom, got %v", *next)
+	}
+
+	minShare, maxShare := int32(10), int32(50)
+	ud.Spec.Topology.MemoryHeadroomWeighting = &appsv1alpha1.MemoryHeadroomWeighting{MinSharePercent: &minShare, MaxSharePercent: &maxShare}
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 11, "t2": 7, "t3": 2}) {
+		t.Fatalf("shares by memory headroom should be clamped, got %v", *next)
+	}
+}
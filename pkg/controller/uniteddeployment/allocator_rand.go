@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// allocationRand is the source of randomness for the randomized tie-breaks of allocation. It is seeded by
+// the time the controller starts, unless overridden by setAllocationRandSeed in tests.
+var allocationRand = &lockedRand{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// lockedRand is a rand.Rand safe for the concurrent reconciles.
+type lockedRand struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// Intn returns a non-negative pseudo-random number in [0, n).
+func (r *lockedRand) Intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Intn(n)
+}
+
+// Shuffle pseudo-randomizes the order of n elements with swap.
+func (r *lockedRand) Shuffle(n int, swap func(i, j int)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rand.Shuffle(n, swap)
+}
+
+// setAllocationRandSeed reseeds allocationRand, so that the randomized allocation is reproducible in tests.
+func setAllocationRandSeed(seed int64) {
+	allocationRand.lock.Lock()
+	defer allocationRand.lock.Unlock()
+	allocationRand.rand = rand.New(rand.NewSource(seed))
+}
+
+// shuffleSubsets pseudo-randomizes the order of subsets, which breaks the ties among them fairly over reconciles.
+func shuffleSubsets(subsets []*nameToReplicas) {
+	allocationRand.Shuffle(len(subsets), func(i, j int) {
+		subsets[i], subsets[j] = subsets[j], subsets[i]
+	})
+}
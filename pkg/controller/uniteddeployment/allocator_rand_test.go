@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocationRandSeed(t *testing.T) {
+	shuffled := func() []string {
+		subsets := []*nameToReplicas{createSubset("t1", 0), createSubset("t2", 0), createSubset("t3", 0), createSubset("t4", 0)}
+		shuffleSubsets(subsets)
+		var names []string
+		for _, subset := range subsets {
+			names = append(names, subset.SubsetName)
+		}
+		return names
+	}
+
+	setAllocationRandSeed(42)
+	first := []interface{}{shuffled(), allocationRand.Intn(100)}
+	setAllocationRandSeed(42)
+	second := []interface{}{shuffled(), allocationRand.Intn(100)}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("expected reproducible output under a fixed seed, got %v and %v", first, second)
+	}
+}
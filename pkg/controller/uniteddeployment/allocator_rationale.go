@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// allocationRationale indicates whether to explain why each subset gets its replicas. The rationale is logged
+// at V(4) and returned in AllocationResult.Rationale.
+var allocationRationale = false
+
+// newAllocationRationale returns an empty rationale if allocationRationale is enabled, or nil.
+func newAllocationRationale() map[string]string {
+	if !allocationRationale {
+		return nil
+	}
+	return map[string]string{}
+}
+
+// explain records the rationale of the replicas allocated to the subset. It does nothing if the rationale is nil.
+func (s *replicasAllocator) explain(subsetName, format string, args ...interface{}) {
+	if s.rationale != nil {
+		s.rationale[subsetName] = fmt.Sprintf(format, args...)
+	}
+}
+
+// explainAverage records the rationale of the unspecified subsets sharing the replicas averagely, telling how
+// far each subset is from the even share rounded down, or that it is capped at its max replicas, or held at its
+// current replicas since it is protected.
+func (s *replicasAllocator) explainAverage(unspecified []*nameToReplicas, replicas int32) {
+	if s.rationale == nil || len(unspecified) == 0 {
+		return
+	}
+
+	average := replicas / int32(len(unspecified))
+	for _, subset := range unspecified {
+		if bound := subset.upperBound(); bound != nil && subset.Replicas == *bound && *bound < average {
+			s.explain(subset.SubsetName, "capped at max")
+		} else if floor := subset.MinReplicas; floor != nil && subset.Replicas == *floor && *floor > average {
+			s.explain(subset.SubsetName, "protected")
+		} else if subset.Replicas > average {
+			s.explain(subset.SubsetName, "average+%d", subset.Replicas-average)
+		} else {
+			s.explain(subset.SubsetName, "average")
+		}
+	}
+}
+
+// explainAll records the same rationale for all the subsets in next.
+func explainAll(next *map[string]int32, label string) map[string]string {
+	if !allocationRationale || next == nil {
+		return nil
+	}
+
+	rationale := make(map[string]string, len(*next))
+	for name := range *next {
+		rationale[name] = label
+	}
+	return rationale
+}
+
+// explainChanges appends the label and the new replicas to the rationale of the subsets whose replicas are
+// changed from before to after, e.g. "average+1, smoothed=4". It does nothing if the rationale is nil.
+func explainChanges(rationale map[string]string, before, after *map[string]int32, label string) {
+	if rationale == nil || before == nil || after == nil {
+		return
+	}
+
+	for name, replicas := range *after {
+		if previous, exist := (*before)[name]; exist && previous == replicas {
+			continue
+		}
+		if rationale[name] == "" {
+			rationale[name] = fmt.Sprintf("%s=%d", label, replicas)
+		} else {
+			rationale[name] = fmt.Sprintf("%s, %s=%d", rationale[name], label, replicas)
+		}
+	}
+}
+
+// explainAllocation returns a line for each subset in next sorted by name, telling its replicas and the rationale
+// of them if any. It returns an empty string if next is nil.
+func explainAllocation(next *map[string]int32, rationale map[string]string) string {
+	if next == nil {
+		return ""
+	}
+
+	lines := make([]string, 0, len(*next))
+	for _, name := range sortedSubsetNames(next) {
+		if reason := rationale[name]; reason != "" {
+			lines = append(lines, fmt.Sprintf("%s: %d (%s)", name, (*next)[name], reason))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %d", name, (*next)[name]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestAllocationRationale(t *testing.T) {
+	origin := allocationRationale
+	defer func() {
+		allocationRationale = origin
+	}()
+	withAllocationStrategy(t, "FirstSubset", firstSubsetAllocator{})
+
+	three := intstr.FromInt(3)
+	cases := []struct {
+		name      string
+		ud        func() *appsv1alpha1.UnitedDeployment
+		current   map[string]int32
+		rationale map[string]string
+	}{
+		{
+			name: "specified and average",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				return createUnitedDeployment(10,
+					appsv1alpha1.Subset{Name: "t1", Replicas: &three},
+					appsv1alpha1.Subset{Name: "t2"},
+					appsv1alpha1.Subset{Name: "t3"},
+					appsv1alpha1.Subset{Name: "t4"},
+				)
+			},
+			rationale: map[string]string{"t1": "specified=3", "t2": "average", "t3": "average", "t4": "average+1"},
+		},
+		{
+			name: "capped at max",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				return createUnitedDeployment(10,
+					appsv1alpha1.Subset{Name: "t1"},
+					appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(1)},
+					appsv1alpha1.Subset{Name: "t3"},
+				)
+			},
+			rationale: map[string]string{"t1": "average+1", "t2": "capped at max", "t3": "average+2"},
+		},
+		{
+			name: "catch-all",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				return createUnitedDeployment(10,
+					appsv1alpha1.Subset{Name: "t1", Replicas: &three},
+					appsv1alpha1.Subset{Name: "t2"},
+					appsv1alpha1.Subset{Name: "t3", CatchAll: true},
+				)
+			},
+			rationale: map[string]string{"t1": "specified=3", "t2": "average", "t3": "catch-all"},
+		},
+		{
+			name: "weighted",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+				ud.Spec.Topology.PreferredWeights = map[string]int32{"t1": 1, "t2": 4}
+				return ud
+			},
+			rationale: map[string]string{"t1": "weighted", "t2": "weighted"},
+		},
+		{
+			name: "strategy",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+				ud.Spec.Topology.AllocationStrategy = "FirstSubset"
+				return ud
+			},
+			rationale: map[string]string{"t1": "strategy=FirstSubset", "t2": "strategy=FirstSubset"},
+		},
+		{
+			name: "scale-in limited",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				ud := createUnitedDeployment(4,
+					appsv1alpha1.Subset{Name: "t1", MaxScaleInPercent: int32Ptr(50)},
+					appsv1alpha1.Subset{Name: "t2"},
+				)
+				ud.Status.SubsetReplicas = map[string]int32{"t1": 10, "t2": 10}
+				return ud
+			},
+			current:   map[string]int32{"t1": 10, "t2": 10},
+			rationale: map[string]string{"t1": "average, scale-in limited=5", "t2": "average"},
+		},
+		{
+			name: "headroom reserved",
+			ud: func() *appsv1alpha1.UnitedDeployment {
+				ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+				ud.Spec.Topology.HeadroomPercent = int32Ptr(20)
+				return ud
+			},
+			current:   map[string]int32{"t1": 4, "t2": 4},
+			rationale: map[string]string{"t1": "average, headroom reserved=2", "t2": "average, headroom reserved=2"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			allocationRationale = true
+			result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), c.ud())
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(result.Rationale, c.rationale) {
+				t.Fatalf("expected rationale %v, got %v for replicas %v", c.rationale, result.Rationale, *result.SubsetReplicas)
+			}
+
+			allocationRationale = false
+			if result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), c.ud()); result.Rationale != nil {
+				t.Fatalf("expected no rationale unless enabled, got %v", result.Rationale)
+			}
+		})
+	}
+}
+
+func TestAllocationExplanation(t *testing.T) {
+	origin := allocationRationale
+	defer func() {
+		allocationRationale = origin
+	}()
+
+	four := intstr.FromInt(4)
+	ud := createUnitedDeployment(11,
+		appsv1alpha1.Subset{Name: "zone-a", Replicas: &four},
+		appsv1alpha1.Subset{Name: "zone-b"},
+		appsv1alpha1.Subset{Name: "zone-c"},
+	)
+
+	allocationRationale = true
+	result := GetAllocationResult(context.TODO(), &map[string]*Subset{}, ud)
+	expected := "zone-a: 4 (specified=4)\nzone-b: 3 (average)\nzone-c: 4 (average+1)"
+	if explanation := result.Explain(); explanation != expected {
+		t.Fatalf("expected explanation %q, got %q", expected, explanation)
+	}
+
+	allocationRationale = false
+	result = GetAllocationResult(context.TODO(), &map[string]*Subset{}, ud)
+	expected = "zone-a: 4\nzone-b: 3\nzone-c: 4"
+	if explanation := result.Explain(); explanation != expected {
+		t.Fatalf("expected explanation without rationale %q, got %q", expected, explanation)
+	}
+}
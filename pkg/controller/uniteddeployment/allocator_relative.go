@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"math"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// ValidateRelativeReplicas checks the references of Subset.RelativeTo. It returns an error if a subset refers
+// to an unknown subset, or the references form a cycle.
+func ValidateRelativeReplicas(ud *appsv1alpha1.UnitedDeployment) error {
+	known := sets.NewString()
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		known.Insert(subsetDef.Name)
+	}
+	references := getRelativeReferences(ud)
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.RelativeTo == nil {
+			continue
+		}
+		if !known.Has(subsetDef.RelativeTo.Subset) {
+			return newAllocationError(InvalidRelativeReplicasAllocationReason, "subset %s is relative to subset %s which is not in the topology",
+				subsetDef.Name, subsetDef.RelativeTo.Subset)
+		}
+
+		// each subset refers to one subset at most, so following the references either ends, comes back to
+		// this subset, or runs into a cycle of other subsets which is reported from one of them
+		path := []string{subsetDef.Name}
+		for ref := references[subsetDef.Name]; ref != nil && len(path) <= len(ud.Spec.Topology.Subsets); ref = references[ref.Subset] {
+			path = append(path, ref.Subset)
+			if ref.Subset == subsetDef.Name {
+				return newAllocationError(InvalidRelativeReplicasAllocationReason, "replicas of subsets are relative to each other in a cycle %s",
+					strings.Join(path, " -> "))
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRelativeReplicas specifies the replicas of the subsets relative to other subsets in replicaLimits, following
+// the references down to a subset whose replicas are specified. The subsets already in replicaLimits, e.g. frozen
+// ones, are kept as they are. It returns an error if the references are invalid, or end in a subset whose replicas
+// are not specified.
+func resolveRelativeReplicas(ud *appsv1alpha1.UnitedDeployment, replicaLimits map[string]int32) error {
+	if err := ValidateRelativeReplicas(ud); err != nil {
+		return err
+	}
+
+	references := getRelativeReferences(ud)
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if _, specified := replicaLimits[subsetDef.Name]; specified || subsetDef.RelativeTo == nil {
+			continue
+		}
+
+		// collect the unresolved subsets down the references, then resolve them from the bottom up
+		path := []string{subsetDef.Name}
+		for {
+			last := path[len(path)-1]
+			target := references[last].Subset
+			if _, specified := replicaLimits[target]; specified {
+				break
+			}
+			if references[target] == nil {
+				return newAllocationError(InvalidRelativeReplicasAllocationReason, "subset %s is relative to subset %s whose replicas are not specified",
+					last, target)
+			}
+			path = append(path, target)
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			ref := references[path[i]]
+			replicaLimits[path[i]] = int32(math.Floor(float64(replicaLimits[ref.Subset])*float64(ref.RatioPercent)/100 + 0.5))
+		}
+	}
+	return nil
+}
+
+// getRelativeReferences returns a mapping from the name of each subset relative to another subset to its reference.
+func getRelativeReferences(ud *appsv1alpha1.UnitedDeployment) map[string]*appsv1alpha1.RelativeReplicas {
+	references := map[string]*appsv1alpha1.RelativeReplicas{}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		if subsetDef.RelativeTo != nil {
+			references[subsetDef.Name] = subsetDef.RelativeTo
+		}
+	}
+	return references
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestRelativeReplicas(t *testing.T) {
+	five, eight := intstr.FromInt(5), intstr.FromInt(8)
+	relativeTo := func(subset string, ratioPercent int32) *appsv1alpha1.RelativeReplicas {
+		return &appsv1alpha1.RelativeReplicas{Subset: subset, RatioPercent: ratioPercent}
+	}
+
+	cases := []struct {
+		name        string
+		replicas    int32
+		subsets     []appsv1alpha1.Subset
+		annotations map[string]string
+		current     map[string]int32
+		expected    map[string]int32
+		reason      AllocationReasonCode
+	}{
+		{
+			name:     "half of a specified subset",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &eight}, {Name: "t2", RelativeTo: relativeTo("t1", 25)}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 8, "t2": 2, "t3": 0},
+		},
+		{
+			name:     "two-node reference chain",
+			replicas: 20,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", RelativeTo: relativeTo("t2", 50)},
+				{Name: "t2", RelativeTo: relativeTo("t3", 50)},
+				{Name: "t3", Replicas: &eight},
+				{Name: "t4"},
+			},
+			expected: map[string]int32{"t1": 2, "t2": 4, "t3": 8, "t4": 6},
+		},
+		{
+			name:     "ratio rounded half up",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &five}, {Name: "t2", RelativeTo: relativeTo("t1", 50)}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 5, "t2": 3, "t3": 2},
+		},
+		{
+			name:     "relative replicas over the total",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &eight}, {Name: "t2", RelativeTo: relativeTo("t1", 50)}},
+			reason:   OverSpecifiedAllocationReason,
+		},
+		{
+			name:        "frozen relative subset is kept",
+			replicas:    10,
+			subsets:     []appsv1alpha1.Subset{{Name: "t1", Replicas: &eight}, {Name: "t2", RelativeTo: relativeTo("t1", 50)}, {Name: "t3"}},
+			annotations: map[string]string{appsv1alpha1.AnnotationFrozenSubsets: "t2"},
+			current:     map[string]int32{"t1": 8, "t2": 1, "t3": 1},
+			expected:    map[string]int32{"t1": 8, "t2": 1, "t3": 1},
+		},
+		{
+			name:     "cyclic reference",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", RelativeTo: relativeTo("t2", 50)},
+				{Name: "t2", RelativeTo: relativeTo("t1", 200)},
+				{Name: "t3"},
+			},
+			reason: InvalidRelativeReplicasAllocationReason,
+		},
+		{
+			name:     "reference to an unspecified subset",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", RelativeTo: relativeTo("t2", 50)}, {Name: "t2"}},
+			reason:   InvalidRelativeReplicasAllocationReason,
+		},
+		{
+			name:     "reference to an unknown subset",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", RelativeTo: relativeTo("unknown", 50)}, {Name: "t2"}},
+			reason:   InvalidRelativeReplicasAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			ud.Annotations = c.annotations
+			ud.Status.SubsetReplicas = c.current
+			result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), ud)
+			if c.reason != "" {
+				if result.Effective || result.ReasonCode != c.reason {
+					t.Fatalf("expected ineffective allocation of reason %s, got %+v", c.reason, result)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+		})
+	}
+}
+
+func TestValidateRelativeReplicasCycle(t *testing.T) {
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", RelativeTo: &appsv1alpha1.RelativeReplicas{Subset: "t2", RatioPercent: 50}},
+		appsv1alpha1.Subset{Name: "t2", RelativeTo: &appsv1alpha1.RelativeReplicas{Subset: "t3", RatioPercent: 50}},
+		appsv1alpha1.Subset{Name: "t3", RelativeTo: &appsv1alpha1.RelativeReplicas{Subset: "t2", RatioPercent: 50}},
+	)
+	err := ValidateRelativeReplicas(ud)
+	if allocationReasonOf(err) != InvalidRelativeReplicasAllocationReason {
+		t.Fatalf("expected the cycle to be reported, got %v", err)
+	}
+	if expected := "replicas of subsets are relative to each other in a cycle t2 -> t3 -> t2"; err.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, err.Error())
+	}
+}
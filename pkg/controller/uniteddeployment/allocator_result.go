@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// AllocationReasonCode is a machine-readable code telling why an allocation is ineffective.
+type AllocationReasonCode string
+
+const (
+	// OverSpecifiedAllocationReason means the specified replicas of subsets sum to more than the replicas
+	// of the UnitedDeployment.
+	OverSpecifiedAllocationReason AllocationReasonCode = "OverSpecified"
+	// UnderSpecifiedAllocationReason means the replicas of all subsets are specified, but they sum to less than
+	// the replicas of the UnitedDeployment.
+	UnderSpecifiedAllocationReason AllocationReasonCode = "UnderSpecified"
+	// SpecifiedOutOfBoundsAllocationReason means the specified replicas of a subset are out of its min or max replicas.
+	SpecifiedOutOfBoundsAllocationReason AllocationReasonCode = "SpecifiedOutOfBounds"
+	// UnknownSubsetAllocationReason means replicas are specified for a subset which is not in the topology.
+	UnknownSubsetAllocationReason AllocationReasonCode = "UnknownSubset"
+	// UnspecifiedSubsetsDrainedAllocationReason means Topology.MinReplicasPerSubset is set, but the replicas left by
+	// the specified subsets could not give each unspecified subset at least one replica.
+	UnspecifiedSubsetsDrainedAllocationReason AllocationReasonCode = "UnspecifiedSubsetsDrained"
+	// ProtectedSubsetsAllocationReason means the replicas left by the specified subsets are less than the current
+	// replicas of the protected subsets, so the scale-in could not be done without shrinking them.
+	ProtectedSubsetsAllocationReason AllocationReasonCode = "ProtectedSubsets"
+	// NoSubsetsAllocationReason means the topology declares no subsets, so the replicas of the UnitedDeployment
+	// could not be placed anywhere.
+	NoSubsetsAllocationReason AllocationReasonCode = "NoSubsets"
+	// DuplicateSubsetAllocationReason means more than one subset of the same name is declared in the topology.
+	DuplicateSubsetAllocationReason AllocationReasonCode = "DuplicateSubset"
+	// MultipleCatchAllAllocationReason means more than one subset is marked as catch-all.
+	MultipleCatchAllAllocationReason AllocationReasonCode = "MultipleCatchAll"
+	// InvalidReplicasOverrideAllocationReason means the subset replicas override annotation is malformed.
+	InvalidReplicasOverrideAllocationReason AllocationReasonCode = "InvalidReplicasOverride"
+	// FrozenSubsetsAllocationReason means the subsets frozen at their current replicas leave the others unable
+	// to take the rest of the replicas of the UnitedDeployment.
+	FrozenSubsetsAllocationReason AllocationReasonCode = "FrozenSubsets"
+	// InvalidRelativeReplicasAllocationReason means the references of Subset.RelativeTo are unknown, form a cycle,
+	// or end in a subset whose replicas are not specified.
+	InvalidRelativeReplicasAllocationReason AllocationReasonCode = "InvalidRelativeReplicas"
+	// MaxSkewExceededAllocationReason means the replicas of the unspecified subsets differ more than Topology.MaxSkew,
+	// and the max or min replicas of subsets do not allow to move replicas to reduce the difference.
+	MaxSkewExceededAllocationReason AllocationReasonCode = "MaxSkewExceeded"
+	// InsufficientNonEmptySubsetsAllocationReason means the replicas could not be spread across
+	// Topology.MinNonEmptySubsets subsets, since there are too few replicas or subsets, or the bounds of subsets do not allow.
+	InsufficientNonEmptySubsetsAllocationReason AllocationReasonCode = "InsufficientNonEmptySubsets"
+	// AllCappedAllocationReason means some replicas can not be placed, since all subsets have reached their max replicas.
+	AllCappedAllocationReason AllocationReasonCode = "AllCapped"
+	// AllSubsetsUnavailableAllocationReason means none of the subsets could hold any replica, so the subsets are
+	// kept at their current replicas.
+	AllSubsetsUnavailableAllocationReason AllocationReasonCode = "AllSubsetsUnavailable"
+	// NoLastStableReplicasAllocationReason means a subset specified to last-stable has no replicas recorded yet.
+	NoLastStableReplicasAllocationReason AllocationReasonCode = "NoLastStableReplicas"
+	// StrategyIneffectiveAllocationReason means the allocation strategy chosen by Topology.AllocationStrategy
+	// could not allocate the replicas, or returns replicas violating the specified replicas or bounds of subsets.
+	StrategyIneffectiveAllocationReason AllocationReasonCode = "StrategyIneffective"
+	// PausedAllocationReason means the UnitedDeployment is paused, so the current replicas of subsets are returned
+	// as they are. The allocation is still effective.
+	PausedAllocationReason AllocationReasonCode = "Paused"
+	// CancelledAllocationReason means the context of the allocation is cancelled or has expired before it is done,
+	// e.g. since the controller is shutting down.
+	CancelledAllocationReason AllocationReasonCode = "Cancelled"
+	// UnknownAllocationReason is the code of the other failures.
+	UnknownAllocationReason AllocationReasonCode = "Unknown"
+)
+
+// AllocationResult is the result of an allocation of replicas to subsets.
+type AllocationResult struct {
+	// SubsetReplicas is a mapping from subset name to its next replicas. It may be set even if the allocation
+	// is ineffective, e.g. to the current replicas of subsets for AllSubsetsUnavailable.
+	SubsetReplicas *map[string]int32
+	// Effective is false if the allocation could not be done as the UnitedDeployment indicates.
+	Effective bool
+	// ReasonCode and Message tell why the allocation is ineffective, or that the UnitedDeployment is paused.
+	ReasonCode AllocationReasonCode
+	Message    string
+	// Rationale is a mapping from subset name to the labels telling why it gets its replicas, such as "specified=3",
+	// "average+1" or "capped at max". It is set only if the allocation rationale of the controller is enabled.
+	Rationale map[string]string
+	// SpecifiedSubsets is the names of the subsets whose replicas are specified, sorted by name.
+	SpecifiedSubsets []string
+	// SpecifiedAdjustments is a mapping from subset name to the adjustment of its specified replicas, which is set
+	// only if the schedule strategy is BestEffort and the specified replicas do not fit as they are.
+	SpecifiedAdjustments map[string]SpecifiedReplicasAdjustment
+	// PinnedSubsets is a mapping from the name of each subset pinned at a boundary to the constraint pinning it,
+	// which is "max", "min" or "skew". It is set only if the replicas are allocated by the allocator itself.
+	PinnedSubsets map[string]string
+	// ChurnRatio is the ratio of the replicas relocated between subsets from their current replicas, as computed
+	// by ChurnRatio. It is 0 if there are no next replicas.
+	ChurnRatio float64
+
+	err error
+}
+
+// AllocationPlan is the JSON form of an AllocationResult for external tooling. Its field names are kept stable.
+type AllocationPlan struct {
+	// Subsets is the allocated replicas of each subset, sorted by subset name.
+	Subsets []SubsetAllocationPlan `json:"subsets"`
+	// Effective is false if the allocation could not be done as the UnitedDeployment indicates.
+	Effective bool `json:"effective"`
+	// Reason is the AllocationReasonCode telling why the allocation is ineffective, or empty if it is effective
+	// unless the UnitedDeployment is paused.
+	Reason AllocationReasonCode `json:"reason"`
+}
+
+// SubsetAllocationPlan is the allocated replicas of a subset in an AllocationPlan.
+type SubsetAllocationPlan struct {
+	// Name is the name of the subset.
+	Name string `json:"name"`
+	// Replicas is the next replicas of the subset.
+	Replicas int32 `json:"replicas"`
+	// Specified is true if the replicas of the subset are specified rather than allocated.
+	Specified bool `json:"specified"`
+}
+
+// Plan returns the AllocationPlan of the result.
+func (r *AllocationResult) Plan() AllocationPlan {
+	plan := AllocationPlan{Subsets: []SubsetAllocationPlan{}, Effective: r.Effective, Reason: r.ReasonCode}
+	if r.SubsetReplicas == nil {
+		return plan
+	}
+
+	specified := map[string]bool{}
+	for _, name := range r.SpecifiedSubsets {
+		specified[name] = true
+	}
+	for name, replicas := range *r.SubsetReplicas {
+		plan.Subsets = append(plan.Subsets, SubsetAllocationPlan{Name: name, Replicas: replicas, Specified: specified[name]})
+	}
+	sort.Slice(plan.Subsets, func(i, j int) bool {
+		return plan.Subsets[i].Name < plan.Subsets[j].Name
+	})
+	return plan
+}
+
+// MarshalPlan returns the AllocationPlan of the result in JSON, which could be parsed by external tooling
+// instead of the output of replicasAllocator.String.
+func (r *AllocationResult) MarshalPlan() ([]byte, error) {
+	return json.Marshal(r.Plan())
+}
+
+// Explain returns why each subset gets its replicas in lines sorted by subset name, such as "t1: 4 (specified=4)"
+// and "t2: 3 (average+1)", which is readable in the output of kubectl describe. The reasons are taken from
+// Rationale, so only the replicas are told if the allocation rationale of the controller is disabled.
+func (r *AllocationResult) Explain() string {
+	return explainAllocation(r.SubsetReplicas, r.Rationale)
+}
+
+// allocationError is an error of allocation carrying its reason code.
+type allocationError struct {
+	reason  AllocationReasonCode
+	message string
+	// cause is the error which the allocation error results from, if any.
+	cause error
+}
+
+func (e *allocationError) Error() string {
+	return e.message
+}
+
+func (e *allocationError) Unwrap() error {
+	return e.cause
+}
+
+func newAllocationError(reason AllocationReasonCode, format string, args ...interface{}) error {
+	return &allocationError{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// allocationCancelled returns an error of CancelledAllocationReason wrapping the error of the context if it is
+// cancelled or has expired, or nil otherwise.
+func allocationCancelled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &allocationError{reason: CancelledAllocationReason, message: fmt.Sprintf("allocation is cancelled: %v", err), cause: err}
+	}
+	return nil
+}
+
+// allocationReasonOf returns the reason code of the error returned by an allocation.
+func allocationReasonOf(err error) AllocationReasonCode {
+	allocationErr := &allocationError{}
+	if errors.As(err, &allocationErr) {
+		return allocationErr.reason
+	}
+	return UnknownAllocationReason
+}
+
+func newAllocationResult(subsetReplicas *map[string]int32, err error) *AllocationResult {
+	result := &AllocationResult{SubsetReplicas: subsetReplicas, Effective: err == nil, err: err}
+	if err != nil {
+		result.ReasonCode = allocationReasonOf(err)
+		result.Message = err.Error()
+	}
+	return result
+}
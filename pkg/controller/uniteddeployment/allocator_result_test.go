@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestMarshalAllocationPlan(t *testing.T) {
+	three := intstr.FromInt(3)
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t2", Replicas: &three},
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	data, err := result.MarshalPlan()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectedJSON := `{"subsets":[{"name":"t1","replicas":3,"specified":false},{"name":"t2","replicas":3,"specified":true},` +
+		`{"name":"t3","replicas":4,"specified":false}],"effective":true,"reason":""}`
+	if string(data) != expectedJSON {
+		t.Fatalf("expected %s, got %s", expectedJSON, data)
+	}
+
+	plan := AllocationPlan{}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(plan, result.Plan()) {
+		t.Fatalf("expected %+v after round trip, got %+v", result.Plan(), plan)
+	}
+
+	eleven := intstr.FromInt(11)
+	ud.Spec.Topology.Subsets[0].Replicas = &eleven
+	result = GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	data, err = result.MarshalPlan()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expectedJSON := `{"subsets":[],"effective":false,"reason":"OverSpecified"}`; string(data) != expectedJSON {
+		t.Fatalf("expected %s, got %s", expectedJSON, data)
+	}
+	plan = AllocationPlan{}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(plan, result.Plan()) {
+		t.Fatalf("expected %+v after round trip, got %+v", result.Plan(), plan)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+const httpAllocationReviewTimeout = 5 * time.Second
+
+// AllocationReviewer reviews the allocation calculated for a UnitedDeployment before it is applied to the subsets,
+// so that an external policy engine can enforce its own constraints.
+type AllocationReviewer interface {
+	// Review returns whether the proposed allocation is approved, and optionally an adjusted allocation. It should
+	// give up once ctx is done.
+	Review(ctx context.Context, review *AllocationReview) (*AllocationReviewResponse, error)
+}
+
+// AllocationReview is the request body posted to the allocation review webhook.
+type AllocationReview struct {
+	Input    *AllocationInput `json:"input"`
+	Proposed map[string]int32 `json:"proposed"`
+}
+
+// AllocationReviewResponse is the response of the allocation review webhook. If Allowed is true and Replicas is set,
+// Replicas replaces the proposed allocation. It should cover the same subsets, sum to the same replicas as the proposed
+// allocation and respect the min and max replicas of each subset.
+type AllocationReviewResponse struct {
+	Allowed  bool             `json:"allowed"`
+	Reason   string           `json:"reason,omitempty"`
+	Replicas map[string]int32 `json:"replicas,omitempty"`
+}
+
+// NewHTTPAllocationReviewer returns an AllocationReviewer which posts the AllocationReview in JSON to the URL.
+func NewHTTPAllocationReviewer(url string) AllocationReviewer {
+	return &httpAllocationReviewer{url: url, client: &http.Client{Timeout: httpAllocationReviewTimeout}}
+}
+
+type httpAllocationReviewer struct {
+	url    string
+	client *http.Client
+}
+
+func (r *httpAllocationReviewer) Review(ctx context.Context, review *AllocationReview) (*AllocationReviewResponse, error) {
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	response := &AllocationReviewResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// reviewAllocation returns the proposed replicas of each subset approved by Providers.Reviewer, or the adjusted ones
+// if they move the proposed replicas between subsets within their bounds. The proposed replicas are the ones about to be applied,
+// after the smoothing and limits of the reconcile. If the review fails, times out or returns nothing, or the
+// allocation is rejected, the current distribution is kept.
+func reviewAllocation(ctx context.Context, ud *appsv1alpha1.UnitedDeployment, input *AllocationInput, proposed *map[string]int32) *map[string]int32 {
+	reviewer := providersOf(ctx).Reviewer
+	if reviewer == nil {
+		return proposed
+	}
+
+	response, err := reviewer.Review(ctx, &AllocationReview{Input: input, Proposed: *proposed})
+	if err == nil && response == nil {
+		err = fmt.Errorf("empty review response")
+	}
+	if err == nil && !response.Allowed {
+		err = fmt.Errorf("rejected: %s", response.Reason)
+	}
+	if err == nil && response.Replicas != nil {
+		if err = validateReviewedReplicas(input, *proposed, response.Replicas); err == nil {
+			return &response.Replicas
+		}
+		err = fmt.Errorf("invalid adjusted allocation: %s", err)
+	}
+	if err != nil {
+		allocationLoggerFor(ud).Error(err, "Allocation review failed, keep the current distribution")
+		current := map[string]int32{}
+		for _, subset := range input.Subsets {
+			current[subset.Name] = subset.CurrentReplicas
+		}
+		return &current
+	}
+
+	return proposed
+}
+
+// validateReviewedReplicas checks the adjusted replicas cover exactly the input subsets and sum to the proposed
+// replicas, which are the step of this reconcile rather than the full target, so that an adjustment neither skips
+// the smoothing and limits of the step nor stalls it. Each subset should respect its min and max replicas, unless
+// the proposed replicas are already beyond them, in which case it should not go further.
+func validateReviewedReplicas(input *AllocationInput, proposed, adjusted map[string]int32) error {
+	if len(adjusted) != len(input.Subsets) {
+		return fmt.Errorf("adjusted allocation has %d subsets, but expected %d", len(adjusted), len(input.Subsets))
+	}
+
+	var sum, proposedSum int64
+	for _, subset := range input.Subsets {
+		replicas, exist := adjusted[subset.Name]
+		if !exist {
+			return fmt.Errorf("adjusted allocation misses subset %s", subset.Name)
+		}
+		if replicas < 0 {
+			return fmt.Errorf("replicas (%d) of subset %s is less than 0", replicas, subset.Name)
+		}
+		step := proposed[subset.Name]
+		if subset.MinReplicas != nil && replicas < *subset.MinReplicas && replicas < step {
+			return fmt.Errorf("replicas (%d) of subset %s is less than its min replicas (%d)", replicas, subset.Name, *subset.MinReplicas)
+		}
+		if subset.MaxReplicas != nil && replicas > *subset.MaxReplicas && replicas > step {
+			return fmt.Errorf("replicas (%d) of subset %s is greater than its max replicas (%d)", replicas, subset.Name, *subset.MaxReplicas)
+		}
+		sum += int64(replicas)
+		proposedSum += int64(step)
+	}
+
+	if sum != proposedSum {
+		return fmt.Errorf("sum of adjusted replicas (%d) is not the proposed replicas (%d)", sum, proposedSum)
+	}
+	return nil
+}
+
+// forgetReviewedSubsets drops the details of the allocation recorded for the subsets whose replicas are changed by
+// the review, which no longer describe them: the progress of their ramps, their rounding adjustments and their pins.
+func (status *allocationStatus) forgetReviewedSubsets(proposed, reviewed *map[string]int32) {
+	for name, replicas := range *reviewed {
+		if (*proposed)[name] == replicas {
+			continue
+		}
+		delete(status.subsetRamps, name)
+		delete(status.roundingAdjustments, name)
+		delete(status.pinnedSubsets, name)
+	}
+	if len(status.subsetRamps) == 0 {
+		status.subsetRamps = nil
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func serveFakeAllocationReviewer(t *testing.T, response *AllocationReviewResponse, delay time.Duration) (string, *AllocationReview) {
+	received := &AllocationReview{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(received); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func TestAllocationReview(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 2})
+
+	for name, c := range map[string]struct {
+		response *AllocationReviewResponse
+		delay    time.Duration
+		expected map[string]int32
+	}{
+		"approve": {
+			response: &AllocationReviewResponse{Allowed: true},
+			expected: map[string]int32{"t1": 5, "t2": 5},
+		},
+		"reject": {
+			response: &AllocationReviewResponse{Allowed: false, Reason: "quota exceeded"},
+			expected: map[string]int32{"t1": 2, "t2": 2},
+		},
+		"adjust": {
+			response: &AllocationReviewResponse{Allowed: true, Replicas: map[string]int32{"t1": 7, "t2": 3}},
+			expected: map[string]int32{"t1": 7, "t2": 3},
+		},
+		"invalid adjustment": {
+			response: &AllocationReviewResponse{Allowed: true, Replicas: map[string]int32{"t1": 7, "t2": 4}},
+			expected: map[string]int32{"t1": 2, "t2": 2},
+		},
+		"timeout": {
+			response: &AllocationReviewResponse{Allowed: true},
+			delay:    200 * time.Millisecond,
+			expected: map[string]int32{"t1": 2, "t2": 2},
+		},
+	} {
+		url, received := serveFakeAllocationReviewer(t, c.response, c.delay)
+		withProviders(t, AllocationProviders{
+			Reviewer: &httpAllocationReviewer{url: url, client: &http.Client{Timeout: 50 * time.Millisecond}},
+		})
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+		if proposed := map[string]int32{"t1": 5, "t2": 5}; !reflect.DeepEqual(received.Proposed, proposed) {
+			t.Fatalf("%s: expected proposed allocation %v, got %v", name, proposed, received.Proposed)
+		}
+	}
+}
+
+type nilAllocationReviewer struct{}
+
+func (nilAllocationReviewer) Review(_ context.Context, _ *AllocationReview) (*AllocationReviewResponse, error) {
+	return nil, nil
+}
+
+func TestAllocationReviewAfterDamping(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	alpha := int32(50)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 10, "t2": 0}
+	nameToSubset := createNameToSubset(ud.Status.SubsetReplicas)
+
+	// the adjusted replicas are applied as they are instead of being smoothed again
+	url, received := serveFakeAllocationReviewer(t, &AllocationReviewResponse{Allowed: true, Replicas: map[string]int32{"t1": 6, "t2": 4}}, 0)
+	withProviders(t, AllocationProviders{Reviewer: NewHTTPAllocationReviewer(url)})
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if proposed := map[string]int32{"t1": 7, "t2": 3}; !reflect.DeepEqual(received.Proposed, proposed) {
+		t.Fatalf("expected the smoothed allocation %v to be reviewed, got %v", proposed, received.Proposed)
+	}
+	if expected := map[string]int32{"t1": 6, "t2": 4}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("expected the adjusted allocation %v, got %v", expected, *next)
+	}
+
+	withProviders(t, AllocationProviders{Reviewer: nilAllocationReviewer{}})
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, ud.Status.SubsetReplicas) {
+		t.Fatalf("expected the current distribution to be kept without a review response, got %v", *next)
+	}
+}
+
+func TestAllocationReviewAdjustsSmoothedStep(t *testing.T) {
+	ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	alpha := int32(50)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Spec.Topology.RampCurve = appsv1alpha1.LinearRampCurveType
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 12, "t2": 0, "t3": 0}
+	nameToSubset := createNameToSubset(ud.Status.SubsetReplicas)
+
+	proposed, status, err := allocateSubsetReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 8, "t2": 2, "t3": 2}; !reflect.DeepEqual(*proposed, expected) || len(status.subsetRamps) != 3 {
+		t.Fatalf("expected the ramped step %v, got %v with ramps %v", expected, *proposed, status.subsetRamps)
+	}
+
+	for name, c := range map[string]struct {
+		replicas map[string]int32
+		expected map[string]int32
+		ramps    []string
+	}{
+		"unchanged": {
+			replicas: map[string]int32{"t1": 8, "t2": 2, "t3": 2},
+			expected: map[string]int32{"t1": 8, "t2": 2, "t3": 2},
+			ramps:    []string{"t1", "t2", "t3"},
+		},
+		"moved": {
+			replicas: map[string]int32{"t1": 8, "t2": 3, "t3": 1},
+			expected: map[string]int32{"t1": 8, "t2": 3, "t3": 1},
+			ramps:    []string{"t1"},
+		},
+		"over the proposed total": {
+			replicas: map[string]int32{"t1": 8, "t2": 3, "t3": 3},
+			expected: map[string]int32{"t1": 12, "t2": 0, "t3": 0},
+			ramps:    []string{"t1", "t2", "t3"},
+		},
+	} {
+		url, _ := serveFakeAllocationReviewer(t, &AllocationReviewResponse{Allowed: true, Replicas: c.replicas}, 0)
+		withProviders(t, AllocationProviders{Reviewer: NewHTTPAllocationReviewer(url)})
+		next, status, err := allocateSubsetReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+		// the ramps of the subsets left as proposed are kept, unless the review fails
+		if c.expected["t1"] != 12 {
+			var ramps []string
+			for _, subset := range []string{"t1", "t2", "t3"} {
+				if _, exist := status.subsetRamps[subset]; exist {
+					ramps = append(ramps, subset)
+				}
+			}
+			if !reflect.DeepEqual(ramps, c.ramps) {
+				t.Fatalf("%s: expected the ramps of %v, got %v", name, c.ramps, status.subsetRamps)
+			}
+		}
+	}
+}
+
+func TestAllocationReviewCancelled(t *testing.T) {
+	url, _ := serveFakeAllocationReviewer(t, &AllocationReviewResponse{Allowed: true}, 200*time.Millisecond)
+	reviewer := NewHTTPAllocationReviewer(url)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := reviewer.Review(ctx, &AllocationReview{}); err == nil {
+		t.Fatalf("expected the review to fail once the context expires")
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("expected the review to give up with the context, but it took %v", elapsed)
+	}
+}
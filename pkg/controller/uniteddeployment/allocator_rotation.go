@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"math"
+	"sort"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// configureRotation lets the allocator rotate the replicas left over after the even split among the subsets in
+// the order of their names, starting from Status.ScaleOutCursor, if Topology.RemainderPolicy is Rotate.
+func configureRotation(allocator *replicasAllocator, ud *appsv1alpha1.UnitedDeployment) {
+	if ud.Spec.Topology.RemainderPolicy != appsv1alpha1.RotateRemainderPolicyType || len(ud.Spec.Topology.Subsets) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(ud.Spec.Topology.Subsets))
+	for _, subset := range ud.Spec.Topology.Subsets {
+		names = append(names, subset.Name)
+	}
+	sort.Strings(names)
+	allocator.rotationNames = names
+	allocator.lastScaleOutCursor = ud.Status.ScaleOutCursor % int32(len(names))
+	if allocator.lastScaleOutCursor < 0 {
+		allocator.lastScaleOutCursor = 0
+	}
+	allocator.scaleOutCursor = allocator.lastScaleOutCursor
+}
+
+// rotationRanks returns how far each subset is from the scale-out cursor in the rotation of subset names.
+func (s *replicasAllocator) rotationRanks() map[string]int32 {
+	ranks := make(map[string]int32, len(s.rotationNames))
+	count := int32(len(s.rotationNames))
+	for i, name := range s.rotationNames {
+		ranks[name] = (int32(i) - s.scaleOutCursor + count) % count
+	}
+	return ranks
+}
+
+// replicasBeforeRotation returns the current replicas of the unspecified subsets, which advanceScaleOutCursor
+// compares the allocated replicas with. It returns nil unless the replicas are rotated.
+func (s *replicasAllocator) replicasBeforeRotation(unspecified []*nameToReplicas) map[string]int32 {
+	if len(s.rotationNames) == 0 {
+		return nil
+	}
+
+	before := make(map[string]int32, len(unspecified))
+	for _, subset := range unspecified {
+		before[subset.SubsetName] = subset.Replicas
+	}
+	return before
+}
+
+// advanceScaleOutCursor moves the scale-out cursor past the farthest subset in the rotation which is scaled out
+// more than the others, i.e. gets one of the replicas left over after the even split, so that the next of them
+// goes to the following subset. The cursor stays if the subsets are scaled out evenly or scaled in.
+func (s *replicasAllocator) advanceScaleOutCursor(unspecified []*nameToReplicas, before map[string]int32) {
+	if before == nil || len(unspecified) < 2 {
+		return
+	}
+
+	minGrowth := int32(math.MaxInt32)
+	for _, subset := range unspecified {
+		if growth := subset.Replicas - before[subset.SubsetName]; growth < minGrowth {
+			minGrowth = growth
+		}
+	}
+
+	ranks := s.rotationRanks()
+	farthest := int32(-1)
+	for _, subset := range unspecified {
+		growth := subset.Replicas - before[subset.SubsetName]
+		if growth > 0 && growth > minGrowth && ranks[subset.SubsetName] > farthest {
+			farthest = ranks[subset.SubsetName]
+		}
+	}
+	if farthest >= 0 {
+		s.scaleOutCursor = (s.scaleOutCursor + farthest + 1) % int32(len(s.rotationNames))
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestScaleOutRotation(t *testing.T) {
+	var subsets []appsv1alpha1.Subset
+	even := map[string]int32{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("t%d", i)
+		subsets = append(subsets, appsv1alpha1.Subset{Name: name})
+		even[name] = 2
+	}
+
+	scaledOut := func(current, next map[string]int32) []string {
+		var names []string
+		for name, replicas := range next {
+			if replicas > current[name] {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	for name, c := range map[string]struct {
+		// successive scales out from the last allocation, or from the even replicas each time if false
+		successive bool
+	}{
+		"successive scale-outs":          {successive: true},
+		"scale-outs after each scale-in": {successive: false},
+	} {
+		landed := map[string]bool{}
+		current := even
+		var cursor int32
+		for round := 1; round <= 3; round++ {
+			replicas := int32(21)
+			if c.successive {
+				replicas = int32(20 + round)
+			} else {
+				current = even
+			}
+			ud := createUnitedDeployment(replicas, subsets...)
+			ud.Spec.Topology.RemainderPolicy = appsv1alpha1.RotateRemainderPolicyType
+			ud.Status.ScaleOutCursor = cursor
+
+			next, status, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(current), ud)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			names := scaledOut(current, *next)
+			if len(names) != 1 {
+				t.Fatalf("%s: expected a single subset scaled out in round %d, got %v", name, round, *next)
+			}
+			if landed[names[0]] {
+				t.Fatalf("%s: subset %s is scaled out again in round %d", name, names[0], round)
+			}
+			landed[names[0]] = true
+			if status.scaleOutCursor == nil {
+				t.Fatalf("%s: expected the scale-out cursor recorded", name)
+			}
+			cursor, current = *status.scaleOutCursor, *next
+		}
+		if cursor != 3 {
+			t.Fatalf("%s: expected the cursor advanced to 3, got %d", name, cursor)
+		}
+	}
+}
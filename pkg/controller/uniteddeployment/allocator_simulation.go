@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// simulateAllocation calculates the replicas each subset of the given UnitedDeployment ends up with, without
+// changing anything in the cluster. Neither the UnitedDeployment nor the subsets are modified, and neither the
+// plugin nor the reviewer of Providers is called. The result is the final target of the spec rather than the next
+// step toward it, since the smoothing, the scale-in limits and the deferred changes of each reconcile are skipped.
+func simulateAllocation(nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment) (map[string]int32, error) {
+	nextReplicas, err := GetAllocatedReplicas(withReadOnlyProviders(context.TODO()), nameToSubset, projectedUnitedDeployment(ud))
+	if err != nil {
+		return nil, err
+	}
+
+	return *nextReplicas, nil
+}
+
+// projectedUnitedDeployment returns a copy of the UnitedDeployment whose allocation is the final target of its spec.
+// The copy requests a rebalance, which bypasses the per-reconcile limits keyed on the status, and forgets the
+// replicas history, so that a scale-in is not held back by the scale down stabilization window either.
+func projectedUnitedDeployment(ud *appsv1alpha1.UnitedDeployment) *appsv1alpha1.UnitedDeployment {
+	projected := ud.DeepCopy()
+	if projected.Annotations == nil {
+		projected.Annotations = map[string]string{}
+	}
+	projected.Annotations[appsv1alpha1.AnnotationRebalanceNow] = strconv.FormatInt(projected.Generation, 10)
+	projected.Status.ReplicasHistory = nil
+	return projected
+}
+
+// PlanAllocation calculates the next replicas of each subset for the UnitedDeployment as GetAllocatedReplicas does,
+// but takes the current replicas of subsets as a plain map instead of the live subsets, so that it can be used
+// where the subsets are not at hand, e.g. in the validating webhook. It changes nothing, neither the cluster nor
+// the UnitedDeployment, and consults none of Providers, so the plan only depends on the spec and the given replicas.
+func PlanAllocation(ud *appsv1alpha1.UnitedDeployment, currentReplicas map[string]int32) (AllocationResult, error) {
+	nameToSubset := make(map[string]*Subset, len(currentReplicas))
+	for name, replicas := range currentReplicas {
+		nameToSubset[name] = &Subset{
+			Spec: SubsetSpec{
+				SubsetName: name,
+				Replicas:   replicas,
+			},
+		}
+	}
+
+	result := GetAllocationResult(withoutProviders(context.TODO()), &nameToSubset, ud)
+	return *result, result.err
+}
+
+// WhatIfSubsetChange simulates adding the subsets in add and removing the subsets named in remove from
+// the topology of the UnitedDeployment. It returns the replicas distribution of the current topology and
+// the one of the changed topology, so that the effect of a topology edit can be reviewed before applying it.
+func WhatIfSubsetChange(nameToSubset *map[string]*Subset, ud *appsv1alpha1.UnitedDeployment, add []appsv1alpha1.Subset, remove []string) (before, after map[string]int32, err error) {
+	before, err = simulateAllocation(nameToSubset, ud)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fail to simulate current topology: %s", err)
+	}
+
+	removed := sets.NewString(remove...)
+	kept := sets.String{}
+	proposed := ud.DeepCopy()
+	subsets := make([]appsv1alpha1.Subset, 0, len(proposed.Spec.Topology.Subsets)+len(add))
+	for _, subset := range proposed.Spec.Topology.Subsets {
+		if removed.Has(subset.Name) {
+			continue
+		}
+		kept.Insert(subset.Name)
+		subsets = append(subsets, subset)
+	}
+
+	for i := range add {
+		if kept.Has(add[i].Name) {
+			return nil, nil, fmt.Errorf("subset %s to add already exists in topology", add[i].Name)
+		}
+		kept.Insert(add[i].Name)
+		subsets = append(subsets, *add[i].DeepCopy())
+	}
+	proposed.Spec.Topology.Subsets = subsets
+
+	after, err = simulateAllocation(nameToSubset, proposed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fail to simulate changed topology: %s", err)
+	}
+
+	return before, after, nil
+}
+
+// ValidateTopologyEdit simulates the allocation of the proposed UnitedDeployment and checks whether the pods it
+// would remove from each subset fit in the disruptions allowed by Providers.DisruptionBudget. The pods of a subset
+// absent from the proposed topology are all considered removed. The pods removed are the ones of the final target,
+// even if the per-reconcile limits would spread the reduction over several reconciles, and neither the plugin nor the
+// reviewer of Providers is called. It returns false with the violations if the proposed edit is unsafe to apply.
+func ValidateTopologyEdit(nameToSubset *map[string]*Subset, ud, proposed *appsv1alpha1.UnitedDeployment) (safe bool, violations []string) {
+	next, err := simulateAllocation(nameToSubset, proposed)
+	if err != nil {
+		return false, []string{fmt.Sprintf("fail to simulate proposed topology: %s", err)}
+	}
+
+	allowed := getSubsetDisruptionsAllowed(context.TODO(), ud)
+	names := make([]string, 0, len(*nameToSubset))
+	for name := range *nameToSubset {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		allowance, limited := allowed[name]
+		if !limited {
+			continue
+		}
+
+		reduction := (*nameToSubset)[name].Spec.Replicas - next[name]
+		if reduction > allowance {
+			violations = append(violations, fmt.Sprintf("subset %s would lose %d pods, but only %d are allowed to be disrupted", name, reduction, allowance))
+		}
+	}
+
+	return len(violations) == 0, violations
+}
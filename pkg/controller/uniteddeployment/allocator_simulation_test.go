@@ -0,0 +1,192 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestPlanAllocation(t *testing.T) {
+	ud := createUnitedDeployment(9, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	origin := ud.DeepCopy()
+
+	result, err := PlanAllocation(ud, map[string]int32{"t1": 2, "t2": 3})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !result.Effective || !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 3, "t2": 3, "t3": 3}) {
+		t.Fatalf("unexpected plan %+v", result)
+	}
+	if !reflect.DeepEqual(ud, origin) {
+		t.Fatalf("expected UnitedDeployment unchanged")
+	}
+
+	maxReplicas := int32(2)
+	for i := range ud.Spec.Topology.Subsets {
+		ud.Spec.Topology.Subsets[i].MaxReplicas = &maxReplicas
+	}
+	result, err = PlanAllocation(ud, nil)
+	if err == nil {
+		t.Fatalf("expected error when all subsets are capped")
+	}
+	if result.Effective || result.ReasonCode != AllCappedAllocationReason || result.Message != err.Error() {
+		t.Fatalf("unexpected plan %+v", result)
+	}
+}
+
+func TestPlanAllocationWithoutProviders(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	plugin := &fakeRPCPlugin{output: map[string]int32{"t1": 10, "t2": 0}}
+	withProviders(t, AllocationProviders{
+		Plugin:      NewRPCAllocationPlugin(serveFakeRPCPlugin(t, plugin)),
+		TargetStore: &fakeSubsetTargetStore{targets: map[string]int32{"t1": 8, "t2": 2}},
+		Capacity:    &fakeCapacityProvider{capacities: map[string]int32{"t1": 1}},
+	})
+
+	result, err := PlanAllocation(ud, map[string]int32{"t1": 5, "t2": 5})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 5, "t2": 5}) {
+		t.Fatalf("expected the plan not to depend on the providers, got %v", *result.SubsetReplicas)
+	}
+	if plugin.input != nil {
+		t.Fatalf("expected the allocation plugin not to be called")
+	}
+}
+
+func TestWhatIfSubsetChange(t *testing.T) {
+	ud := createUnitedDeployment(6, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 3, "t2": 3})
+
+	before, after, err := WhatIfSubsetChange(nameToSubset, ud, []appsv1alpha1.Subset{{Name: "t3"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(before, map[string]int32{"t1": 3, "t2": 3}) {
+		t.Fatalf("unexpected before %v", before)
+	}
+	if !reflect.DeepEqual(after, map[string]int32{"t1": 2, "t2": 2, "t3": 2}) {
+		t.Fatalf("unexpected after %v", after)
+	}
+
+	before, after, err = WhatIfSubsetChange(nameToSubset, ud, nil, []string{"t2"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(before, map[string]int32{"t1": 3, "t2": 3}) {
+		t.Fatalf("unexpected before %v", before)
+	}
+	if !reflect.DeepEqual(after, map[string]int32{"t1": 6}) {
+		t.Fatalf("unexpected after %v", after)
+	}
+
+	if len(ud.Spec.Topology.Subsets) != 2 {
+		t.Fatalf("expected topology of UnitedDeployment unchanged, got %v", ud.Spec.Topology.Subsets)
+	}
+
+	if _, _, err = WhatIfSubsetChange(nameToSubset, ud, []appsv1alpha1.Subset{{Name: "t1"}}, nil); err == nil {
+		t.Fatalf("expected error when adding an existing subset")
+	}
+}
+
+type fakeAllocationReviewer struct {
+	reviews int
+}
+
+func (r *fakeAllocationReviewer) Review(_ context.Context, _ *AllocationReview) (*AllocationReviewResponse, error) {
+	r.reviews++
+	return &AllocationReviewResponse{Allowed: false, Reason: "denied"}, nil
+}
+
+func TestWhatIfSubsetChangeProjectsFinalTarget(t *testing.T) {
+	ud := createUnitedDeployment(6, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	alpha := int32(30)
+	ud.Spec.Topology.SmoothingAlphaPercent = &alpha
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3}
+	nameToSubset := createNameToSubset(ud.Status.SubsetReplicas)
+	plugin := &fakeRPCPlugin{output: map[string]int32{"t1": 6, "t2": 0}}
+	reviewer := &fakeAllocationReviewer{}
+	withProviders(t, AllocationProviders{
+		Plugin:   NewRPCAllocationPlugin(serveFakeRPCPlugin(t, plugin)),
+		Reviewer: reviewer,
+	})
+
+	_, after, err := WhatIfSubsetChange(nameToSubset, ud, []appsv1alpha1.Subset{{Name: "t3"}}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(after, map[string]int32{"t1": 2, "t2": 2, "t3": 2}) {
+		t.Fatalf("expected the projected distribution rather than a smoothed step, got %v", after)
+	}
+	if plugin.input != nil || reviewer.reviews != 0 {
+		t.Fatalf("expected neither the plugin nor the reviewer to be called")
+	}
+	if _, exist := ud.Annotations[appsv1alpha1.AnnotationRebalanceNow]; exist {
+		t.Fatalf("expected UnitedDeployment unchanged")
+	}
+}
+
+func TestValidateTopologyEdit(t *testing.T) {
+	ud := createUnitedDeployment(6, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 2, "t3": 2})
+	withProviders(t, AllocationProviders{DisruptionBudget: &fakeDisruptionBudgetProvider{allowed: map[string]int32{"t1": 1, "t2": 1}}})
+
+	proposed := ud.DeepCopy()
+	proposed.Spec.Replicas = int32Ptr(4)
+	safe, violations := ValidateTopologyEdit(nameToSubset, ud, proposed)
+	if !safe || len(violations) != 0 {
+		t.Fatalf("expected safe edit, got violations %v", violations)
+	}
+
+	proposed = ud.DeepCopy()
+	proposed.Spec.Topology.Subsets = proposed.Spec.Topology.Subsets[1:]
+	safe, violations = ValidateTopologyEdit(nameToSubset, ud, proposed)
+	if safe || !reflect.DeepEqual(violations, []string{"subset t1 would lose 2 pods, but only 1 are allowed to be disrupted"}) {
+		t.Fatalf("expected removing t1 to violate its disruption budget, got %v", violations)
+	}
+}
+
+func TestValidateTopologyEditIgnoresScaleInLimits(t *testing.T) {
+	limit := int32(10)
+	ud := createUnitedDeployment(6, appsv1alpha1.Subset{Name: "t1", MaxScaleInPercent: &limit}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 2, "t2": 2, "t3": 2}
+	nameToSubset := createNameToSubset(ud.Status.SubsetReplicas)
+	reviewer := &fakeAllocationReviewer{}
+	withProviders(t, AllocationProviders{
+		DisruptionBudget: &fakeDisruptionBudgetProvider{allowed: map[string]int32{"t1": 1}},
+		Reviewer:         reviewer,
+	})
+
+	// the scale-in limit only removes one pod of t1 in the next reconcile, but the edit removes both eventually
+	proposed := ud.DeepCopy()
+	t1Replicas := intstr.FromInt(0)
+	proposed.Spec.Topology.Subsets[0].Replicas = &t1Replicas
+	safe, violations := ValidateTopologyEdit(nameToSubset, ud, proposed)
+	if safe || !reflect.DeepEqual(violations, []string{"subset t1 would lose 2 pods, but only 1 are allowed to be disrupted"}) {
+		t.Fatalf("expected reducing t1 to 0 to violate its disruption budget, got %v", violations)
+	}
+	if reviewer.reviews != 0 {
+		t.Fatalf("expected the reviewer not to be called")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+// limitSkew moves the replicas from the largest unspecified subsets to the smallest ones one by one, until the
+// difference between them is within maxSkew. The catch-all subset is left out. It returns an error if the max or
+// min replicas of subsets do not allow the difference to be reduced any further.
+func (s *replicasAllocator) limitSkew() error {
+	var subsets []*nameToReplicas
+	for _, subset := range *s.subsets {
+		if !subset.Specified && !subset.CatchAll {
+			subsets = append(subsets, subset)
+		}
+	}
+
+	for {
+		if err := allocationCancelled(s.ctx); err != nil {
+			return err
+		}
+		largest, smallest := skewExtremes(subsets)
+		if largest == nil || largest.Replicas-smallest.Replicas <= *s.maxSkew {
+			return nil
+		}
+
+		// shrink the largest subset into the smallest one which could grow, or grow the smallest one from the
+		// largest one which could shrink
+		from, to := largest, smallestGrowable(subsets)
+		if !canShrink(from) || to == nil || to.Replicas >= from.Replicas-1 {
+			from, to = largestShrinkable(subsets), smallest
+			if !canGrow(to) || from == nil || from.Replicas <= to.Replicas+1 {
+				return newAllocationError(MaxSkewExceededAllocationReason, "replicas of subsets %s (%d) and %s (%d) differ more than max skew (%d), but the max or min replicas of subsets do not allow to move replicas between them",
+					largest.SubsetName, largest.Replicas, smallest.SubsetName, smallest.Replicas, *s.maxSkew)
+			}
+		}
+		from.Replicas--
+		to.Replicas++
+		from.PinnedBy, to.PinnedBy = pinnedBySkew, pinnedBySkew
+	}
+}
+
+// skewExtremes returns the first subset with the most replicas and the first one with the fewest replicas.
+func skewExtremes(subsets []*nameToReplicas) (largest, smallest *nameToReplicas) {
+	for _, subset := range subsets {
+		if largest == nil || subset.Replicas > largest.Replicas {
+			largest = subset
+		}
+		if smallest == nil || subset.Replicas < smallest.Replicas {
+			smallest = subset
+		}
+	}
+	return largest, smallest
+}
+
+// smallestGrowable returns the first subset with the fewest replicas among the ones below their upper bound.
+func smallestGrowable(subsets []*nameToReplicas) *nameToReplicas {
+	var smallest *nameToReplicas
+	for _, subset := range subsets {
+		if canGrow(subset) && (smallest == nil || subset.Replicas < smallest.Replicas) {
+			smallest = subset
+		}
+	}
+	return smallest
+}
+
+// largestShrinkable returns the first subset with the most replicas among the ones above their min replicas.
+func largestShrinkable(subsets []*nameToReplicas) *nameToReplicas {
+	var largest *nameToReplicas
+	for _, subset := range subsets {
+		if canShrink(subset) && (largest == nil || subset.Replicas > largest.Replicas) {
+			largest = subset
+		}
+	}
+	return largest
+}
+
+// canGrow returns whether the subset is below its upper bound.
+func canGrow(subset *nameToReplicas) bool {
+	bound := subset.upperBound()
+	return bound == nil || subset.Replicas < *bound
+}
+
+// canShrink returns whether the subset is above its min replicas, or 0 if it has none.
+func canShrink(subset *nameToReplicas) bool {
+	return subset.Replicas > 0 && (subset.MinReplicas == nil || subset.Replicas > *subset.MinReplicas)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestMaxSkew(t *testing.T) {
+	t1Replicas := intstr.FromInt(10)
+	cases := []struct {
+		name     string
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		current  map[string]int32
+		topology func(topology *appsv1alpha1.Topology)
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		{
+			name:     "even split is within the skew",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		{
+			name:     "preferred weights are evened out to the skew",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			topology: func(topology *appsv1alpha1.Topology) {
+				topology.PreferredWeights = map[string]int32{"t1": 8, "t2": 1, "t3": 1}
+			},
+			expected: map[string]int32{"t1": 4, "t2": 3, "t3": 3},
+		},
+		{
+			name:     "specified and catch-all subsets are left out",
+			replicas: 20,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &t1Replicas}, {Name: "t2"}, {Name: "t3"}, {Name: "t4", CatchAll: true, MaxReplicas: int32Ptr(0)}},
+			expected: map[string]int32{"t1": 10, "t2": 5, "t3": 5, "t4": 0},
+		},
+		{
+			name:     "cap forces the skew beyond the budget",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: int32Ptr(1)}, {Name: "t2"}, {Name: "t3"}},
+			reason:   MaxSkewExceededAllocationReason,
+		},
+		{
+			name:     "protected subset forces the skew beyond the budget",
+			replicas: 12,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 8, "t2": 4, "t3": 0},
+			reason:   MaxSkewExceededAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			ud.Spec.Topology.MaxSkew = int32Ptr(2)
+			if c.topology != nil {
+				c.topology(&ud.Spec.Topology)
+			}
+			result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), ud)
+			if c.reason != "" {
+				if result.Effective || result.ReasonCode != c.reason {
+					t.Fatalf("expected ineffective allocation of reason %s, got %+v", c.reason, result)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"sort"
+)
+
+// satisfySoftMins moves the replicas among the unspecified subsets, so that every subset holds at least its soft min
+// replicas within its bounds. The subsets below their soft min replicas are filled in order, with the replicas taken
+// from the subsets the most above their soft min replicas first. If the soft min replicas sum to more than the
+// replicas of the subsets, they are scaled down in proportion to the replicas the subsets hold in total. The subsets
+// stay below their soft min replicas if no other subset could give any replica.
+func (s *replicasAllocator) satisfySoftMins(unspecified []*nameToReplicas) {
+	var total, softMinTotal int64
+	floors := make([]int32, len(unspecified))
+	for i, subset := range unspecified {
+		total += int64(subset.Replicas)
+		if subset.SoftMinReplicas != nil && *subset.SoftMinReplicas > 0 {
+			floors[i] = *subset.SoftMinReplicas
+			softMinTotal += int64(floors[i])
+		}
+	}
+	if softMinTotal == 0 {
+		return
+	}
+
+	if softMinTotal > total {
+		pending := make([]int, len(unspecified))
+		weights := make([]float64, len(unspecified))
+		for i := range unspecified {
+			pending[i], weights[i] = i, float64(floors[i])
+		}
+		floors, _ = weightedShares(int32(total), pending, weights)
+	}
+	var deficit int64
+	for i, subset := range unspecified {
+		if bound := subset.upperBound(); bound != nil && floors[i] > *bound {
+			floors[i] = *bound
+		}
+		if subset.Replicas < floors[i] {
+			deficit += int64(floors[i] - subset.Replicas)
+		}
+	}
+
+	yields := softMinYields(unspecified, floors, deficit)
+	var moved int64
+	for i, yield := range yields {
+		if yield > 0 {
+			unspecified[i].Replicas -= int32(yield)
+			moved += yield
+			s.explain(unspecified[i].SubsetName, "yield to soft min")
+		}
+	}
+	for i, subset := range unspecified {
+		if moved == 0 {
+			break
+		}
+		if subset.Replicas < floors[i] {
+			gain := int64(floors[i] - subset.Replicas)
+			if gain > moved {
+				gain = moved
+			}
+			subset.Replicas += int32(gain)
+			moved -= gain
+			s.explain(subset.SubsetName, "soft min=%d", floors[i])
+		}
+	}
+}
+
+// softMinYields returns the replicas each subset above its soft min replicas yields, so that they sum to replicas,
+// or to all the replicas the subsets could yield if there are fewer. The subsets the most above their soft min
+// replicas are lowered first, down to a common level found by binary search, and the subsets at that level yield
+// the replicas left over in order. A subset never yields below its soft min or min replicas.
+func softMinYields(unspecified []*nameToReplicas, floors []int32, replicas int64) []int64 {
+	excess := make([]int64, len(unspecified))
+	available := make([]int64, len(unspecified))
+	var maxExcess int64
+	for i, subset := range unspecified {
+		limit := floors[i]
+		if subset.MinReplicas != nil && *subset.MinReplicas > limit {
+			limit = *subset.MinReplicas
+		}
+		if subset.Replicas > limit {
+			excess[i] = int64(subset.Replicas - floors[i])
+			available[i] = int64(subset.Replicas - limit)
+			if excess[i] > maxExcess {
+				maxExcess = excess[i]
+			}
+		}
+	}
+
+	yieldAt := func(i int, level int64) int64 {
+		if excess[i] <= level {
+			return 0
+		} else if excess[i]-level < available[i] {
+			return excess[i] - level
+		}
+		return available[i]
+	}
+	// the lowest level down to which the subsets yield no more than the replicas
+	level := int64(sort.Search(int(maxExcess)+1, func(l int) bool {
+		var yielded int64
+		for i := range unspecified {
+			yielded += yieldAt(i, int64(l))
+		}
+		return yielded <= replicas
+	}))
+
+	yields := make([]int64, len(unspecified))
+	for i := range unspecified {
+		yields[i] = yieldAt(i, level)
+		replicas -= yields[i]
+	}
+	for i := 0; i < len(unspecified) && replicas > 0 && level > 0; i++ {
+		if yieldAt(i, level-1) > yields[i] {
+			yields[i]++
+			replicas--
+		}
+	}
+	return yields
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestSoftMinReplicas(t *testing.T) {
+	four := intstr.FromInt(4)
+	cases := []struct {
+		name     string
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		expected map[string]int32
+	}{
+		{
+			name:     "soft min replicas fit",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", SoftMinReplicas: int32Ptr(6)}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 6, "t2": 2, "t3": 2},
+		},
+		{
+			name:     "soft min replicas below the even split change nothing",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", SoftMinReplicas: int32Ptr(2)}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		{
+			name:     "soft min replicas are scaled down in proportion",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", SoftMinReplicas: int32Ptr(8)}, {Name: "t2", SoftMinReplicas: int32Ptr(12)}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 4, "t2": 6, "t3": 0},
+		},
+		{
+			name:     "soft min replicas share the replicas left by the specified subsets",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &four}, {Name: "t2", SoftMinReplicas: int32Ptr(8)}, {Name: "t3", SoftMinReplicas: int32Ptr(4)}},
+			expected: map[string]int32{"t1": 4, "t2": 4, "t3": 2},
+		},
+		{
+			name:     "soft min replicas are capped at the max replicas",
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", SoftMinReplicas: int32Ptr(8), MaxReplicas: int32Ptr(4)}, {Name: "t2"}},
+			expected: map[string]int32{"t1": 4, "t2": 6},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(*next, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *next)
+			}
+		})
+	}
+}
+
+func TestSoftMinReplicasAtScale(t *testing.T) {
+	subsets := []appsv1alpha1.Subset{{Name: "t0", SoftMinReplicas: int32Ptr(9000000)}}
+	for i := 1; i < 10; i++ {
+		subsets = append(subsets, appsv1alpha1.Subset{Name: fmt.Sprintf("t%d", i)})
+	}
+	ud := createUnitedDeployment(10000000, subsets...)
+
+	// the replicas are moved at once rather than one by one, which would take millions of rounds
+	start := time.Now()
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected the soft min replicas to be satisfied quickly, but it took %v", elapsed)
+	}
+	if (*next)["t0"] != 9000000 {
+		t.Fatalf("expected t0 to hold its soft min replicas, got %v", *next)
+	}
+	for i := 1; i < 10; i++ {
+		if replicas := (*next)[fmt.Sprintf("t%d", i)]; replicas < 111111 || replicas > 111112 {
+			t.Fatalf("expected the other subsets to yield evenly, got %v", *next)
+		}
+	}
+}
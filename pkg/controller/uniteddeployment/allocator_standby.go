@@ -0,0 +1,108 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+// isStandbyPriority returns whether the subset of the priority is a standby subset, which is touched only after all
+// the subsets of non-negative priorities, both when scaling out and in.
+func isStandbyPriority(priority int32) bool {
+	return priority < 0
+}
+
+// allocateByPriorities fills the unspecified subsets of non-negative priorities tier by tier, and holds the standby
+// subsets at their current replicas as long as the others could absorb the change. Then the standby tiers are
+// touched one by one in order of their priorities, so that a lower priority is the later to grow and to shrink. It
+// returns the replicas which can not be allocated within the max replicas of subsets.
+func (s *replicasAllocator) allocateByPriorities(unspecified []*nameToReplicas, replicas int32) int32 {
+	var normal [][]*nameToReplicas
+	groups := [][][]*nameToReplicas{nil}
+	for _, tier := range s.priorityTiers(unspecified) {
+		if isStandbyPriority(s.schedulingPriorities[tier[0].SubsetName]) {
+			groups = append(groups, [][]*nameToReplicas{tier})
+		} else {
+			normal = append(normal, tier)
+		}
+	}
+	groups[0] = normal
+	return s.allocateStandbyGroups(groups, replicas)
+}
+
+// allocateStandbyGroups gives the first group of tiers the replicas left by holding the following groups at their
+// current replicas, within the capacity of the first group, and then allocates the rest to the following groups.
+func (s *replicasAllocator) allocateStandbyGroups(groups [][][]*nameToReplicas, replicas int32) int32 {
+	if len(groups) == 1 {
+		return s.allocateByTiers(groups[0], replicas)
+	}
+
+	rest := groups[1:]
+	held := heldReplicas(rest)
+	share := int64(replicas) - held
+	if share < 0 {
+		share = 0
+	}
+	if capacity, bounded := groupCapacity(groups[0]); bounded && share > capacity {
+		share = capacity
+	}
+	replicas -= int32(share) - s.allocateByTiers(groups[0], int32(share))
+
+	if int64(replicas) == held {
+		for _, group := range rest {
+			for _, tier := range group {
+				for _, subset := range tier {
+					// the held replicas of the subset are its current replicas within its upper bound
+					if bound := subset.upperBound(); bound != nil && subset.Replicas > *bound {
+						subset.Replicas, subset.PinnedBy = *bound, pinnedByMax
+					}
+					s.explain(subset.SubsetName, "standby")
+				}
+			}
+		}
+		return 0
+	}
+	return s.allocateStandbyGroups(rest, replicas)
+}
+
+// heldReplicas returns the sum of the current replicas of the subsets in the groups, each within its upper bound.
+func heldReplicas(groups [][][]*nameToReplicas) int64 {
+	var held int64
+	for _, group := range groups {
+		for _, tier := range group {
+			for _, subset := range tier {
+				replicas := subset.Replicas
+				if bound := subset.upperBound(); bound != nil && replicas > *bound {
+					replicas = *bound
+				}
+				held += int64(replicas)
+			}
+		}
+	}
+	return held
+}
+
+// groupCapacity returns the sum of the upper bounds of the subsets in the group, and false if any of them is unbounded.
+func groupCapacity(group [][]*nameToReplicas) (int64, bool) {
+	var capacity int64
+	for _, tier := range group {
+		for _, subset := range tier {
+			bound := subset.upperBound()
+			if bound == nil {
+				return 0, false
+			}
+			capacity += int64(*bound)
+		}
+	}
+	return capacity, true
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestStandbySubsets(t *testing.T) {
+	current := map[string]int32{"t1": 4, "t2": 4, "s1": 2, "s2": 2}
+	cases := []struct {
+		name      string
+		replicas  int32
+		maxNormal *int32
+		expected  map[string]int32
+	}{
+		{
+			name:     "scale-out is absorbed by the normal subsets",
+			replicas: 16,
+			expected: map[string]int32{"t1": 6, "t2": 6, "s1": 2, "s2": 2},
+		},
+		{
+			name:      "standby subsets grow once the normal ones are full",
+			replicas:  16,
+			maxNormal: int32Ptr(5),
+			expected:  map[string]int32{"t1": 5, "t2": 5, "s1": 4, "s2": 2},
+		},
+		{
+			name:      "the last standby subset grows the last",
+			replicas:  30,
+			maxNormal: int32Ptr(5),
+			expected:  map[string]int32{"t1": 5, "t2": 5, "s1": 18, "s2": 2},
+		},
+		{
+			name:     "scale-in is absorbed by the normal subsets",
+			replicas: 6,
+			expected: map[string]int32{"t1": 1, "t2": 1, "s1": 2, "s2": 2},
+		},
+		{
+			name:     "standby subsets shrink once the normal ones are drained",
+			replicas: 3,
+			expected: map[string]int32{"t1": 0, "t2": 0, "s1": 1, "s2": 2},
+		},
+		{
+			name:     "the last standby subset shrinks the last",
+			replicas: 1,
+			expected: map[string]int32{"t1": 0, "t2": 0, "s1": 0, "s2": 1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas,
+				appsv1alpha1.Subset{Name: "t1", MaxReplicas: c.maxNormal},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: c.maxNormal},
+				appsv1alpha1.Subset{Name: "s1", Priority: int32Ptr(-1)},
+				appsv1alpha1.Subset{Name: "s2", Priority: int32Ptr(-2)},
+			)
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(current), ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(*next, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *next)
+			}
+		})
+	}
+}
+
+func TestAllocateIncrementallyStandbySubset(t *testing.T) {
+	origin := incrementalAllocation
+	incrementalAllocation = true
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	ud := createUnitedDeployment(9,
+		appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(1)},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "s1", Priority: int32Ptr(-1)},
+	)
+	ud.Generation = 1
+	ud.Status.ObservedGeneration = 1
+	ud.Status.SubsetReplicas = map[string]int32{"t1": 3, "t2": 3, "s1": 3}
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 5, "t2": 3, "s1": 3}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 1, "t2": 5, "s1": 3}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("the excess should go to the normal subset before the standby one, expected %v, got %v", expected, *next)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// DefaultAllocationStrategy is the name of the built-in allocation strategy.
+const DefaultAllocationStrategy = "Default"
+
+// Allocator is an allocation strategy distributing the replicas among the subsets, which are sorted in order
+// of increment. It returns a mapping from subset name to its next replicas, and false with the reason if the
+// replicas could not be allocated as specified.
+type Allocator interface {
+	Allocate(replicas int32, subsets subsetInfos, specified map[string]int32) (map[string]int32, bool, string)
+}
+
+// allocationStrategies are the allocation strategies which could be chosen by Topology.AllocationStrategy.
+var allocationStrategies = map[string]Allocator{
+	DefaultAllocationStrategy: defaultAllocator{},
+}
+
+// RegisterAllocationStrategy registers the allocator under the name, so that a UnitedDeployment could choose it
+// by Topology.AllocationStrategy. It should be called before the controller starts.
+func RegisterAllocationStrategy(name string, allocator Allocator) {
+	allocationStrategies[name] = allocator
+}
+
+// defaultAllocator is the built-in allocation without the options configured by the topology of a UnitedDeployment,
+// which the registered strategies could fall back to.
+type defaultAllocator struct{}
+
+func (defaultAllocator) Allocate(replicas int32, subsets subsetInfos, specified map[string]int32) (map[string]int32, bool, string) {
+	next, err := subsets.SortToAllocator().AllocateReplicas(replicas, &specified)
+	if err != nil {
+		return nil, false, err.Error()
+	}
+	return *next, true, ""
+}
+
+// getAllocationStrategy returns the allocator chosen by Topology.AllocationStrategy, or nil if the built-in
+// allocation should be used.
+func getAllocationStrategy(ud *appsv1alpha1.UnitedDeployment) Allocator {
+	name := ud.Spec.Topology.AllocationStrategy
+	if name == "" || name == DefaultAllocationStrategy {
+		return nil
+	}
+
+	allocator, exist := allocationStrategies[name]
+	if !exist {
+		allocationLoggerFor(ud).Info("Unregistered allocation strategy is chosen, use built-in allocation instead", "strategy", name)
+		return nil
+	}
+	return allocator
+}
+
+// allocateByStrategy returns the replicas of each subset calculated by the allocator. An error is returned if the
+// allocator could not allocate the replicas as specified, or violates the specified replicas and bounds of subsets.
+func (s *replicasAllocator) allocateByStrategy(ud *appsv1alpha1.UnitedDeployment, allocator Allocator, input *AllocationInput, specifiedSubsetReplicas *map[string]int32) (*map[string]int32, error) {
+	name := ud.Spec.Topology.AllocationStrategy
+	next, effective, reason := allocator.Allocate(input.Replicas, *s.subsets, *specifiedSubsetReplicas)
+	if !effective {
+		return nil, newAllocationError(StrategyIneffectiveAllocationReason, "allocation strategy %s is ineffective: %s", name, reason)
+	}
+	if err := validatePluginReplicas(input, next); err != nil {
+		return nil, newAllocationError(StrategyIneffectiveAllocationReason, "allocation strategy %s returns invalid replicas: %s", name, err)
+	}
+	return &next, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// firstSubsetAllocator puts the replicas left by the specified subsets into the first unspecified subset by name.
+type firstSubsetAllocator struct{}
+
+func (firstSubsetAllocator) Allocate(replicas int32, subsets subsetInfos, specified map[string]int32) (map[string]int32, bool, string) {
+	next := map[string]int32{}
+	var unspecified []string
+	for _, subset := range subsets {
+		if r, exist := specified[subset.SubsetName]; exist {
+			next[subset.SubsetName] = r
+			replicas -= r
+			continue
+		}
+		next[subset.SubsetName] = 0
+		unspecified = append(unspecified, subset.SubsetName)
+	}
+	if len(unspecified) == 0 {
+		return nil, false, "no unspecified subset"
+	}
+	sort.Strings(unspecified)
+	next[unspecified[0]] = replicas
+	return next, true, ""
+}
+
+// fixedAllocator always returns its replicas.
+type fixedAllocator map[string]int32
+
+func (a fixedAllocator) Allocate(replicas int32, subsets subsetInfos, specified map[string]int32) (map[string]int32, bool, string) {
+	return a, true, ""
+}
+
+func withAllocationStrategy(t *testing.T, name string, allocator Allocator) {
+	RegisterAllocationStrategy(name, allocator)
+	t.Cleanup(func() {
+		delete(allocationStrategies, name)
+	})
+}
+
+func TestAllocationStrategy(t *testing.T) {
+	withAllocationStrategy(t, "FirstSubset", firstSubsetAllocator{})
+	withAllocationStrategy(t, "Fixed", fixedAllocator{"t1": 1, "t2": 1, "t3": 1})
+
+	t2Replicas := intstr.FromInt(2)
+	newUnitedDeployment := func(strategy string) *appsv1alpha1.UnitedDeployment {
+		ud := createUnitedDeployment(9, appsv1alpha1.Subset{Name: "t3"}, appsv1alpha1.Subset{Name: "t2", Replicas: &t2Replicas}, appsv1alpha1.Subset{Name: "t1"})
+		ud.Spec.Topology.AllocationStrategy = strategy
+		return ud
+	}
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 3, "t2": 3, "t3": 3})
+
+	for name, c := range map[string]struct {
+		strategy string
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		"built-in":      {strategy: "", expected: map[string]int32{"t1": 3, "t2": 2, "t3": 4}},
+		"default":       {strategy: DefaultAllocationStrategy, expected: map[string]int32{"t1": 3, "t2": 2, "t3": 4}},
+		"registered":    {strategy: "FirstSubset", expected: map[string]int32{"t1": 7, "t2": 2, "t3": 0}},
+		"unregistered":  {strategy: "Unknown", expected: map[string]int32{"t1": 3, "t2": 2, "t3": 4}},
+		"invalid reply": {strategy: "Fixed", reason: StrategyIneffectiveAllocationReason},
+	} {
+		result := GetAllocationResult(context.TODO(), nameToSubset, newUnitedDeployment(c.strategy))
+		if c.reason != "" {
+			if result.Effective || result.ReasonCode != c.reason {
+				t.Fatalf("%s: expected ineffective allocation for %s, got %+v", name, c.reason, result)
+			}
+			continue
+		}
+		if !result.Effective || !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+			t.Fatalf("%s: expected %v, got %+v", name, c.expected, result)
+		}
+	}
+
+	// an ineffective strategy reports its reason
+	ud := newUnitedDeployment("FirstSubset")
+	t1Replicas, t3Replicas := intstr.FromInt(3), intstr.FromInt(4)
+	ud.Spec.Topology.Subsets[0].Replicas = &t3Replicas
+	ud.Spec.Topology.Subsets[2].Replicas = &t1Replicas
+	result := GetAllocationResult(context.TODO(), nameToSubset, ud)
+	if result.Effective || result.ReasonCode != StrategyIneffectiveAllocationReason || result.Message != "allocation strategy FirstSubset is ineffective: no unspecified subset" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestDefaultAllocator(t *testing.T) {
+	next, effective, reason := defaultAllocator{}.Allocate(10, subsetInfos{createSubset("t1", 1), createSubset("t2", 1)}, map[string]int32{"t1": 4})
+	if !effective || !reflect.DeepEqual(next, map[string]int32{"t1": 4, "t2": 6}) {
+		t.Fatalf("unexpected allocation %v: %s", next, reason)
+	}
+
+	_, effective, reason = defaultAllocator{}.Allocate(10, subsetInfos{createSubset("t1", 1)}, map[string]int32{"t1": 11})
+	if effective || reason == "" {
+		t.Fatalf("expected ineffective allocation with a reason")
+	}
+}
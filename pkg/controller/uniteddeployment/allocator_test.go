@@ -17,7 +17,19 @@ limitations under the License.
 package uniteddeployment
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
 )
 
 func TestScaleReplicas(t *testing.T) {
@@ -87,6 +99,34 @@ func TestScaleReplicas(t *testing.T) {
 	}
 }
 
+func TestStringByName(t *testing.T) {
+	infos := subsetInfos{
+		createSubset("t1", 1),
+		createSubset("t2", 4),
+		createSubset("t3", 2),
+	}
+	allocator := infos.SortToAllocator()
+	allocator.AllocateReplicas(5, &map[string]int32{"t1": 3})
+	if " t1 -> 3; t2 -> 1; t3 -> 1;" != allocator.StringByName() {
+		t.Fatalf("unexpected %s", allocator.StringByName())
+	}
+	if " t2 -> 1; t3 -> 1; t1 -> 3;" != allocator.String() {
+		t.Fatalf("unexpected %s", allocator)
+	}
+
+	allocator.AllocateReplicas(5, &map[string]int32{"t1": 1})
+	if " t1 -> 1; t2 -> 2; t3 -> 2;" != allocator.StringByName() {
+		t.Fatalf("unexpected %s", allocator.StringByName())
+	}
+
+	if " t1 -> 1; t2 -> 2;" != subsetReplicasStringByName(&map[string]int32{"t2": 2, "t1": 1}) {
+		t.Fatalf("unexpected %s", subsetReplicasStringByName(&map[string]int32{"t2": 2, "t1": 1}))
+	}
+	if "" != subsetReplicasStringByName(nil) {
+		t.Fatalf("unexpected %s", subsetReplicasStringByName(nil))
+	}
+}
+
 func TestSpecifyValidReplicas(t *testing.T) {
 	infos := subsetInfos{
 		createSubset("t1", 1),
@@ -197,9 +237,1428 @@ func TestSpecifyInvalidReplicas(t *testing.T) {
 	}
 }
 
+func TestSpecifyReplicasOutOfBounds(t *testing.T) {
+	maxReplicas := int32(3)
+	infos := subsetInfos{
+		createSubset("t1", 2),
+		createSubset("t2", 2),
+	}
+	infos[0].MaxReplicas = &maxReplicas
+	allocator := infos.SortToAllocator()
+	if _, err := allocator.AllocateReplicas(8, &map[string]int32{
+		"t1": 4,
+		"t2": 4,
+	}); err == nil {
+		t.Fatalf("expected error for specified replicas greater than max replicas")
+	}
+	if " t1 -> 2; t2 -> 2;" != allocator.String() {
+		t.Fatalf("unexpected %s", allocator)
+	}
+
+	minReplicas := int32(2)
+	infos = subsetInfos{
+		createSubset("t1", 2),
+		createSubset("t2", 2),
+	}
+	infos[1].MinReplicas = &minReplicas
+	allocator = infos.SortToAllocator()
+	if _, err := allocator.AllocateReplicas(4, &map[string]int32{
+		"t1": 3,
+		"t2": 1,
+	}); err == nil {
+		t.Fatalf("expected error for specified replicas less than min replicas")
+	}
+
+	infos = subsetInfos{
+		createSubset("t1", 2),
+		createSubset("t2", 2),
+	}
+	infos[0].MaxReplicas = &maxReplicas
+	allocator = infos.SortToAllocator()
+	if _, err := allocator.AllocateReplicas(6, &map[string]int32{
+		"t1": 3,
+		"t2": 3,
+	}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if " t1 -> 3; t2 -> 3;" != allocator.String() {
+		t.Fatalf("unexpected %s", allocator)
+	}
+}
+
+func TestSpecifyUnknownSubset(t *testing.T) {
+	infos := subsetInfos{
+		createSubset("t1", 2),
+		createSubset("t2", 2),
+	}
+	allocator := infos.SortToAllocator()
+	_, err := allocator.AllocateReplicas(6, &map[string]int32{
+		"t1": 2,
+		"t9": 2,
+	})
+	if err == nil {
+		t.Fatalf("expected error for replicas specified for a subset not in the topology")
+	}
+	if allocationReasonOf(err) != UnknownSubsetAllocationReason || !strings.Contains(err.Error(), "t9") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if " t1 -> 2; t2 -> 2;" != allocator.String() {
+		t.Fatalf("unexpected %s", allocator)
+	}
+}
+
+func TestDuplicateSubsetNames(t *testing.T) {
+	ud := createUnitedDeployment(6, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t1"})
+	result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{"t1": 2, "t2": 2}), ud)
+	if result.Effective || result.ReasonCode != DuplicateSubsetAllocationReason || !strings.Contains(result.Message, "t1") {
+		t.Fatalf("expected ineffective allocation for the duplicated subset t1, got %+v", result)
+	}
+	if result.SubsetReplicas != nil {
+		t.Fatalf("expected no replicas allocated, got %v", *result.SubsetReplicas)
+	}
+}
+
+func TestRollingUpdateSurgeLimit(t *testing.T) {
+	ud := createUnitedDeployment(8, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 2})
+	surge := int32(1)
+	(*nameToSubset)["t1"].Spec.UpdateStrategy.MaxSurge = &surge
+
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 5}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	(*nameToSubset)["t2"].Spec.UpdateStrategy.MaxSurge = &surge
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+
+	(*nameToSubset)["t1"].Status.UpdatedReplicas = 2
+	(*nameToSubset)["t2"].Status.UpdatedReplicas = 2
+	next, err = GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 4}) {
+		t.Fatalf("unexpected allocation %v", *next)
+	}
+}
+
+func TestLeaderSubset(t *testing.T) {
+	ud := createUnitedDeployment(5,
+		appsv1alpha1.Subset{Name: "t1", Role: appsv1alpha1.LeaderSubsetRole},
+		appsv1alpha1.Subset{Name: "t2", Role: appsv1alpha1.FollowerSubsetRole},
+		appsv1alpha1.Subset{Name: "t3", Role: appsv1alpha1.FollowerSubsetRole},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	for _, c := range []struct {
+		replicas int32
+		expected map[string]int32
+	}{
+		{replicas: 5, expected: map[string]int32{"t1": 1, "t2": 2, "t3": 2}},
+		{replicas: 9, expected: map[string]int32{"t1": 1, "t2": 4, "t3": 4}},
+		{replicas: 2, expected: map[string]int32{"t1": 1, "t2": 0, "t3": 1}},
+	} {
+		replicas := c.replicas
+		ud.Spec.Replicas = &replicas
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("replicas %d: expected %v, got %v", c.replicas, c.expected, *next)
+		}
+		nameToSubset = createNameToSubset(*next)
+	}
+}
+
+func TestAllocateReplicasTwice(t *testing.T) {
+	for name, c := range map[string]struct {
+		replicas  int32
+		specified map[string]int32
+		configure func(allocator *replicasAllocator)
+	}{
+		"scale out": {
+			replicas: 11,
+		},
+		"scale in": {
+			replicas: 4,
+		},
+		"specified": {
+			replicas:  9,
+			specified: map[string]int32{"t2": 6},
+		},
+		"rotation": {
+			replicas: 10,
+			configure: func(allocator *replicasAllocator) {
+				configureRotation(allocator, createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"}))
+				allocator.remainderPolicy = appsv1alpha1.RotateRemainderPolicyType
+			},
+		},
+	} {
+		infos := subsetInfos{createSubset("t1", 1), createSubset("t2", 4), createSubset("t3", 2)}
+		allocator := infos.SortToAllocator()
+		if c.configure != nil {
+			c.configure(allocator)
+		}
+		specified := c.specified
+		if specified == nil {
+			specified = map[string]int32{}
+		}
+
+		first, err := allocator.AllocateReplicas(c.replicas, &specified)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		firstCursor := allocator.scaleOutCursor
+		second, err := allocator.AllocateReplicas(c.replicas, &specified)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(first, second) || allocator.scaleOutCursor != firstCursor {
+			t.Fatalf("%s: expected the same allocation %v and cursor %d, got %v and %d", name, *first, firstCursor, *second, allocator.scaleOutCursor)
+		}
+		var got []nameToReplicas
+		for _, subset := range infos {
+			got = append(got, *subset)
+		}
+		if expected := []nameToReplicas{*createSubset("t1", 1), *createSubset("t2", 4), *createSubset("t3", 2)}; !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%s: expected the subsets to be left unchanged, got %+v", name, got)
+		}
+	}
+}
+
+func TestPausedAllocation(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 1, "t2": 7})
+	if result := GetAllocationResult(context.TODO(), nameToSubset, ud); !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 5, "t2": 5}) {
+		t.Fatalf("expected the replicas to be allocated again, got %v", *result.SubsetReplicas)
+	}
+
+	ud.Spec.Paused = true
+	result := GetAllocationResult(context.TODO(), nameToSubset, ud)
+	if !result.Effective || result.ReasonCode != PausedAllocationReason {
+		t.Fatalf("expected an effective allocation of reason %s, got %+v", PausedAllocationReason, result)
+	}
+	if !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 1, "t2": 7}) {
+		t.Fatalf("expected the current replicas to be kept, got %v", *result.SubsetReplicas)
+	}
+	if next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud); err != nil || !reflect.DeepEqual(*next, map[string]int32{"t1": 1, "t2": 7}) {
+		t.Fatalf("expected the current replicas to be kept, got %v, %v", next, err)
+	}
+}
+
+func TestSortToAllocatorComparators(t *testing.T) {
+	lessByReplicasDesc := func(a, b *nameToReplicas) bool {
+		return a.Replicas > b.Replicas
+	}
+
+	for name, c := range map[string]struct {
+		comparators []subsetComparator
+		expected    []string
+	}{
+		"default": {
+			expected: []string{"t2", "t4", "t1", "t3"},
+		},
+		"by name": {
+			comparators: []subsetComparator{lessBySubsetName},
+			expected:    []string{"t1", "t2", "t3", "t4"},
+		},
+		"by replicas descending and then name": {
+			comparators: []subsetComparator{lessByReplicasDesc, lessBySubsetName},
+			expected:    []string{"t1", "t3", "t2", "t4"},
+		},
+	} {
+		infos := subsetInfos{
+			createSubset("t4", 1),
+			createSubset("t3", 5),
+			createSubset("t2", 1),
+			createSubset("t1", 5),
+		}
+
+		allocator := infos.SortToAllocator(c.comparators...)
+		var names []string
+		for _, subset := range *allocator.subsets {
+			names = append(names, subset.SubsetName)
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("%s: expected order %v, got %v", name, c.expected, names)
+		}
+	}
+}
+
+func TestSubsetMaxReplicas(t *testing.T) {
+	for name, c := range map[string]struct {
+		ud       *appsv1alpha1.UnitedDeployment
+		expected map[string]int32
+	}{
+		"uneven caps": {
+			ud: createUnitedDeployment(12,
+				appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(2)},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3)},
+				appsv1alpha1.Subset{Name: "t3"},
+			),
+			expected: map[string]int32{"t1": 2, "t2": 3, "t3": 7},
+		},
+		"cascade across subsets": {
+			ud: createUnitedDeployment(20,
+				appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(1)},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3)},
+				appsv1alpha1.Subset{Name: "t3", MaxReplicas: int32Ptr(5)},
+				appsv1alpha1.Subset{Name: "t4", MaxReplicas: int32Ptr(20)},
+			),
+			expected: map[string]int32{"t1": 1, "t2": 3, "t3": 5, "t4": 11},
+		},
+	} {
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), c.ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(1)},
+		appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(2)},
+		appsv1alpha1.Subset{Name: "t3", MaxReplicas: int32Ptr(3)},
+	)
+	if _, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud); err == nil || !strings.Contains(err.Error(), "4 of UnitedDeployment replica (10)") {
+		t.Fatalf("expected 4 unplaceable replicas, got %v", err)
+	}
+}
+
+func TestSubsetPriority(t *testing.T) {
+	replicas2 := intstr.FromInt(2)
+	for name, c := range map[string]struct {
+		ud       *appsv1alpha1.UnitedDeployment
+		expected map[string]int32
+	}{
+		"no priority": {
+			ud: createUnitedDeployment(10,
+				appsv1alpha1.Subset{Name: "t1"},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3)},
+				appsv1alpha1.Subset{Name: "t3"},
+			),
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"low capacity high priority subset fills first": {
+			ud: createUnitedDeployment(10,
+				appsv1alpha1.Subset{Name: "t1"},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3), Priority: int32Ptr(10)},
+				appsv1alpha1.Subset{Name: "t3", Priority: int32Ptr(5)},
+			),
+			expected: map[string]int32{"t1": 0, "t2": 3, "t3": 7},
+		},
+		"equal priorities": {
+			ud: createUnitedDeployment(10,
+				appsv1alpha1.Subset{Name: "t1", Priority: int32Ptr(1)},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3), Priority: int32Ptr(1)},
+				appsv1alpha1.Subset{Name: "t3", Priority: int32Ptr(1)},
+			),
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"specified replicas ignore priority": {
+			ud: createUnitedDeployment(10,
+				appsv1alpha1.Subset{Name: "t1", Replicas: &replicas2},
+				appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3), Priority: int32Ptr(10)},
+				appsv1alpha1.Subset{Name: "t3", Priority: int32Ptr(5)},
+			),
+			expected: map[string]int32{"t1": 2, "t2": 3, "t3": 5},
+		},
+	} {
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), c.ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+}
+
+func TestFillOrder(t *testing.T) {
+	ud := createUnitedDeployment(0,
+		appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(3)},
+		appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3)},
+		appsv1alpha1.Subset{Name: "t3", MaxReplicas: int32Ptr(3)},
+	)
+	ud.Spec.Topology.FillOrder = []string{"t3", "t1"}
+
+	current := map[string]int32{}
+	for _, step := range []struct {
+		replicas int32
+		expected map[string]int32
+	}{
+		{replicas: 2, expected: map[string]int32{"t1": 0, "t2": 0, "t3": 2}},
+		{replicas: 5, expected: map[string]int32{"t1": 2, "t2": 0, "t3": 3}},
+		{replicas: 8, expected: map[string]int32{"t1": 3, "t2": 2, "t3": 3}},
+	} {
+		replicas := step.replicas
+		ud.Spec.Replicas = &replicas
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(current), ud)
+		if err != nil {
+			t.Fatalf("replicas %d: unexpected error %v", step.replicas, err)
+		}
+		if !reflect.DeepEqual(*next, step.expected) {
+			t.Fatalf("replicas %d: expected %v, got %v", step.replicas, step.expected, *next)
+		}
+		current = *next
+	}
+
+	// the subsets not listed go last despite a higher priority
+	ud.Spec.Topology.Subsets[1].Priority = int32Ptr(10)
+	replicas := int32(5)
+	ud.Spec.Replicas = &replicas
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 2, "t2": 0, "t3": 3}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("expected %v, got %v", expected, *next)
+	}
+}
+
+func TestGetAllocationResult(t *testing.T) {
+	replicas6, replicas4 := intstr.FromInt(6), intstr.FromInt(4)
+	for name, c := range map[string]struct {
+		ud        *appsv1alpha1.UnitedDeployment
+		effective bool
+		reason    AllocationReasonCode
+	}{
+		"effective": {
+			ud:        createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}),
+			effective: true,
+		},
+		"over specified": {
+			ud:     createUnitedDeployment(8, appsv1alpha1.Subset{Name: "t1", Replicas: &replicas6}, appsv1alpha1.Subset{Name: "t2", Replicas: &replicas4}),
+			reason: OverSpecifiedAllocationReason,
+		},
+		"under specified": {
+			ud:     createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1", Replicas: &replicas6}, appsv1alpha1.Subset{Name: "t2", Replicas: &replicas4}),
+			reason: UnderSpecifiedAllocationReason,
+		},
+		"all capped": {
+			ud:     createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(2)}, appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(3)}),
+			reason: AllCappedAllocationReason,
+		},
+		"all subsets unavailable": {
+			ud:     createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(0)}, appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(0)}),
+			reason: AllSubsetsUnavailableAllocationReason,
+		},
+		"no subsets": {
+			ud:     createUnitedDeployment(10),
+			reason: NoSubsetsAllocationReason,
+		},
+		"no subsets and no replicas": {
+			ud:        createUnitedDeployment(0),
+			effective: true,
+		},
+	} {
+		result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), c.ud)
+		if result.Effective != c.effective || result.ReasonCode != c.reason {
+			t.Fatalf("%s: expected effective %v with reason %q, got %v with reason %q: %s", name, c.effective, c.reason, result.Effective, result.ReasonCode, result.Message)
+		}
+		if !c.effective && result.Message == "" {
+			t.Fatalf("%s: expected a message", name)
+		}
+	}
+
+	result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), createUnitedDeployment(10))
+	if result.SubsetReplicas != nil || result.Message != "no subsets defined to place 10 replicas" {
+		t.Fatalf("expected no replicas placed with a clear message, got %v: %s", result.SubsetReplicas, result.Message)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 0, "t2": 0, "t3": 0})
+	withProviders(t, AllocationProviders{
+		Capacity: &fakeCapacityProvider{capacities: map[string]int32{"t1": 5, "t2": 8, "t3": 6}},
+	})
+
+	for name, c := range map[string]struct {
+		policy     appsv1alpha1.TieBreakPolicyType
+		generation int64
+		favored    string
+	}{
+		"default":                  {policy: "", favored: "t3"},
+		"name":                     {policy: appsv1alpha1.NameTieBreakPolicyType, favored: "t3"},
+		"round robin generation 1": {policy: appsv1alpha1.RoundRobinTieBreakPolicyType, generation: 1, favored: "t2"},
+		"round robin generation 2": {policy: appsv1alpha1.RoundRobinTieBreakPolicyType, generation: 2, favored: "t1"},
+		"round robin generation 3": {policy: appsv1alpha1.RoundRobinTieBreakPolicyType, generation: 3, favored: "t3"},
+		"least loaded":             {policy: appsv1alpha1.LeastLoadedTieBreakPolicyType, favored: "t2"},
+	} {
+		ud.Spec.Topology.TieBreak = c.policy
+		ud.Generation = c.generation
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		expected := map[string]int32{"t1": 3, "t2": 3, "t3": 3}
+		expected[c.favored] = 4
+		if !reflect.DeepEqual(*next, expected) {
+			t.Fatalf("%s: expected %v, got %v", name, expected, *next)
+		}
+	}
+}
+
+func TestRemainderPolicy(t *testing.T) {
+	ud := createUnitedDeployment(7, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 2, "t2": 3, "t3": 1})
+
+	for name, c := range map[string]struct {
+		policy  appsv1alpha1.RemainderPolicyType
+		favored string
+	}{
+		"default":            {policy: "", favored: "t2"},
+		"spread by name":     {policy: appsv1alpha1.SpreadByNameRemainderPolicyType, favored: "t1"},
+		"spread by smallest": {policy: appsv1alpha1.SpreadBySmallestRemainderPolicyType, favored: "t3"},
+		"spread by largest":  {policy: appsv1alpha1.SpreadByLargestRemainderPolicyType, favored: "t2"},
+	} {
+		ud.Spec.Topology.RemainderPolicy = c.policy
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		expected := map[string]int32{"t1": 2, "t2": 2, "t3": 2}
+		expected[c.favored] = 3
+		if !reflect.DeepEqual(*next, expected) {
+			t.Fatalf("%s: expected %v, got %v", name, expected, *next)
+		}
+	}
+}
+
+func TestRoundingMode(t *testing.T) {
+	for name, c := range map[string]struct {
+		mode     appsv1alpha1.RoundingModeType
+		catchAll bool
+		expected map[string]int32
+	}{
+		"default":                {mode: "", expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4}},
+		"largest remainder":      {mode: appsv1alpha1.LargestRemainderRoundingModeType, expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4}},
+		"floor":                  {mode: appsv1alpha1.FloorRoundingModeType, expected: map[string]int32{"t1": 3, "t2": 3, "t3": 3}},
+		"floor with a catch-all": {mode: appsv1alpha1.FloorRoundingModeType, catchAll: true, expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4}},
+		"ceil":                   {mode: appsv1alpha1.CeilRoundingModeType, expected: map[string]int32{"t1": 2, "t2": 4, "t3": 4}},
+	} {
+		ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3", CatchAll: c.catchAll})
+		ud.Spec.Topology.RoundingMode = c.mode
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+}
+
+func TestStabilityBias(t *testing.T) {
+	churn := func(current, next map[string]int32) int32 {
+		var diff int32
+		for name, replicas := range next {
+			if d := replicas - current[name]; d > 0 {
+				diff += d
+			} else {
+				diff -= d
+			}
+		}
+		return diff
+	}
+
+	for name, c := range map[string]struct {
+		replicas int32
+		current  map[string]int32
+		expected map[string]int32
+	}{
+		"one left over replica": {
+			replicas: 10,
+			current:  map[string]int32{"t1": 4, "t2": 3, "t3": 3},
+			expected: map[string]int32{"t1": 4, "t2": 3, "t3": 3},
+		},
+		"two left over replicas": {
+			replicas: 11,
+			current:  map[string]int32{"t1": 4, "t2": 4, "t3": 3},
+			expected: map[string]int32{"t1": 4, "t2": 4, "t3": 3},
+		},
+		"scale out": {
+			replicas: 13,
+			current:  map[string]int32{"t1": 5, "t2": 3, "t3": 3},
+			expected: map[string]int32{"t1": 5, "t2": 4, "t3": 4},
+		},
+	} {
+		ud := createUnitedDeployment(c.replicas, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Spec.Topology.RemainderPolicy = appsv1alpha1.SpreadBySmallestRemainderPolicyType
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(c.current), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		unbiased := churn(c.current, *next)
+
+		ud.Spec.Topology.StabilityBias = true
+		next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(c.current), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+		if biased := churn(c.current, *next); biased >= unbiased {
+			t.Fatalf("%s: expected fewer changes than %d with stability bias, got %d", name, unbiased, biased)
+		}
+	}
+}
+
+func TestMinReplicasPerSubset(t *testing.T) {
+	t1Replicas, t2Replicas := intstr.FromInt(6), intstr.FromInt(4)
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", Replicas: &t1Replicas},
+		appsv1alpha1.Subset{Name: "t2", Replicas: &t2Replicas},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 5, "t2": 3, "t3": 2})
+
+	result := GetAllocationResult(context.TODO(), nameToSubset, ud)
+	if !result.Effective || !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 6, "t2": 4, "t3": 0}) {
+		t.Fatalf("expected t3 drained without MinReplicasPerSubset, got %+v", result)
+	}
+
+	ud.Spec.Topology.MinReplicasPerSubset = true
+	result = GetAllocationResult(context.TODO(), nameToSubset, ud)
+	if result.Effective || result.ReasonCode != UnspecifiedSubsetsDrainedAllocationReason {
+		t.Fatalf("expected allocation rejected for draining t3, got %+v", result)
+	}
+	if !strings.Contains(result.Message, "0 of UnitedDeployment replica (10)") {
+		t.Fatalf("unexpected message %s", result.Message)
+	}
+
+	*ud.Spec.Replicas = 11
+	result = GetAllocationResult(context.TODO(), nameToSubset, ud)
+	if !result.Effective || !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 6, "t2": 4, "t3": 1}) {
+		t.Fatalf("expected one replica kept in t3, got %+v", result)
+	}
+}
+
+func TestReservedEmptySubset(t *testing.T) {
+	ud := createUnitedDeployment(9,
+		appsv1alpha1.Subset{Name: "t1"},
+		appsv1alpha1.Subset{Name: "t2"},
+		appsv1alpha1.Subset{Name: "t3"},
+	)
+	ud.Spec.Topology.ReservedEmptySubset = "t2"
+
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 3, "t2": 3, "t3": 3}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 4, "t2": 0, "t3": 5}) {
+		t.Fatalf("reserved subset should stay empty, got %v", *next)
+	}
+
+	ud.Spec.Topology.ReservedEmptySubset = ""
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(*next), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 3}) {
+		t.Fatalf("released subset should receive replicas again, got %v", *next)
+	}
+}
+
+func TestScaleToZero(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	zero, two := intstr.FromInt(0), intstr.FromInt(2)
+	allZero := map[string]int32{"t1": 0, "t2": 0, "t3": 0}
+	for name, c := range map[string]struct {
+		subsets []appsv1alpha1.Subset
+		weights map[string]int32
+		prior   map[string]int32
+		current map[string]int32
+		invalid bool
+	}{
+		"unspecified": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+		},
+		"unspecified by weights": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			weights: map[string]int32{"t1": 1, "t2": 2, "t3": 3},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+		},
+		"partly specified to zero": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &zero}, {Name: "t2"}, {Name: "t3"}},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+		},
+		"all specified to zero": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &zero}, {Name: "t2", Replicas: &zero}, {Name: "t3", Replicas: &zero}},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+		},
+		"scaled in from the last allocation": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			prior:   map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+		},
+		"drifted from zero": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			prior:   allZero,
+			current: map[string]int32{"t1": 1, "t2": 0, "t3": 0},
+		},
+		"specified over zero": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &two}, {Name: "t2"}, {Name: "t3"}},
+			current: map[string]int32{"t1": 3, "t2": 2, "t3": 1},
+			invalid: true,
+		},
+	} {
+		for _, incrementalAllocation = range []bool{false, true} {
+			ud := createUnitedDeployment(0, c.subsets...)
+			ud.Spec.Topology.PreferredWeights = c.weights
+			ud.Status.SubsetReplicas = c.prior
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(c.current), ud)
+			if c.invalid {
+				if err == nil {
+					t.Fatalf("%s: expected error for replicas specified over 0", name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			if !reflect.DeepEqual(*next, allZero) {
+				t.Fatalf("%s: expected all subsets scaled to zero with incremental allocation %v, got %v", name, incrementalAllocation, *next)
+			}
+		}
+	}
+}
+
+func TestNilUnitedDeploymentReplicas(t *testing.T) {
+	ud := createUnitedDeployment(0, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+	ud.Spec.Replicas = nil
+
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 0, "t2": 1}) {
+		t.Fatalf("nil replicas should be regarded as 1, got %v", *next)
+	}
+
+	// percentage replicas of subsets are parsed against the defaulted replicas too
+	percent := intstr.FromString("100%")
+	ud.Spec.Topology.Subsets[0].Replicas = &percent
+	ud.Spec.Topology.ScaleDownStabilizationWindowSeconds = int32Ptr(60)
+	result, err := PlanAllocation(ud, map[string]int32{"t1": 3, "t2": 3})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*result.SubsetReplicas, map[string]int32{"t1": 1, "t2": 0}) {
+		t.Fatalf("nil replicas should be regarded as 1, got %v", *result.SubsetReplicas)
+	}
+}
+
+func TestLastStableSubsetReplicas(t *testing.T) {
+	lastStable := intstr.FromString(appsv1alpha1.SubsetReplicasLastStable)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &lastStable}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 5, "t2": 5})
+
+	if _, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud); err == nil {
+		t.Fatalf("expected error without last stable replicas recorded")
+	}
+
+	ud.Status.LastStableSubsetReplicas = map[string]int32{"t1": 3, "t2": 3}
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 7}) {
+		t.Fatalf("t1 should hold its last stable replicas, got %v", *next)
+	}
+}
+
+func TestPercentageSpecifiedReplicas(t *testing.T) {
+	percent := intstr.FromString("33%")
+	ud := createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", Replicas: &percent},
+		appsv1alpha1.Subset{Name: "t2", Replicas: &percent},
+		appsv1alpha1.Subset{Name: "t3", Replicas: &percent},
+	)
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 3, "t3": 4}) {
+		t.Fatalf("the last percentage subset should absorb the rounding error, got %v", *next)
+	}
+
+	absolute := intstr.FromInt(2)
+	half := intstr.FromString("50%")
+	rest := intstr.FromString("30%")
+	ud = createUnitedDeployment(9,
+		appsv1alpha1.Subset{Name: "t1", Replicas: &absolute},
+		appsv1alpha1.Subset{Name: "t2", Replicas: &half},
+		appsv1alpha1.Subset{Name: "t3", Replicas: &rest},
+		appsv1alpha1.Subset{Name: "t4"},
+	)
+	specified, err := getSpecifiedSubsetReplicas(ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*specified, map[string]int32{"t1": 2, "t2": 5, "t3": 2}) {
+		t.Fatalf("percentage subsets should sum up to 80%% of the replicas, got %v", *specified)
+	}
+
+	over := intstr.FromString("60%")
+	ud = createUnitedDeployment(10,
+		appsv1alpha1.Subset{Name: "t1", Replicas: &over},
+		appsv1alpha1.Subset{Name: "t2", Replicas: &over},
+	)
+	if _, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud); err == nil {
+		t.Fatalf("expected error when the percentages exceed 100%%")
+	}
+}
+
+func TestScaleInPolicy(t *testing.T) {
+	// countOldPodDeletions scales the UnitedDeployment out and in repeatedly, and counts the pods deleted
+	// from the subsets which were not scaled out by the previous allocation, i.e. the pods existing
+	// before the last scale-out.
+	countOldPodDeletions := func(policy appsv1alpha1.ScaleInPolicyType) int32 {
+		ud := createUnitedDeployment(12, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+		ud.Spec.Topology.TieBreak = appsv1alpha1.RoundRobinTieBreakPolicyType
+		ud.Spec.Topology.ScaleInPolicy = policy
+		current := map[string]int32{"t1": 4, "t2": 4, "t3": 4}
+		generations := map[string]int64{}
+		var deleted int32
+		for i, replicas := range []int32{13, 14, 13, 14, 13} {
+			ud.Generation = int64(i + 1)
+			ud.Spec.Replicas = &replicas
+			nameToSubset := createNameToSubset(current)
+			for name, generation := range generations {
+				(*nameToSubset)[name].Status.LastScaledGeneration = generation
+			}
+			next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			for name, r := range *next {
+				if r > current[name] {
+					generations[name] = ud.Generation
+				} else if r < current[name] && generations[name] != ud.Generation-1 {
+					deleted += current[name] - r
+				}
+			}
+			current = *next
+		}
+		return deleted
+	}
+
+	if deleted := countOldPodDeletions(""); deleted != 1 {
+		t.Fatalf("expected 1 old pod deleted by default, got %d", deleted)
+	}
+	if deleted := countOldPodDeletions(appsv1alpha1.MostRecentlyScaledOutScaleInPolicyType); deleted != 0 {
+		t.Fatalf("expected no old pods deleted when shrinking the most recently scaled-out subsets, got %d", deleted)
+	}
+
+	// The subsets with fewer replicas lose the replicas left over first, so that none of them is scaled out on scale-in.
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.ScaleInPolicy = appsv1alpha1.MostRecentlyScaledOutScaleInPolicyType
+	nameToSubset := createNameToSubset(map[string]int32{"t1": 4, "t2": 4, "t3": 3})
+	(*nameToSubset)["t3"].Status.LastScaledGeneration = 2
+	(*nameToSubset)["t1"].Status.LastScaledGeneration = 1
+	next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(*next, map[string]int32{"t1": 3, "t2": 4, "t3": 3}) {
+		t.Fatalf("expected the most recently scaled-out subset among the largest ones to shrink, got %v", *next)
+	}
+}
+
+func TestCatchAllSubset(t *testing.T) {
+	intOrStrPtr := func(replicas int32) *intstr.IntOrString {
+		value := intstr.FromInt(int(replicas))
+		return &value
+	}
+
+	cases := []struct {
+		name     string
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		{
+			name:     "catch-all takes the remainder of the even split",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", Replicas: intOrStrPtr(3)},
+				{Name: "t2"},
+				{Name: "t3", CatchAll: true},
+			},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		{
+			name:     "catch-all takes the bulk when the others are under-subscribed",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", Replicas: intOrStrPtr(3)},
+				{Name: "t2", Replicas: intOrStrPtr(2)},
+				{Name: "t3", CatchAll: true},
+			},
+			expected: map[string]int32{"t1": 3, "t2": 2, "t3": 5},
+		},
+		{
+			name:     "catch-all takes zero when the others match the total",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", Replicas: intOrStrPtr(6)},
+				{Name: "t2", Replicas: intOrStrPtr(4)},
+				{Name: "t3", CatchAll: true},
+			},
+			expected: map[string]int32{"t1": 6, "t2": 4, "t3": 0},
+		},
+		{
+			name:     "catch-all can not absorb over-subscription",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", Replicas: intOrStrPtr(8)},
+				{Name: "t2", Replicas: intOrStrPtr(4)},
+				{Name: "t3", CatchAll: true},
+			},
+			reason: OverSpecifiedAllocationReason,
+		},
+		{
+			name:     "replicas over the max replicas of catch-all go back to the others",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1", Replicas: intOrStrPtr(3)},
+				{Name: "t2"},
+				{Name: "t3", CatchAll: true, MaxReplicas: int32Ptr(2)},
+			},
+			expected: map[string]int32{"t1": 3, "t2": 5, "t3": 2},
+		},
+		{
+			name:     "more than one catch-all subset",
+			replicas: 10,
+			subsets: []appsv1alpha1.Subset{
+				{Name: "t1"},
+				{Name: "t2", CatchAll: true},
+				{Name: "t3", CatchAll: true},
+			},
+			reason: MultipleCatchAllAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if c.reason != "" {
+				if result.Effective || result.ReasonCode != c.reason {
+					t.Fatalf("expected ineffective allocation of reason %s, got %+v", c.reason, result)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+		})
+	}
+}
+
+func TestProtectedSubset(t *testing.T) {
+	intOrStrPtr := func(replicas int32) *intstr.IntOrString {
+		value := intstr.FromInt(int(replicas))
+		return &value
+	}
+
+	cases := []struct {
+		name     string
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		current  map[string]int32
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		{
+			name:     "scale-in is taken from the unprotected subsets",
+			replicas: 11,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 7, "t2": 4, "t3": 4},
+			expected: map[string]int32{"t1": 7, "t2": 2, "t3": 2},
+		},
+		{
+			name:     "protected subset could still grow",
+			replicas: 15,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 3, "t2": 3, "t3": 3},
+			expected: map[string]int32{"t1": 5, "t2": 5, "t3": 5},
+		},
+		{
+			name:     "protected subset is shrunk if its replicas are specified explicitly",
+			replicas: 9,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true, Replicas: intOrStrPtr(2)}, {Name: "t2"}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 6, "t2": 3, "t3": 3},
+			expected: map[string]int32{"t1": 2, "t2": 3, "t3": 4},
+		},
+		{
+			name:     "only protected subsets are left to shrink",
+			replicas: 8,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Protected: true}, {Name: "t2", Protected: true}, {Name: "t3"}},
+			current:  map[string]int32{"t1": 5, "t2": 5, "t3": 2},
+			reason:   ProtectedSubsetsAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(c.replicas, c.subsets...)
+			result := GetAllocationResult(context.TODO(), createNameToSubset(c.current), ud)
+			if c.reason != "" {
+				if result.Effective || result.ReasonCode != c.reason {
+					t.Fatalf("expected ineffective allocation of reason %s, got %+v", c.reason, result)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+		})
+	}
+}
+
+func TestMinimumEffectiveReplicas(t *testing.T) {
+	two, three, four := intstr.FromInt(2), intstr.FromInt(3), intstr.FromInt(4)
+	for name, c := range map[string]struct {
+		subsets  []appsv1alpha1.Subset
+		expected int32
+	}{
+		"all specified": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &three}, {Name: "t2", Replicas: &four}},
+			expected: 7,
+		},
+		"mixed": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &four}, {Name: "t2"}, {Name: "t3"}},
+			expected: 6,
+		},
+		"each specified within the total": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &two}, {Name: "t2", Replicas: &two}, {Name: "t3"}},
+			expected: 5,
+		},
+	} {
+		ud := createUnitedDeployment(3, c.subsets...)
+		minimum, err := MinimumEffectiveReplicas(ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if minimum != c.expected {
+			t.Fatalf("%s: expected %d, got %d", name, c.expected, minimum)
+		}
+
+		result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if result.ReasonCode != OverSpecifiedAllocationReason || !strings.Contains(result.Message, fmt.Sprintf("increase replicas to at least %d", c.expected)) {
+			t.Fatalf("%s: expected the message to tell the minimum replicas, got %+v", name, result)
+		}
+	}
+}
+
+func TestTolerantSpecifiedPercentages(t *testing.T) {
+	p49, p50, p51 := intstr.FromString("49%"), intstr.FromString("50%"), intstr.FromString("51%")
+	for name, c := range map[string]struct {
+		subsets  []appsv1alpha1.Subset
+		expected map[string]int32
+	}{
+		"sum to 99%": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p50}, {Name: "t2", Replicas: &p49}},
+			expected: map[string]int32{"t1": 50, "t2": 50},
+		},
+		"sum to 101%": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p50}, {Name: "t2", Replicas: &p51}},
+			expected: map[string]int32{"t1": 50, "t2": 50},
+		},
+		"sum to 99% with an unspecified subset": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p50}, {Name: "t2", Replicas: &p49}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 50, "t2": 49, "t3": 1},
+		},
+	} {
+		// the last percentage subset takes the replicas left within the tolerance if all subsets are percentages
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), createUnitedDeployment(100, c.subsets...))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+}
+
+func TestValidateSpecifiedPercentages(t *testing.T) {
+	p30, p33, p34, p40, p50 := intstr.FromString("30%"), intstr.FromString("33%"), intstr.FromString("34%"), intstr.FromString("40%"), intstr.FromString("50%")
+	three := intstr.FromInt(3)
+	for name, c := range map[string]struct {
+		subsets  []appsv1alpha1.Subset
+		expected AllocationReasonCode
+	}{
+		"sum to 90%": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p30}, {Name: "t3", Replicas: &p30}},
+			expected: UnderSpecifiedAllocationReason,
+		},
+		"sum to 100%": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p30}, {Name: "t3", Replicas: &p40}},
+		},
+		"sum to 110%": {
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p40}, {Name: "t3", Replicas: &p40}},
+			expected: OverSpecifiedAllocationReason,
+		},
+		"sum to 99% within the tolerance": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &p33}, {Name: "t2", Replicas: &p33}, {Name: "t3", Replicas: &p33}},
+		},
+		"sum to 101% within the tolerance": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &p33}, {Name: "t2", Replicas: &p34}, {Name: "t3", Replicas: &p34}},
+		},
+		"unspecified subset takes the rest": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p50}, {Name: "t3"}},
+		},
+		"absolute subset takes its own": {
+			subsets: []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p30}, {Name: "t3", Replicas: &three}},
+		},
+	} {
+		err := ValidateSpecifiedPercentages(createUnitedDeployment(10, c.subsets...))
+		if c.expected == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			continue
+		}
+		allocationErr, ok := err.(*allocationError)
+		if !ok || allocationErr.reason != c.expected {
+			t.Fatalf("%s: expected an error of %s, got %v", name, c.expected, err)
+		}
+	}
+}
+
+func TestAllocationNearMaxInt32(t *testing.T) {
+	max := intstr.FromInt(math.MaxInt32)
+	overSpecified := createUnitedDeployment(math.MaxInt32, appsv1alpha1.Subset{Name: "t1", Replicas: &max},
+		appsv1alpha1.Subset{Name: "t2", Replicas: &max}, appsv1alpha1.Subset{Name: "t3"})
+	if result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), overSpecified); result.ReasonCode != OverSpecifiedAllocationReason {
+		t.Fatalf("expected specified replicas summing over int32 to be over-specified, got %+v", result)
+	}
+	if _, err := MinimumEffectiveReplicas(overSpecified); err == nil {
+		t.Fatalf("expected an error for the minimum replicas out of int32 range")
+	}
+
+	whole := createUnitedDeployment(math.MaxInt32, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), whole)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var sum int64
+	for _, replicas := range *next {
+		sum += int64(replicas)
+	}
+	if sum != math.MaxInt32 {
+		t.Fatalf("expected all of %d replicas to be allocated, got %v", int32(math.MaxInt32), *next)
+	}
+
+	capped := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", MaxReplicas: int32Ptr(math.MaxInt32)},
+		appsv1alpha1.Subset{Name: "t2", MaxReplicas: int32Ptr(math.MaxInt32)})
+	next, err = GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), capped)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := map[string]int32{"t1": 5, "t2": 5}; !reflect.DeepEqual(*next, expected) {
+		t.Fatalf("expected %v, got %v", expected, *next)
+	}
+}
+
+// recordingLogger records the messages logged together with their key-value pairs.
+type recordingLogger struct {
+	logs   *[]map[string]interface{}
+	values []interface{}
+}
+
+func (l recordingLogger) Enabled() bool { return true }
+
+func (l recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record(nil, msg, keysAndValues)
+}
+
+func (l recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.record(err, msg, keysAndValues)
+}
+
+func (l recordingLogger) V(level int) logr.Logger { return l }
+
+func (l recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return recordingLogger{logs: l.logs, values: append(append([]interface{}{}, l.values...), keysAndValues...)}
+}
+
+func (l recordingLogger) WithName(name string) logr.Logger { return l }
+
+func (l recordingLogger) record(err error, msg string, keysAndValues []interface{}) {
+	entry := map[string]interface{}{"msg": msg, "err": err}
+	keysAndValues = append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		entry[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	*l.logs = append(*l.logs, entry)
+}
+
+func TestStructuredAllocationLog(t *testing.T) {
+	origin := allocationLogger
+	defer func() {
+		allocationLogger = origin
+	}()
+	var logs []map[string]interface{}
+	allocationLogger = recordingLogger{logs: &logs}
+
+	invalid := intstr.FromString("abc")
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &invalid}, appsv1alpha1.Subset{Name: "t2"})
+	if _, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, entry := range logs {
+		if entry["subset"] == "t1" {
+			if entry["namespace"] != "default" || entry["name"] != "foo" || entry["err"] == nil {
+				t.Fatalf("expected namespace, name and err of the parse failure, got %v", entry)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected the parse failure of subset t1 to be logged, got %v", logs)
+}
+
+func TestSubsetReplicasOverflow(t *testing.T) {
+	_, err := ParseSubsetReplicas(10, intstr.FromInt(11))
+	var overflow *SubsetReplicasOverflowError
+	if !errors.As(err, &overflow) {
+		t.Fatalf("expected SubsetReplicasOverflowError, got %v", err)
+	}
+	if overflow.SubsetReplicas != 11 || overflow.UDReplicas != 10 {
+		t.Fatalf("unexpected overflow %+v", overflow)
+	}
+	if replicas, err := ParseSubsetReplicas(10, intstr.FromInt(10)); err != nil || replicas != 10 {
+		t.Fatalf("expected the whole replicas to be accepted, got %d, %v", replicas, err)
+	}
+
+	eleven := intstr.FromInt(11)
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1", Replicas: &eleven}, appsv1alpha1.Subset{Name: "t2"})
+	result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{"t1": 5, "t2": 5}), ud)
+	if result.Effective || result.ReasonCode != OverSpecifiedAllocationReason {
+		t.Fatalf("expected ineffective allocation of reason %s, got %+v", OverSpecifiedAllocationReason, result)
+	}
+}
+
+func TestParseSubsetReplicas(t *testing.T) {
+	cases := []struct {
+		name           string
+		subsetReplicas intstr.IntOrString
+		expected       int32
+		negative       bool
+		overflow       bool
+		malformed      bool
+	}{
+		{name: "absolute", subsetReplicas: intstr.FromInt(4), expected: 4},
+		{name: "zero", subsetReplicas: intstr.FromInt(0), expected: 0},
+		{name: "whole", subsetReplicas: intstr.FromInt(10), expected: 10},
+		{name: "negative", subsetReplicas: intstr.FromInt(-1), negative: true},
+		{name: "greater than total", subsetReplicas: intstr.FromInt(11), overflow: true},
+		{name: "percentage", subsetReplicas: intstr.FromString("50%"), expected: 5},
+		{name: "percentage rounded half up", subsetReplicas: intstr.FromString("25%"), expected: 3},
+		{name: "zero percentage", subsetReplicas: intstr.FromString("0%"), expected: 0},
+		{name: "whole percentage", subsetReplicas: intstr.FromString("100%"), expected: 10},
+		{name: "percentage above 100", subsetReplicas: intstr.FromString("150%"), expected: 10},
+		{name: "negative percentage", subsetReplicas: intstr.FromString("-10%"), expected: 0},
+		{name: "no suffix", subsetReplicas: intstr.FromString("5"), malformed: true},
+		{name: "not a number", subsetReplicas: intstr.FromString("abc%"), malformed: true},
+		{name: "suffix only", subsetReplicas: intstr.FromString("%"), malformed: true},
+		{name: "decimal percentage", subsetReplicas: intstr.FromString("10.5%"), malformed: true},
+		{name: "empty", subsetReplicas: intstr.FromString(""), malformed: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			replicas, err := ParseSubsetReplicas(10, c.subsetReplicas)
+			var negative *SubsetReplicasNegativeError
+			var overflow *SubsetReplicasOverflowError
+			switch {
+			case c.negative:
+				if !errors.As(err, &negative) || negative.SubsetReplicas != c.subsetReplicas.IntVal {
+					t.Fatalf("expected SubsetReplicasNegativeError, got %v", err)
+				}
+			case c.overflow:
+				if !errors.As(err, &overflow) || overflow.SubsetReplicas != c.subsetReplicas.IntVal || overflow.UDReplicas != 10 {
+					t.Fatalf("expected SubsetReplicasOverflowError, got %v", err)
+				}
+			case c.malformed:
+				if err == nil || errors.As(err, &negative) || errors.As(err, &overflow) {
+					t.Fatalf("expected a malformed replicas error, got %d, %v", replicas, err)
+				}
+			default:
+				if err != nil || replicas != c.expected {
+					t.Fatalf("expected %d, got %d, %v", c.expected, replicas, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSubsetReplicasOverride(t *testing.T) {
+	two := intstr.FromInt(2)
+	cases := []struct {
+		name     string
+		override string
+		expected map[string]int32
+		reason   AllocationReasonCode
+	}{
+		{
+			name:     "partial override",
+			override: `{"t3": 1}`,
+			expected: map[string]int32{"t1": 2, "t2": 7, "t3": 1},
+		},
+		{
+			name:     "override wins over the topology",
+			override: `{"t1": 5, "t3": 1}`,
+			expected: map[string]int32{"t1": 5, "t2": 4, "t3": 1},
+		},
+		{
+			name:     "override of unknown subset",
+			override: `{"t1": 5, "t4": 1}`,
+			reason:   UnknownSubsetAllocationReason,
+		},
+		{
+			name:     "override over the replicas",
+			override: `{"t2": 6, "t3": 6}`,
+			reason:   OverSpecifiedAllocationReason,
+		},
+		{
+			name:     "negative override",
+			override: `{"t3": -1}`,
+			reason:   InvalidReplicasOverrideAllocationReason,
+		},
+		{
+			name:     "malformed override",
+			override: `{"t3": "1"}`,
+			reason:   InvalidReplicasOverrideAllocationReason,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ud := createUnitedDeployment(10,
+				appsv1alpha1.Subset{Name: "t1", Replicas: &two},
+				appsv1alpha1.Subset{Name: "t2"},
+				appsv1alpha1.Subset{Name: "t3"},
+			)
+			ud.Annotations = map[string]string{appsv1alpha1.AnnotationSubsetReplicasOverride: c.override}
+			result := GetAllocationResult(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+			if c.reason != "" {
+				if result.Effective || result.ReasonCode != c.reason {
+					t.Fatalf("expected ineffective allocation of reason %s, got %+v", c.reason, result)
+				}
+				return
+			}
+			if !result.Effective {
+				t.Fatalf("unexpected ineffective allocation %+v", result)
+			}
+			if !reflect.DeepEqual(*result.SubsetReplicas, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, *result.SubsetReplicas)
+			}
+		})
+	}
+}
+
+func BenchmarkAllocateManySubsets(b *testing.B) {
+	const count = 500
+	for name, maxReplicasOf := range map[string]func(i, remaining int32) *int32{
+		"unbounded": func(i, remaining int32) *int32 {
+			return nil
+		},
+		// each cap is just below the share left to the subset, so that the average caps them in several passes
+		"capped below the shares": func(i, remaining int32) *int32 {
+			if i == count-1 {
+				return nil
+			}
+			return int32Ptr(remaining/(count-i) - 1)
+		},
+	} {
+		b.Run(name, func(b *testing.B) {
+			replicas := int32(count * (count - 1) * 2)
+			remaining := replicas
+			subsets := make([]appsv1alpha1.Subset, 0, count)
+			current := map[string]int32{}
+			for i := int32(0); i < count; i++ {
+				subset := appsv1alpha1.Subset{Name: fmt.Sprintf("subset-%03d", i), MaxReplicas: maxReplicasOf(i, remaining)}
+				if subset.MaxReplicas != nil {
+					remaining -= *subset.MaxReplicas
+				}
+				subsets = append(subsets, subset)
+				current[subset.Name] = i % 5
+			}
+			ud := createUnitedDeployment(replicas, subsets...)
+			nameToSubset := createNameToSubset(current)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if result := GetAllocationResult(context.TODO(), nameToSubset, ud); !result.Effective {
+					b.Fatalf("unexpected ineffective allocation %+v", result)
+				}
+			}
+		})
+	}
+}
+
 func createSubset(name string, replicas int32) *nameToReplicas {
 	return &nameToReplicas{
 		Replicas:   replicas,
 		SubsetName: name,
 	}
 }
+
+func createUnitedDeployment(replicas int32, subsets ...appsv1alpha1.Subset) *appsv1alpha1.UnitedDeployment {
+	return &appsv1alpha1.UnitedDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo",
+		},
+		Spec: appsv1alpha1.UnitedDeploymentSpec{
+			Replicas: &replicas,
+			Topology: appsv1alpha1.Topology{
+				Subsets: subsets,
+			},
+		},
+	}
+}
+
+func createNameToSubset(nameToReplicas map[string]int32) *map[string]*Subset {
+	nameToSubset := map[string]*Subset{}
+	for name, replicas := range nameToReplicas {
+		nameToSubset[name] = &Subset{
+			Spec: SubsetSpec{
+				SubsetName: name,
+				Replicas:   replicas,
+			},
+		}
+	}
+
+	return &nameToSubset
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"fmt"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// capTotalReplicas clamps the replicas to allocate to Topology.MaxTotalReplicas, and returns the message of the
+// TotalReplicasCapped condition if they are clamped, or an empty message.
+func capTotalReplicas(ud *appsv1alpha1.UnitedDeployment, replicas int32) (int32, string) {
+	maxTotal := ud.Spec.Topology.MaxTotalReplicas
+	if maxTotal == nil || *maxTotal < 0 || replicas <= *maxTotal {
+		return replicas, ""
+	}
+	return *maxTotal, fmt.Sprintf("replicas %d are capped at maxTotalReplicas %d", replicas, *maxTotal)
+}
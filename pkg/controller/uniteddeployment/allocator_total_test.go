@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestMaxTotalReplicas(t *testing.T) {
+	two := intstr.FromInt(2)
+	for name, c := range map[string]struct {
+		replicas int32
+		maxTotal *int32
+		subsets  []appsv1alpha1.Subset
+		expected map[string]int32
+		capped   bool
+	}{
+		"no cap": {
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"replicas within the cap": {
+			replicas: 10,
+			maxTotal: int32Ptr(10),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4},
+		},
+		"replicas exceeding the cap": {
+			replicas: 10,
+			maxTotal: int32Ptr(7),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 2, "t2": 2, "t3": 3},
+			capped:   true,
+		},
+		"specified subset kept under the cap": {
+			replicas: 10,
+			maxTotal: int32Ptr(6),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &two}, {Name: "t2"}, {Name: "t3"}},
+			expected: map[string]int32{"t1": 2, "t2": 2, "t3": 2},
+			capped:   true,
+		},
+		"capped to zero": {
+			replicas: 10,
+			maxTotal: int32Ptr(0),
+			subsets:  []appsv1alpha1.Subset{{Name: "t1"}, {Name: "t2"}},
+			expected: map[string]int32{"t1": 0, "t2": 0},
+			capped:   true,
+		},
+	} {
+		ud := createUnitedDeployment(c.replicas, c.subsets...)
+		ud.Spec.Topology.MaxTotalReplicas = c.maxTotal
+		next, allocation, err := allocateSubsetReplicas(context.TODO(), createNameToSubset(map[string]int32{}), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+		if capped := allocation.totalCappedReason != ""; capped != c.capped {
+			t.Fatalf("%s: expected capped %v, got reason %q", name, c.capped, allocation.totalCappedReason)
+		}
+	}
+}
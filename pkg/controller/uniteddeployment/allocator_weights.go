@@ -0,0 +1,235 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+// memoryHeadroomShareScale is the scale of the shares returned by getMemoryHeadroomWeights, which are in basis points.
+const memoryHeadroomShareScale = 10000
+
+// getMemoryHeadroomWeights returns the share of each subset by its memory headroom, clamped into the bounds of
+// Spec.Topology.MemoryHeadroomWeighting, or nil if it is not configured or there is no data.
+func getMemoryHeadroomWeights(ctx context.Context, ud *appsv1alpha1.UnitedDeployment) map[string]int32 {
+	weighting := ud.Spec.Topology.MemoryHeadroomWeighting
+	if weighting == nil {
+		return nil
+	}
+
+	headroom := getSubsetMemoryHeadroom(ctx, ud)
+	var sum int64
+	for _, subset := range ud.Spec.Topology.Subsets {
+		if headroom[subset.Name] > 0 {
+			sum += headroom[subset.Name]
+		}
+	}
+	if sum == 0 {
+		return nil
+	}
+
+	minShare, maxShare := 0.0, 1.0
+	if weighting.MinSharePercent != nil {
+		minShare = clampPercent(*weighting.MinSharePercent)
+	}
+	if weighting.MaxSharePercent != nil {
+		maxShare = clampPercent(*weighting.MaxSharePercent)
+	}
+
+	weights := map[string]int32{}
+	for _, subset := range ud.Spec.Topology.Subsets {
+		share := math.Max(0, float64(headroom[subset.Name])) / float64(sum)
+		share = math.Min(math.Max(share, minShare), maxShare)
+		weights[subset.Name] = int32(math.Round(share * memoryHeadroomShareScale))
+	}
+	return weights
+}
+
+// blendedPreferredWeights returns the weight of each subset moved from even toward the preferred weights
+// by preferredBiasPercent, or nil if there is no preferred distribution for these subsets.
+func (s *replicasAllocator) blendedPreferredWeights(subsets []*nameToReplicas) []float64 {
+	if len(s.preferredWeights) == 0 || s.preferredBiasPercent <= 0 {
+		return nil
+	}
+
+	var sum int64
+	for _, subset := range subsets {
+		if weight := s.preferredWeights[subset.SubsetName]; weight > 0 {
+			sum += int64(weight)
+		}
+	}
+	if sum == 0 {
+		return nil
+	}
+
+	bias := math.Min(float64(s.preferredBiasPercent), 100) / 100
+	weights := make([]float64, len(subsets))
+	for i, subset := range subsets {
+		var preferred float64
+		if weight := s.preferredWeights[subset.SubsetName]; weight > 0 {
+			preferred = float64(weight) / float64(sum)
+		}
+		weights[i] = (1-bias)/float64(len(subsets)) + bias*preferred
+	}
+
+	return weights
+}
+
+// riskAdjustedWeights scales down the weight of each subset by its interruption risk, so that the replicas
+// are shifted away from the subsets ahead of their interruption. Nil weights are regarded as even.
+func (s *replicasAllocator) riskAdjustedWeights(subsets []*nameToReplicas, weights []float64) []float64 {
+	if len(s.interruptionRisks) == 0 {
+		return weights
+	}
+
+	return scaleWeights(subsets, weights, func(name string) float64 {
+		return 1 - clampPercent(s.interruptionRisks[name])
+	})
+}
+
+// successAdjustedWeights scales the weight of each subset by its scheduling success rate, so that fewer replicas
+// are sent to the subsets which frequently fail to schedule pods. Nil weights are regarded as even.
+func (s *replicasAllocator) successAdjustedWeights(subsets []*nameToReplicas, weights []float64) []float64 {
+	if len(s.schedulingSuccessRates) == 0 {
+		return weights
+	}
+
+	return scaleWeights(subsets, weights, func(name string) float64 {
+		rate, exist := s.schedulingSuccessRates[name]
+		if !exist {
+			return 1
+		}
+		return clampPercent(rate)
+	})
+}
+
+// scaleWeights multiplies the weight of each subset by its factor. Nil weights are regarded as even. It returns
+// weights unchanged if all the scaled weights are 0.
+func scaleWeights(subsets []*nameToReplicas, weights []float64, factor func(name string) float64) []float64 {
+	var sum float64
+	scaled := make([]float64, len(subsets))
+	for i, subset := range subsets {
+		weight := 1 / float64(len(subsets))
+		if weights != nil {
+			weight = weights[i]
+		}
+		scaled[i] = weight * factor(subset.SubsetName)
+		sum += scaled[i]
+	}
+	if sum == 0 {
+		return weights
+	}
+
+	return scaled
+}
+
+// clampPercent returns the percentage clamped in range [0, 100] as a fraction.
+func clampPercent(percent int32) float64 {
+	return math.Max(0, math.Min(float64(percent), 100)) / 100
+}
+
+// allocateByWeights distributes replicas to the subsets in proportion to their weights by the largest remainder
+// method. Ties of the remainder are broken in favor of the subsets at the end, in the same way as allocateAverage.
+// A subset whose share exceeds its upper bound is capped, or whose share is below its min replicas is raised to
+// them, and what is left is distributed among the others again. It returns the replicas which can not be allocated,
+// and the unrounded share of each subset which is not capped or raised.
+func allocateByWeights(subsets []*nameToReplicas, replicas int32, weights []float64) (int32, map[string]float64) {
+	pending := make([]int, len(subsets))
+	for i := range subsets {
+		pending[i] = i
+	}
+
+	for len(pending) > 0 {
+		shares, exact := weightedShares(replicas, pending, weights)
+
+		var uncapped []int
+		for i, idx := range pending {
+			subset := subsets[idx]
+			if bound := subset.upperBound(); bound != nil && shares[i] > *bound {
+				subset.Replicas, subset.PinnedBy = *bound, pinnedByMax
+				replicas -= *bound
+				continue
+			}
+			if floor := subset.MinReplicas; floor != nil && shares[i] < *floor {
+				subset.Replicas, subset.PinnedBy = *floor, pinnedByMin
+				replicas -= *floor
+				continue
+			}
+			uncapped = append(uncapped, idx)
+		}
+
+		if len(uncapped) == len(pending) {
+			ideal := make(map[string]float64, len(pending))
+			for i, idx := range pending {
+				subsets[idx].Replicas = shares[i]
+				ideal[subsets[idx].SubsetName] = exact[i]
+			}
+			return 0, ideal
+		}
+		pending = uncapped
+	}
+
+	return replicas, nil
+}
+
+// weightedShares splits replicas among the pending indexes in proportion to their weights, and returns the rounded
+// shares together with the unrounded ones. If all of them have no weight, replicas are split evenly.
+func weightedShares(replicas int32, pending []int, weights []float64) ([]int32, []float64) {
+	var total float64
+	for _, idx := range pending {
+		total += weights[idx]
+	}
+
+	exact := make([]float64, len(pending))
+	for i, idx := range pending {
+		if total > 0 {
+			exact[i] = float64(replicas) * weights[idx] / total
+		} else {
+			exact[i] = float64(replicas) / float64(len(pending))
+		}
+	}
+
+	shares := make([]int32, len(pending))
+	var allocated int32
+	for i := range exact {
+		shares[i] = int32(math.Floor(exact[i]))
+		allocated += shares[i]
+	}
+
+	order := make([]int, len(pending))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		fa := exact[order[a]] - math.Floor(exact[order[a]])
+		fb := exact[order[b]] - math.Floor(exact[order[b]])
+		if fa != fb {
+			return fa > fb
+		}
+		return order[a] > order[b]
+	})
+	for i := 0; allocated < replicas; i++ {
+		shares[order[i%len(order)]]++
+		allocated++
+	}
+
+	return shares, exact
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestPreferredWeights(t *testing.T) {
+	ud := createUnitedDeployment(10, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"}, appsv1alpha1.Subset{Name: "t3"})
+	ud.Spec.Topology.PreferredWeights = map[string]int32{"t1": 6, "t2": 3, "t3": 1}
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	cases := []struct {
+		bias     *int32
+		expected map[string]int32
+	}{
+		{bias: nil, expected: map[string]int32{"t1": 6, "t2": 3, "t3": 1}},
+		{bias: int32Ptr(100), expected: map[string]int32{"t1": 6, "t2": 3, "t3": 1}},
+		{bias: int32Ptr(50), expected: map[string]int32{"t1": 5, "t2": 3, "t3": 2}},
+		{bias: int32Ptr(25), expected: map[string]int32{"t1": 4, "t2": 3, "t3": 3}},
+		{bias: int32Ptr(0), expected: map[string]int32{"t1": 3, "t2": 3, "t3": 4}},
+	}
+	for _, c := range cases {
+		ud.Spec.Topology.PreferredBiasPercent = c.bias
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("bias %v: expected %v, got %v", c.bias, c.expected, *next)
+		}
+	}
+}
+
+func TestPreferredWeightsWithMaxReplicas(t *testing.T) {
+	infos := subsetInfos{
+		createSubset("t1", 0),
+		createSubset("t2", 0),
+		createSubset("t3", 0),
+	}
+	infos[0].MaxReplicas = int32Ptr(4)
+	allocator := infos.SortToAllocator()
+	allocator.preferredWeights = map[string]int32{"t1": 6, "t2": 3, "t3": 1}
+	allocator.preferredBiasPercent = 100
+	if _, err := allocator.AllocateReplicas(10, &map[string]int32{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if " t3 -> 2; t1 -> 4; t2 -> 4;" != allocator.String() {
+		t.Fatalf("unexpected %s", allocator)
+	}
+}
+
+func TestRoundingAdjustments(t *testing.T) {
+	for name, c := range map[string]struct {
+		weights map[string]int32
+		ideal   map[string]float64
+	}{
+		"even": {
+			ideal: map[string]float64{"t1": 10.0 / 3, "t2": 10.0 / 3, "t3": 10.0 / 3},
+		},
+		"weighted": {
+			weights: map[string]int32{"t1": 45, "t2": 45, "t3": 10},
+			ideal:   map[string]float64{"t1": 4.5, "t2": 4.5, "t3": 1},
+		},
+	} {
+		infos := subsetInfos{createSubset("t1", 0), createSubset("t2", 0), createSubset("t3", 0)}
+		allocator := infos.SortToAllocator()
+		if c.weights != nil {
+			allocator.preferredWeights = c.weights
+			allocator.preferredBiasPercent = 100
+		}
+		next, err := allocator.AllocateReplicas(10, &map[string]int32{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+
+		expected := map[string]appsv1alpha1.SubsetRoundingAdjustment{}
+		for subset, ideal := range c.ideal {
+			if diff := (*next)[subset] - int32(math.Round(ideal)); diff != 0 {
+				expected[subset] = appsv1alpha1.SubsetRoundingAdjustment{IdealMilliReplicas: int64(math.Round(ideal * 1000)), Adjustment: diff}
+			}
+		}
+		if len(expected) == 0 {
+			t.Fatalf("%s: expected some rounding adjustments of %v", name, *next)
+		}
+		for subset := range allocator.roundingAdjustments {
+			adjustment := allocator.roundingAdjustments[subset]
+			if adjustment.Reason == "" {
+				t.Fatalf("%s: expected a reason of the adjustment of subset %s", name, subset)
+			}
+			adjustment.Reason = ""
+			allocator.roundingAdjustments[subset] = adjustment
+		}
+		if !reflect.DeepEqual(allocator.roundingAdjustments, expected) {
+			t.Fatalf("%s: expected rounding adjustments %v of %v, got %v", name, expected, *next, allocator.roundingAdjustments)
+		}
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestWeightedScaleIn(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+	// the incremental allocation only keeps the last allocated replicas of the same total, so a scale-in is
+	// recomputed by the weights
+	incrementalAllocation = true
+
+	for name, c := range map[string]struct {
+		replicas  int32
+		protected bool
+		expected  map[string]int32
+	}{
+		"scale in to 6": {
+			replicas: 6,
+			expected: map[string]int32{"t1": 4, "t2": 2},
+		},
+		"scale in to 3": {
+			replicas: 3,
+			expected: map[string]int32{"t1": 2, "t2": 1},
+		},
+		"scale in to 6 above the floor": {
+			replicas:  6,
+			protected: true,
+			expected:  map[string]int32{"t1": 3, "t2": 3},
+		},
+	} {
+		ud := createUnitedDeployment(c.replicas, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2", Protected: c.protected})
+		ud.Spec.Topology.PreferredWeights = map[string]int32{"t1": 2, "t2": 1}
+		ud.Status.SubsetReplicas = map[string]int32{"t1": 6, "t2": 3}
+		next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(map[string]int32{"t1": 6, "t2": 3}), ud)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(*next, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", name, c.expected, *next)
+		}
+	}
+}
+
+func TestWeightedScaleOutIncrementally(t *testing.T) {
+	origin := incrementalAllocation
+	defer func() {
+		incrementalAllocation = origin
+	}()
+
+	movement := func(current, next map[string]int32) int32 {
+		var moved int32
+		for name, replicas := range next {
+			if diff := replicas - current[name]; diff > 0 {
+				moved += diff
+			} else {
+				moved -= diff
+			}
+		}
+		return moved
+	}
+
+	for name, c := range map[string]struct {
+		replicas    int32
+		weights     map[string]int32
+		current     map[string]int32
+		fromScratch map[string]int32
+		incremental map[string]int32
+	}{
+		"over-weighted subset is kept": {
+			replicas:    12,
+			weights:     map[string]int32{"t1": 1, "t2": 1},
+			current:     map[string]int32{"t1": 8, "t2": 2},
+			fromScratch: map[string]int32{"t1": 6, "t2": 6},
+			incremental: map[string]int32{"t1": 8, "t2": 4},
+		},
+		"added replicas follow the deficits": {
+			replicas:    16,
+			weights:     map[string]int32{"t1": 2, "t2": 1, "t3": 1},
+			current:     map[string]int32{"t1": 10, "t2": 2, "t3": 0},
+			fromScratch: map[string]int32{"t1": 8, "t2": 4, "t3": 4},
+			incremental: map[string]int32{"t1": 10, "t2": 3, "t3": 3},
+		},
+	} {
+		plans := map[bool]map[string]int32{}
+		for _, enabled := range []bool{false, true} {
+			incrementalAllocation = enabled
+			var subsets []appsv1alpha1.Subset
+			for _, subset := range []string{"t1", "t2", "t3"} {
+				if _, exist := c.current[subset]; exist {
+					subsets = append(subsets, appsv1alpha1.Subset{Name: subset})
+				}
+			}
+			ud := createUnitedDeployment(c.replicas, subsets...)
+			ud.Spec.Topology.PreferredWeights = c.weights
+			ud.Status.SubsetReplicas = c.current
+			next, err := GetAllocatedReplicas(context.TODO(), createNameToSubset(c.current), ud)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+			plans[enabled] = *next
+		}
+
+		if !reflect.DeepEqual(plans[false], c.fromScratch) {
+			t.Fatalf("%s: expected the from-scratch plan %v, got %v", name, c.fromScratch, plans[false])
+		}
+		if !reflect.DeepEqual(plans[true], c.incremental) {
+			t.Fatalf("%s: expected the incremental plan %v, got %v", name, c.incremental, plans[true])
+		}
+		if movement(c.current, plans[true]) >= movement(c.current, plans[false]) {
+			t.Fatalf("%s: expected the incremental plan %v to move less than the from-scratch plan %v", name, plans[true], plans[false])
+		}
+	}
+}
@@ -45,11 +45,19 @@ type SubsetStatus struct {
 	ReadyReplicas        int32
 	UpdatedReplicas      int32
 	UpdatedReadyReplicas int32
+	// Unschedulable indicates the pods of the subset can not be scheduled for now, so it should not receive
+	// more replicas.
+	Unschedulable bool
+	// LastScaledGeneration is the generation of the UnitedDeployment when the subset was scaled out last time.
+	LastScaledGeneration int64
 }
 
 // SubsetUpdateStrategy stores the strategy detail of the Subset.
 type SubsetUpdateStrategy struct {
 	Partition int32
+	// MaxSurge is the max number of pods that can be scheduled above the desired replicas during rolling update.
+	// Nil means the subset does not surge.
+	MaxSurge *int32
 }
 
 // ResourceRef stores the Subset resource it represents.
@@ -19,6 +19,7 @@ package uniteddeployment
 import (
 	"context"
 	"reflect"
+	"strconv"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -83,6 +84,9 @@ func (m *SubsetControl) CreateSubset(ud *alpha1.UnitedDeployment, subsetName str
 	if err := m.adapter.ApplySubsetTemplate(ud, subsetName, revision, replicas, partition, set); err != nil {
 		return err
 	}
+	if replicas > 0 {
+		markSubsetScaled(set, ud.Generation)
+	}
 
 	klog.V(4).Infof("Have %d replicas when creating Subset for UnitedDeployment %s/%s", replicas, ud.Namespace, ud.Name)
 	return m.Create(context.TODO(), set)
@@ -101,6 +105,9 @@ func (m *SubsetControl) UpdateSubset(subset *Subset, ud *alpha1.UnitedDeployment
 		if err := m.adapter.ApplySubsetTemplate(ud, subset.Spec.SubsetName, revision, replicas, partition, set); err != nil {
 			return err
 		}
+		if replicas > subset.Spec.Replicas {
+			markSubsetScaled(set, ud.Generation)
+		}
 
 		updateError = m.Client.Update(context.TODO(), set)
 		if updateError == nil {
@@ -169,18 +176,33 @@ func (m *SubsetControl) convertToSubset(set metav1.Object, updatedRevision strin
 	if specPartition != nil {
 		subset.Spec.UpdateStrategy.Partition = *specPartition
 	}
+	subset.Spec.UpdateStrategy.MaxSurge = m.adapter.GetMaxSurge(set)
 
 	subset.Status.ObservedGeneration = m.adapter.GetStatusObservedGeneration(set)
 	subset.Status.Replicas = statusReplicas
 	subset.Status.ReadyReplicas = statusReadyReplicas
 	subset.Status.UpdatedReplicas = statusUpdatedReplicas
 	subset.Status.UpdatedReadyReplicas = statusUpdatedReadyReplicas
+	subset.Status.Unschedulable = set.GetAnnotations()[alpha1.AnnotationSubsetUnschedulable] == "true"
+	if generation, err := strconv.ParseInt(set.GetAnnotations()[alpha1.AnnotationSubsetLastScaledGeneration], 10, 64); err == nil {
+		subset.Status.LastScaledGeneration = generation
+	}
 
 	subset.Spec.SubsetRef.Resources = append(subset.Spec.SubsetRef.Resources, set)
 
 	return subset, nil
 }
 
+// markSubsetScaled records the generation of the UnitedDeployment scaling out the subset on its workload.
+func markSubsetScaled(set metav1.Object, generation int64) {
+	annotations := set.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[alpha1.AnnotationSubsetLastScaledGeneration] = strconv.FormatInt(generation, 10)
+	set.SetAnnotations(annotations)
+}
+
 func (m *SubsetControl) objectKey(objMeta *metav1.ObjectMeta) client.ObjectKey {
 	return types.NamespacedName{
 		Namespace: objMeta.Namespace,
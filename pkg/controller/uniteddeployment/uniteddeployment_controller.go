@@ -32,6 +32,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -44,11 +45,19 @@ import (
 
 func init() {
 	flag.IntVar(&concurrentReconciles, "uniteddeployment-workers", concurrentReconciles, "Max concurrent workers for UnitedDeployment controller.")
+	flag.StringVar(&allocationPluginSocket, "uniteddeployment-allocation-plugin-socket", allocationPluginSocket, "The unix socket of the JSON-RPC allocation plugin for UnitedDeployment controller.")
+	flag.StringVar(&allocationReviewURL, "uniteddeployment-allocation-review-url", allocationReviewURL, "The URL of the webhook reviewing each allocation of UnitedDeployment controller before it is applied.")
+	flag.BoolVar(&recordAllocationDecisions, "uniteddeployment-record-allocation-decisions", recordAllocationDecisions, "Record each allocation change of UnitedDeployment in a ConfigMap.")
+	flag.BoolVar(&incrementalAllocation, "uniteddeployment-incremental-allocation", incrementalAllocation, "Adjust only the drifted subset of UnitedDeployment instead of recomputing the allocation of all subsets.")
+	flag.BoolVar(&allocationRationale, "uniteddeployment-allocation-rationale", allocationRationale, "Explain why each subset of UnitedDeployment gets its replicas in the logs of verbosity 4.")
+	flag.Float64Var(&churnWarningRatio, "uniteddeployment-churn-warning-ratio", churnWarningRatio, "Warn when an allocation of UnitedDeployment relocates more than this ratio of its replicas between subsets.")
 }
 
 var (
-	concurrentReconciles = 3
-	controllerKind       = appsv1alpha1.SchemeGroupVersion.WithKind("UnitedDeployment")
+	concurrentReconciles   = 3
+	allocationPluginSocket = ""
+	allocationReviewURL    = ""
+	controllerKind         = appsv1alpha1.SchemeGroupVersion.WithKind("UnitedDeployment")
 )
 
 const (
@@ -78,6 +87,12 @@ func Add(mgr manager.Manager) error {
 	if !utildiscovery.DiscoverGVK(controllerKind) {
 		return nil
 	}
+	if allocationPluginSocket != "" {
+		Providers.Plugin = NewRPCAllocationPlugin(allocationPluginSocket)
+	}
+	if allocationReviewURL != "" {
+		Providers.Reviewer = NewHTTPAllocationReviewer(allocationReviewURL)
+	}
 	return add(mgr, newReconciler(mgr))
 }
 
@@ -169,16 +184,18 @@ type ReconcileUnitedDeployment struct {
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=apps,resources=replicasets/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=create
 
 // Reconcile reads that state of the cluster for a UnitedDeployment object and makes changes based on the state read
 // and what is in the UnitedDeployment.Spec
-func (r *ReconcileUnitedDeployment) Reconcile(_ context.Context, request reconcile.Request) (reconcile.Result, error) {
+func (r *ReconcileUnitedDeployment) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
 	klog.V(4).Infof("Reconcile UnitedDeployment %s/%s", request.Namespace, request.Name)
 	// Fetch the UnitedDeployment instance
 	instance := &appsv1alpha1.UnitedDeployment{}
 	err := r.Get(context.TODO(), request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			deleteUnitedDeploymentMetrics(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, err
@@ -211,16 +228,45 @@ func (r *ReconcileUnitedDeployment) Reconcile(_ context.Context, request reconci
 		return reconcile.Result{}, err
 	}
 
-	nextReplicas, err := GetAllocatedReplicas(nameToSubset, instance)
-	klog.V(4).Infof("Get UnitedDeployment %s/%s next replicas %v", instance.Namespace, instance.Name, nextReplicas)
-	if err != nil {
+	nextReplicas, allocation, err := allocateSubsetReplicas(ctx, nameToSubset, instance)
+	klog.V(4).Infof("Get UnitedDeployment %s/%s next replicas%s", instance.Namespace, instance.Name, subsetReplicasStringByName(nextReplicas))
+	if allocation.rationale != nil {
+		klog.V(4).Infof("Get UnitedDeployment %s/%s allocation rationale %v", instance.Namespace, instance.Name, allocation.rationale)
+	}
+	explanation := ""
+	if allocation.rationale != nil {
+		explanation = explainAllocation(nextReplicas, allocation.rationale)
+	}
+	if allocation.pinnedSubsets != nil {
+		klog.V(4).Infof("Get UnitedDeployment %s/%s subsets pinned at boundaries %v", instance.Namespace, instance.Name, allocation.pinnedSubsets)
+	}
+	if nextReplicas != nil {
+		if churn := ChurnRatio(getCurrentSubsetReplicas(nameToSubset), *nextReplicas); churn > churnWarningRatio {
+			klog.Warningf("UnitedDeployment %s/%s relocates %.0f%% of its replicas between subsets:%s", instance.Namespace, instance.Name, churn*100, subsetReplicasStringByName(nextReplicas))
+		}
+	}
+	if err != nil && allocationReasonOf(err) == CancelledAllocationReason {
+		// nothing is wrong with the UnitedDeployment, so the allocation is recorded neither in metrics nor as ineffective
+		klog.V(4).Infof("UnitedDeployment %s/%s gives up allocating subset replicas: %s", instance.Namespace, instance.Name, err)
+		return reconcile.Result{}, err
+	}
+	recordAllocationMetrics(instance, newAllocationResult(nextReplicas, err))
+	allSubsetsUnavailable := err != nil && allocationReasonOf(err) == AllSubsetsUnavailableAllocationReason
+	if allSubsetsUnavailable {
+		klog.Warningf("UnitedDeployment %s/%s keeps the current subset replicas since %s:%s", instance.Namespace, instance.Name, err, subsetReplicasStringByName(nextReplicas))
+		r.recordIneffectiveAllocation(instance, err)
+	} else if err != nil {
 		klog.Errorf("UnitedDeployment %s/%s Specified subset replicas is ineffective: %s",
 			instance.Namespace, instance.Name, err.Error())
-		r.recorder.Eventf(instance.DeepCopy(), corev1.EventTypeWarning, fmt.Sprintf("Failed %s",
-			eventTypeSpecifySubbsetReplicas), "Specified subset replicas is ineffective: %s", err.Error())
+		r.recordIneffectiveAllocation(instance, err)
 		return reconcile.Result{}, err
 	}
 
+	nextReplicas = sequenceNextReplicas(instance, nameToSubset, nextReplicas)
+	nextReplicas = orderNextReplicasByDependencies(instance, nameToSubset, nextReplicas)
+	if Converged(getCurrentSubsetReplicas(nameToSubset), *nextReplicas) {
+		klog.V(4).Infof("UnitedDeployment %s/%s subset replicas converged to%s", instance.Namespace, instance.Name, subsetReplicasStringByName(nextReplicas))
+	}
 	nextPartitions := calcNextPartitions(instance, nextReplicas)
 	klog.V(4).Infof("Get UnitedDeployment %s/%s next partition %v", instance.Namespace, instance.Name, nextPartitions)
 
@@ -231,7 +277,51 @@ func (r *ReconcileUnitedDeployment) Reconcile(_ context.Context, request reconci
 		return reconcile.Result{}, err
 	}
 
-	return r.updateStatus(instance, newStatus, oldStatus, nameToSubset, nextReplicas, nextPartitions, currentRevision, updatedRevision, collisionCount, control)
+	newStatus.SubsetRamps = allocation.subsetRamps
+	newStatus.RoundingAdjustments = allocation.roundingAdjustments
+	newStatus.OnboardingSubsets = allocation.onboardingSubsets
+	newStatus.AllocationExplanation = explanation
+	if allocation.scaleOutCursor != nil {
+		newStatus.ScaleOutCursor = *allocation.scaleOutCursor
+	}
+	if allSubsetsUnavailable {
+		SetUnitedDeploymentCondition(newStatus, NewUnitedDeploymentCondition(appsv1alpha1.AllSubsetsUnavailable, corev1.ConditionTrue, "AllSubsetsConstrained", errAllSubsetsUnavailable.Error()))
+	} else {
+		RemoveUnitedDeploymentCondition(newStatus, appsv1alpha1.AllSubsetsUnavailable)
+	}
+	if allocation.unsatisfiedDomainsReason != "" {
+		SetUnitedDeploymentCondition(newStatus, NewUnitedDeploymentCondition(appsv1alpha1.MinDomainsUnsatisfied, corev1.ConditionTrue, "InsufficientDomains", allocation.unsatisfiedDomainsReason))
+	} else {
+		RemoveUnitedDeploymentCondition(newStatus, appsv1alpha1.MinDomainsUnsatisfied)
+	}
+	if allocation.totalCappedReason != "" {
+		SetUnitedDeploymentCondition(newStatus, NewUnitedDeploymentCondition(appsv1alpha1.TotalReplicasCapped, corev1.ConditionTrue, "MaxTotalReplicasExceeded", allocation.totalCappedReason))
+	} else {
+		RemoveUnitedDeploymentCondition(newStatus, appsv1alpha1.TotalReplicasCapped)
+	}
+	if allocation.rebalancing {
+		SetUnitedDeploymentCondition(newStatus, NewUnitedDeploymentCondition(appsv1alpha1.SubsetsRebalancing, corev1.ConditionTrue, "RebalanceBudgetExceeded", "more replicas are to be moved between subsets in the following reconciles"))
+	} else {
+		RemoveUnitedDeploymentCondition(newStatus, appsv1alpha1.SubsetsRebalancing)
+	}
+	result, err := r.updateStatus(instance, newStatus, oldStatus, nameToSubset, nextReplicas, nextPartitions, currentRevision, updatedRevision, collisionCount, control)
+	if err != nil {
+		return result, err
+	}
+
+	r.recordAllocationDecision(instance, oldStatus.SubsetReplicas, *nextReplicas)
+	r.recordAllocationEvents(instance, oldStatus.SubsetReplicas, *nextReplicas)
+	if isRebalanceRequested(instance) {
+		err = r.clearRebalanceRequest(instance)
+	}
+	return result, err
+}
+
+// clearRebalanceRequest removes the rebalance-now annotation, so that the requested rebalance is done only once.
+func (r *ReconcileUnitedDeployment) clearRebalanceRequest(ud *appsv1alpha1.UnitedDeployment) error {
+	klog.V(4).Infof("Rebalance of UnitedDeployment %s/%s generation %d is done", ud.Namespace, ud.Name, ud.Generation)
+	body := fmt.Sprintf(`{"metadata":{"annotations":{"%s":null}}}`, appsv1alpha1.AnnotationRebalanceNow)
+	return r.Patch(context.TODO(), ud, client.RawPatch(types.MergePatchType, []byte(body)))
 }
 
 func (r *ReconcileUnitedDeployment) getNameToSubset(instance *appsv1alpha1.UnitedDeployment, control ControlInterface, expectedRevision string) (*map[string]*Subset, error) {
@@ -335,8 +425,23 @@ func (r *ReconcileUnitedDeployment) classifySubsetBySubsetName(ud *appsv1alpha1.
 
 func (r *ReconcileUnitedDeployment) updateStatus(instance *appsv1alpha1.UnitedDeployment, newStatus, oldStatus *appsv1alpha1.UnitedDeploymentStatus, nameToSubset *map[string]*Subset, nextReplicas, nextPartition *map[string]int32, currentRevision, updatedRevision *appsv1.ControllerRevision, collisionCount int32, control ControlInterface) (reconcile.Result, error) {
 	newStatus = r.calculateStatus(newStatus, nameToSubset, nextReplicas, nextPartition, currentRevision, updatedRevision, collisionCount, control)
+	newStatus.ReplicasHistory = getReplicasHistory(instance)
+	newStatus.SubsetReplicasChangeTimes = getSubsetReplicasChangeTimes(instance, *nextReplicas)
+	newStatus.CanaryRamp = getCanaryRampStatus(instance)
+	newStatus.SubsetHighWaterMarks = getSubsetHighWaterMarks(instance, *nextReplicas)
+	if isStable(instance, newStatus) {
+		newStatus.LastStableSubsetReplicas = getCurrentSubsetReplicas(nameToSubset)
+	}
 	_, err := r.updateUnitedDeployment(instance, oldStatus, newStatus)
-	return reconcile.Result{}, err
+
+	requeueAfter := getStabilizationRequeueAfter(instance)
+	if after := getSubsetReplicasChangeRequeueAfter(instance, newStatus); after > 0 && (requeueAfter == 0 || after < requeueAfter) {
+		requeueAfter = after
+	}
+	if after := getCanaryRampRequeueAfter(instance, newStatus); after > 0 && (requeueAfter == 0 || after < requeueAfter) {
+		requeueAfter = after
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, err
 }
 
 func (r *ReconcileUnitedDeployment) calculateStatus(newStatus *appsv1alpha1.UnitedDeploymentStatus, nameToSubset *map[string]*Subset, nextReplicas, nextPartition *map[string]int32, currentRevision, updatedRevision *appsv1.ControllerRevision, collisionCount int32, control ControlInterface) *appsv1alpha1.UnitedDeploymentStatus {
@@ -395,6 +500,20 @@ func (r *ReconcileUnitedDeployment) calculateStatus(newStatus *appsv1alpha1.Unit
 	return newStatus
 }
 
+// isStable returns true if all the desired replicas of the UnitedDeployment are ready.
+func isStable(ud *appsv1alpha1.UnitedDeployment, status *appsv1alpha1.UnitedDeploymentStatus) bool {
+	replicas := getUnitedDeploymentReplicas(ud)
+	return status.Replicas == replicas && status.ReadyReplicas == replicas
+}
+
+func getCurrentSubsetReplicas(nameToSubset *map[string]*Subset) map[string]int32 {
+	replicas := map[string]int32{}
+	for name, subset := range *nameToSubset {
+		replicas[name] = subset.Spec.Replicas
+	}
+	return replicas
+}
+
 var replicasStatusFn = replicasStatus
 
 func replicasStatus(subset *Subset) (replicas, readyReplicas, updatedReplicas, updatedReadyReplicas int32) {
@@ -415,7 +534,17 @@ func (r *ReconcileUnitedDeployment) updateUnitedDeployment(ud *appsv1alpha1.Unit
 		ud.Generation == newStatus.ObservedGeneration &&
 		reflect.DeepEqual(oldStatus.SubsetReplicas, newStatus.SubsetReplicas) &&
 		reflect.DeepEqual(oldStatus.UpdateStatus, newStatus.UpdateStatus) &&
-		reflect.DeepEqual(oldStatus.Conditions, newStatus.Conditions) {
+		reflect.DeepEqual(oldStatus.Conditions, newStatus.Conditions) &&
+		reflect.DeepEqual(oldStatus.ReplicasHistory, newStatus.ReplicasHistory) &&
+		reflect.DeepEqual(oldStatus.SubsetRamps, newStatus.SubsetRamps) &&
+		reflect.DeepEqual(oldStatus.RoundingAdjustments, newStatus.RoundingAdjustments) &&
+		oldStatus.ScaleOutCursor == newStatus.ScaleOutCursor &&
+		reflect.DeepEqual(oldStatus.OnboardingSubsets, newStatus.OnboardingSubsets) &&
+		reflect.DeepEqual(oldStatus.LastStableSubsetReplicas, newStatus.LastStableSubsetReplicas) &&
+		reflect.DeepEqual(oldStatus.SubsetReplicasChangeTimes, newStatus.SubsetReplicasChangeTimes) &&
+		reflect.DeepEqual(oldStatus.CanaryRamp, newStatus.CanaryRamp) &&
+		oldStatus.AllocationExplanation == newStatus.AllocationExplanation &&
+		reflect.DeepEqual(oldStatus.SubsetHighWaterMarks, newStatus.SubsetHighWaterMarks) {
 		return ud, nil
 	}
 
@@ -32,11 +32,49 @@ import (
 
 const updateRetries = 5
 
+// DefaultLeaderSubsetReplicas is the number of replicas of a leader subset whose replicas is not indicated.
+const DefaultLeaderSubsetReplicas int32 = 1
+
+// IsLastStableSubsetReplicas returns true if the subset replicas hold the last stable replicas of the subset.
+func IsLastStableSubsetReplicas(subsetReplicas *intstr.IntOrString) bool {
+	return subsetReplicas != nil && subsetReplicas.Type == intstr.String && subsetReplicas.StrVal == appsv1alpha1.SubsetReplicasLastStable
+}
+
+// SubsetReplicasOverflowError is returned by ParseSubsetReplicas if the absolute replicas of a subset
+// exceed the replicas of the UnitedDeployment on their own.
+type SubsetReplicasOverflowError struct {
+	SubsetReplicas int32
+	UDReplicas     int32
+}
+
+func (e *SubsetReplicasOverflowError) Error() string {
+	return fmt.Sprintf("subset replicas (%d) should not be greater than UnitedDeployment replicas (%d)", e.SubsetReplicas, e.UDReplicas)
+}
+
+// SubsetReplicasNegativeError is returned by ParseSubsetReplicas if the absolute replicas of a subset are negative.
+type SubsetReplicasNegativeError struct {
+	SubsetReplicas int32
+}
+
+func (e *SubsetReplicasNegativeError) Error() string {
+	return fmt.Sprintf("subset replicas (%d) should not be less than 0", e.SubsetReplicas)
+}
+
 // ParseSubsetReplicas parses the subsetReplicas, and returns the replicas number depending on the sum replicas.
+//
+// An integer subsetReplicas "N" is taken as the absolute replicas of the subset. It returns a
+// *SubsetReplicasNegativeError if N is less than 0, and a *SubsetReplicasOverflowError if N is greater than udReplicas.
+//
+// A string subsetReplicas "X%" is taken relative to udReplicas and rounded half up. X must be an integer, and is
+// clamped to [0, 100], so that a percentage never makes up less than nothing or more than the whole UnitedDeployment.
+// Any other string, including a decimal percentage, returns an error.
 func ParseSubsetReplicas(udReplicas int32, subsetReplicas intstr.IntOrString) (int32, error) {
 	if subsetReplicas.Type == intstr.Int {
 		if subsetReplicas.IntVal < 0 {
-			return 0, fmt.Errorf("subset replicas (%d) should not be less than 0", subsetReplicas.IntVal)
+			return 0, &SubsetReplicasNegativeError{SubsetReplicas: subsetReplicas.IntVal}
+		}
+		if subsetReplicas.IntVal > udReplicas {
+			return 0, &SubsetReplicasOverflowError{SubsetReplicas: subsetReplicas.IntVal, UDReplicas: udReplicas}
 		}
 		return subsetReplicas.IntVal, nil
 	}
@@ -52,8 +90,10 @@ func ParseSubsetReplicas(udReplicas int32, subsetReplicas intstr.IntOrString) (i
 		return 0, fmt.Errorf("subset replicas (%s) should be correct percentage integer: %s", strVal, err)
 	}
 
-	if percent64 > int64(100) || percent64 < int64(0) {
-		return 0, fmt.Errorf("subset replicas (%s) should be in range [0, 100]", strVal)
+	if percent64 > int64(100) {
+		percent64 = 100
+	} else if percent64 < int64(0) {
+		percent64 = 0
 	}
 
 	return int32(round(float64(udReplicas) * float64(percent64) / 100)), nil
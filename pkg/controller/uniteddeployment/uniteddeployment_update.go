@@ -18,6 +18,7 @@ package uniteddeployment
 
 import (
 	"fmt"
+	"reflect"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -145,6 +146,7 @@ func (r *ReconcileUnitedDeployment) manageSubsetProvision(ud *appsv1alpha1.Unite
 				deleteErrs = append(deleteErrs, fmt.Errorf("fail to delete Subset (%s) %s/%s for %s: %s", subsetType, subset.Namespace, subset.Name, subsetName, err))
 			}
 		}
+		deleteAllocationMetrics(ud, deletes)
 
 		if len(deleteErrs) > 0 {
 			errs = append(errs, deleteErrs...)
@@ -177,3 +179,104 @@ func (r *ReconcileUnitedDeployment) manageSubsetProvision(ud *appsv1alpha1.Unite
 
 	return expectedSubsets.Intersection(gotSubsets), len(creates) > 0 || len(deletes) > 0 || cleaned, utilerrors.NewAggregate(errs)
 }
+
+// sequenceNextReplicas holds the subsets scaling in one direction at their current replicas until the subsets
+// scaling in the direction to go first, as Spec.Topology.ApplyOrder indicates, are done. A subset being scaled
+// down is done once its pods are removed, and a subset being scaled up is done once all its pods are ready.
+func sequenceNextReplicas(ud *appsv1alpha1.UnitedDeployment, nameToSubset *map[string]*Subset, nextReplicas *map[string]int32) *map[string]int32 {
+	order := ud.Spec.Topology.ApplyOrder
+	if order != appsv1alpha1.DownFirstApplyOrderType && order != appsv1alpha1.UpFirstApplyOrderType {
+		return nextReplicas
+	}
+
+	var scalingDown, scalingUp bool
+	for name, replicas := range *nextReplicas {
+		var current, present, ready int32
+		if subset, exist := (*nameToSubset)[name]; exist {
+			current, present, ready = subset.Spec.Replicas, subset.Status.Replicas, subset.Status.ReadyReplicas
+		}
+		if replicas < current || present > current {
+			scalingDown = true
+		}
+		if replicas > current || ready < current {
+			scalingUp = true
+		}
+	}
+
+	holdUp := order == appsv1alpha1.DownFirstApplyOrderType && scalingDown
+	holdDown := order == appsv1alpha1.UpFirstApplyOrderType && scalingUp
+	if !holdUp && !holdDown {
+		return nextReplicas
+	}
+
+	sequenced := map[string]int32{}
+	for name, replicas := range *nextReplicas {
+		var current int32
+		if subset, exist := (*nameToSubset)[name]; exist {
+			current = subset.Spec.Replicas
+		}
+		if (holdUp && replicas > current) || (holdDown && replicas < current) {
+			replicas = current
+		}
+		sequenced[name] = replicas
+	}
+	klog.V(4).Infof("UnitedDeployment %s/%s applies replicas %v in order %s toward %v", ud.Namespace, ud.Name, sequenced, order, *nextReplicas)
+	return &sequenced
+}
+
+// orderNextReplicasByDependencies holds the subsets starting from 0 replicas at 0 until the subsets they depend on
+// are ready at their next replicas, and holds the subsets being scaled down to 0 at their current replicas until
+// the subsets depending on them are drained.
+func orderNextReplicasByDependencies(ud *appsv1alpha1.UnitedDeployment, nameToSubset *map[string]*Subset, nextReplicas *map[string]int32) *map[string]int32 {
+	dependents := map[string][]string{}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		for _, dependency := range subsetDef.DependsOn {
+			dependents[dependency] = append(dependents[dependency], subsetDef.Name)
+		}
+	}
+	if len(dependents) == 0 {
+		return nextReplicas
+	}
+
+	ordered := map[string]int32{}
+	for _, subsetDef := range ud.Spec.Topology.Subsets {
+		name := subsetDef.Name
+		replicas := (*nextReplicas)[name]
+		var current int32
+		if subset, exist := (*nameToSubset)[name]; exist {
+			current = subset.Spec.Replicas
+		}
+
+		if current == 0 && replicas > 0 {
+			for _, dependency := range subsetDef.DependsOn {
+				if !isSubsetReadyAt(nameToSubset, dependency, (*nextReplicas)[dependency]) {
+					replicas = 0
+					break
+				}
+			}
+		} else if current > 0 && replicas == 0 {
+			for _, dependent := range dependents[name] {
+				if subset, exist := (*nameToSubset)[dependent]; exist && (subset.Spec.Replicas > 0 || subset.Status.Replicas > 0) {
+					replicas = current
+					break
+				}
+			}
+		}
+		ordered[name] = replicas
+	}
+
+	if !reflect.DeepEqual(ordered, *nextReplicas) {
+		klog.V(4).Infof("UnitedDeployment %s/%s applies replicas %v in order of subset dependencies toward %v", ud.Namespace, ud.Name, ordered, *nextReplicas)
+	}
+	return &ordered
+}
+
+// isSubsetReadyAt returns true if the subset has the replicas applied and all its pods are ready.
+func isSubsetReadyAt(nameToSubset *map[string]*Subset, name string, replicas int32) bool {
+	if replicas == 0 {
+		return true
+	}
+
+	subset, exist := (*nameToSubset)[name]
+	return exist && subset.Spec.Replicas >= replicas && subset.Status.ReadyReplicas >= replicas
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kruise Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package uniteddeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
+)
+
+func TestSequenceNextReplicas(t *testing.T) {
+	for order, expected := range map[appsv1alpha1.ApplyOrderType][]map[string]int32{
+		appsv1alpha1.DownFirstApplyOrderType: {
+			{"t1": 4, "t2": 2},
+			{"t1": 4, "t2": 2},
+			{"t1": 4, "t2": 4},
+		},
+		appsv1alpha1.UpFirstApplyOrderType: {
+			{"t1": 6, "t2": 4},
+			{"t1": 6, "t2": 4},
+			{"t1": 4, "t2": 4},
+		},
+	} {
+		ud := createUnitedDeployment(8, appsv1alpha1.Subset{Name: "t1"}, appsv1alpha1.Subset{Name: "t2"})
+		ud.Spec.Topology.ApplyOrder = order
+		nameToSubset := createNameToSubset(map[string]int32{"t1": 6, "t2": 2})
+		for _, subset := range *nameToSubset {
+			subset.Status.Replicas = subset.Spec.Replicas
+			subset.Status.ReadyReplicas = subset.Spec.Replicas
+		}
+
+		for i, exp := range expected {
+			next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			next = sequenceNextReplicas(ud, nameToSubset, next)
+			if !reflect.DeepEqual(*next, exp) {
+				t.Fatalf("%s step %d: expected %v, got %v", order, i, exp, *next)
+			}
+
+			// the pods are created or removed in the next round after the replicas are applied
+			for name, subset := range *nameToSubset {
+				subset.Status.Replicas = subset.Spec.Replicas
+				subset.Status.ReadyReplicas = subset.Spec.Replicas
+				subset.Spec.Replicas = (*next)[name]
+			}
+		}
+	}
+}
+
+func TestOrderNextReplicasByDependencies(t *testing.T) {
+	ud := createUnitedDeployment(4, appsv1alpha1.Subset{Name: "t1", DependsOn: []string{"t2"}}, appsv1alpha1.Subset{Name: "t2"})
+	nameToSubset := createNameToSubset(map[string]int32{})
+
+	steps := []struct {
+		replicas int32
+		ready    map[string]int32
+		expected map[string]int32
+	}{
+		{replicas: 4, ready: map[string]int32{}, expected: map[string]int32{"t1": 0, "t2": 2}},
+		{replicas: 4, ready: map[string]int32{"t2": 1}, expected: map[string]int32{"t1": 0, "t2": 2}},
+		{replicas: 4, ready: map[string]int32{"t2": 2}, expected: map[string]int32{"t1": 2, "t2": 2}},
+		{replicas: 0, ready: map[string]int32{"t1": 2, "t2": 2}, expected: map[string]int32{"t1": 0, "t2": 2}},
+		{replicas: 0, ready: map[string]int32{"t2": 2}, expected: map[string]int32{"t1": 0, "t2": 0}},
+	}
+	for i, step := range steps {
+		replicas := step.replicas
+		ud.Spec.Replicas = &replicas
+		for name, subset := range *nameToSubset {
+			subset.Status.Replicas = step.ready[name]
+			subset.Status.ReadyReplicas = step.ready[name]
+		}
+
+		next, err := GetAllocatedReplicas(context.TODO(), nameToSubset, ud)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		next = orderNextReplicasByDependencies(ud, nameToSubset, next)
+		if !reflect.DeepEqual(*next, step.expected) {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, *next)
+		}
+		nameToSubset = createNameToSubset(*next)
+	}
+}
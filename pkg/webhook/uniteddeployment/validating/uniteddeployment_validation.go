@@ -17,6 +17,7 @@ limitations under the License.
 package validating
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -60,13 +61,17 @@ func validateUnitedDeploymentSpec(spec *appsv1alpha1.UnitedDeploymentSpec, fldPa
 		allErrs = append(allErrs, validateSubsetTemplate(&spec.Template, selector, fldPath.Child("template"))...)
 	}
 
-	var sumReplicas int32
+	var sumReplicas, lastPercentReplicas int32
+	var percentCount int
+	var percentSum, percentReplicas int64
 	var expectedReplicas int32 = 1
 	if spec.Replicas != nil {
 		expectedReplicas = *spec.Replicas
 	}
 	subSetNames := sets.String{}
 	count := 0
+	leaderCount, roleCount := 0, 0
+	catchAllCount := 0
 	for i, subset := range spec.Topology.Subsets {
 		if len(subset.Name) == 0 {
 			allErrs = append(allErrs, field.Required(fldPath.Child("topology", "subsets").Index(i).Child("name"), ""))
@@ -102,18 +107,103 @@ func validateUnitedDeploymentSpec(spec *appsv1alpha1.UnitedDeploymentSpec, fldPa
 			allErrs = append(allErrs, apivalidation.ValidateTolerations(coreTolerations, fldPath.Child("topology", "subsets").Index(i).Child("tolerations"))...)
 		}
 
+		if subset.Role != "" {
+			roleCount++
+			if subset.Role == appsv1alpha1.LeaderSubsetRole {
+				leaderCount++
+			} else if subset.Role != appsv1alpha1.FollowerSubsetRole {
+				allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "subsets").Index(i).Child("role"), subset.Role,
+					[]string{string(appsv1alpha1.LeaderSubsetRole), string(appsv1alpha1.FollowerSubsetRole)}))
+			}
+		}
+
+		if subset.CatchAll {
+			catchAllCount++
+		}
+
+		if subset.MaxScaleInPercent != nil && (*subset.MaxScaleInPercent < 1 || *subset.MaxScaleInPercent > 100) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("maxScaleInPercent"), *subset.MaxScaleInPercent, "maxScaleInPercent should be in range [1, 100]"))
+		}
+
+		if subset.MaxReplicas != nil && *subset.MaxReplicas < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("maxReplicas"), *subset.MaxReplicas, "maxReplicas should not be less than 0"))
+		}
+
+		if subset.SystemReservedReplicas != nil && *subset.SystemReservedReplicas < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("systemReservedReplicas"), *subset.SystemReservedReplicas, "systemReservedReplicas should not be less than 0"))
+		}
+
+		if subset.SoftMinReplicas != nil && *subset.SoftMinReplicas < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("softMinReplicas"), *subset.SoftMinReplicas, "softMinReplicas should not be less than 0"))
+		}
+
+		if subset.RelativeTo != nil {
+			if subset.Replicas != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("relativeTo"), subset.RelativeTo.Subset, "relativeTo should not be set together with replicas"))
+			}
+			if subset.RelativeTo.RatioPercent < 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("relativeTo", "ratioPercent"), subset.RelativeTo.RatioPercent, "ratioPercent should not be less than 0"))
+			}
+		}
+
 		if subset.Replicas == nil {
+			if subset.Role == appsv1alpha1.LeaderSubsetRole {
+				sumReplicas += udctrl.DefaultLeaderSubsetReplicas
+				count++
+			}
+			continue
+		}
+		if udctrl.IsLastStableSubsetReplicas(subset.Replicas) {
+			continue
+		}
+
+		// ParseSubsetReplicas clamps percentages into [0, 100], which should still be rejected in the spec
+		percent, isPercent := udctrl.SubsetReplicasPercent(*subset.Replicas)
+		if isPercent && (percent < 0 || percent > 100) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("replicas percentage %d%% should be in range [0%%, 100%%]", percent)))
 			continue
 		}
 
 		replicas, err := udctrl.ParseSubsetReplicas(expectedReplicas, *subset.Replicas)
-		if err != nil {
+		var overflow *udctrl.SubsetReplicasOverflowError
+		var negative *udctrl.SubsetReplicasNegativeError
+		if errors.As(err, &overflow) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("replicas %d should not be greater than UnitedDeployment replicas %d", overflow.SubsetReplicas, overflow.UDReplicas)))
+		} else if errors.As(err, &negative) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("replicas %d should not be less than 0", negative.SubsetReplicas)))
+		} else if err != nil {
 			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("invalid replicas %s", subset.Replicas.String())))
 		} else {
+			if subset.MaxReplicas != nil && subset.SystemReservedReplicas != nil && *subset.SystemReservedReplicas > 0 {
+				if maxReplicas := *subset.MaxReplicas - *subset.SystemReservedReplicas; replicas > maxReplicas {
+					allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("replicas %d should not be greater than maxReplicas %d minus systemReservedReplicas %d", replicas, *subset.MaxReplicas, *subset.SystemReservedReplicas)))
+				}
+			} else if subset.MaxReplicas != nil && replicas > *subset.MaxReplicas {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets").Index(i).Child("replicas"), subset.Replicas, fmt.Sprintf("replicas %d should not be greater than maxReplicas %d", replicas, *subset.MaxReplicas)))
+			}
 			sumReplicas += replicas
 			count++
+			if isPercent {
+				percentCount++
+				lastPercentReplicas = replicas
+				percentSum += percent
+				percentReplicas += int64(replicas)
+			}
 		}
 	}
+	// the last percentage-specified subset absorbs the rounding errors as the controller does
+	if percentSum > 0 {
+		sumReplicas += udctrl.AbsorbPercentageRounding(expectedReplicas, percentSum, percentReplicas, lastPercentReplicas,
+			percentCount == len(spec.Topology.Subsets)) - lastPercentReplicas
+	}
+
+	if roleCount > 0 && leaderCount != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets"), leaderCount, fmt.Sprintf("there should be exactly one leader subset if subset roles are indicated, but got %d", leaderCount)))
+	}
+
+	if catchAllCount > 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "subsets"), catchAllCount, fmt.Sprintf("there should be at most one catch-all subset, but got %d", catchAllCount)))
+	}
 
 	// sum of subset replicas may be less than uniteddployment replicas
 	if sumReplicas > expectedReplicas {
@@ -132,6 +222,276 @@ func validateUnitedDeploymentSpec(spec *appsv1alpha1.UnitedDeploymentSpec, fldPa
 		}
 	}
 
+	if spec.Topology.SmoothingAlphaPercent != nil {
+		if alpha := *spec.Topology.SmoothingAlphaPercent; alpha < 1 || alpha > 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "smoothingAlphaPercent"), alpha, "smoothingAlphaPercent should be in range [1, 100]"))
+		}
+	}
+
+	switch spec.Topology.RampCurve {
+	case "", appsv1alpha1.ExponentialRampCurveType, appsv1alpha1.LinearRampCurveType, appsv1alpha1.SCurveRampCurveType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "rampCurve"), spec.Topology.RampCurve,
+			[]string{string(appsv1alpha1.ExponentialRampCurveType), string(appsv1alpha1.LinearRampCurveType), string(appsv1alpha1.SCurveRampCurveType)}))
+	}
+
+	allErrs = append(allErrs, validateSubsetDependencies(spec.Topology.Subsets, subSetNames, fldPath.Child("topology", "subsets"))...)
+
+	overflowSubsets := sets.String{}
+	for i, name := range spec.Topology.OverflowOrder {
+		if !subSetNames.Has(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "overflowOrder").Index(i), name, fmt.Sprintf("subset %s does not exist", name)))
+		}
+		if overflowSubsets.Has(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "overflowOrder").Index(i), name, fmt.Sprintf("duplicated overflow subset %s", name)))
+		}
+		overflowSubsets.Insert(name)
+	}
+
+	fillSubsets := sets.String{}
+	for i, name := range spec.Topology.FillOrder {
+		if !subSetNames.Has(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "fillOrder").Index(i), name, fmt.Sprintf("subset %s does not exist", name)))
+		}
+		if fillSubsets.Has(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "fillOrder").Index(i), name, fmt.Sprintf("duplicated fill subset %s", name)))
+		}
+		fillSubsets.Insert(name)
+	}
+
+	if reserved := spec.Topology.ReservedEmptySubset; reserved != "" {
+		if !subSetNames.Has(reserved) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "reservedEmptySubset"), reserved, fmt.Sprintf("subset %s does not exist", reserved)))
+		}
+		for _, subset := range spec.Topology.Subsets {
+			if subset.Name == reserved && (subset.Replicas != nil || subset.Role == appsv1alpha1.LeaderSubsetRole) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "reservedEmptySubset"), reserved, fmt.Sprintf("reserved empty subset %s should neither indicate replicas nor be the leader", reserved)))
+			}
+		}
+	}
+
+	if ramp := spec.Topology.CanaryRamp; ramp != nil {
+		if !subSetNames.Has(ramp.Subset) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "canaryRamp", "subset"), ramp.Subset, fmt.Sprintf("subset %s does not exist", ramp.Subset)))
+		}
+		for _, subset := range spec.Topology.Subsets {
+			if subset.Name == ramp.Subset && subset.Replicas != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "canaryRamp", "subset"), ramp.Subset, fmt.Sprintf("canary subset %s should not indicate replicas", ramp.Subset)))
+			}
+		}
+		if ramp.TargetPercent < 0 || ramp.TargetPercent > 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "canaryRamp", "targetPercent"), ramp.TargetPercent, "targetPercent should be in range [0, 100]"))
+		}
+		if ramp.RampDurationSeconds < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "canaryRamp", "rampDurationSeconds"), ramp.RampDurationSeconds, "rampDurationSeconds should be greater than 0"))
+		}
+	}
+
+	switch spec.Topology.InitialStrategy {
+	case "", appsv1alpha1.EvenInitialStrategyType, appsv1alpha1.SingleSubsetInitialStrategyType, appsv1alpha1.OrderedInitialStrategyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "initialStrategy"), spec.Topology.InitialStrategy,
+			[]string{string(appsv1alpha1.EvenInitialStrategyType), string(appsv1alpha1.SingleSubsetInitialStrategyType), string(appsv1alpha1.OrderedInitialStrategyType)}))
+	}
+
+	switch spec.Topology.ScheduleStrategy {
+	case "", appsv1alpha1.StrictScheduleStrategyType, appsv1alpha1.BestEffortScheduleStrategyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "scheduleStrategy"), spec.Topology.ScheduleStrategy,
+			[]string{string(appsv1alpha1.StrictScheduleStrategyType), string(appsv1alpha1.BestEffortScheduleStrategyType)}))
+	}
+
+	switch spec.Topology.TieBreak {
+	case "", appsv1alpha1.NameTieBreakPolicyType, appsv1alpha1.RoundRobinTieBreakPolicyType, appsv1alpha1.LeastLoadedTieBreakPolicyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "tieBreak"), spec.Topology.TieBreak,
+			[]string{string(appsv1alpha1.NameTieBreakPolicyType), string(appsv1alpha1.RoundRobinTieBreakPolicyType), string(appsv1alpha1.LeastLoadedTieBreakPolicyType)}))
+	}
+
+	switch spec.Topology.RemainderPolicy {
+	case "", appsv1alpha1.SpreadByNameRemainderPolicyType, appsv1alpha1.SpreadBySmallestRemainderPolicyType, appsv1alpha1.SpreadByLargestRemainderPolicyType,
+		appsv1alpha1.RotateRemainderPolicyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "remainderPolicy"), spec.Topology.RemainderPolicy,
+			[]string{string(appsv1alpha1.SpreadByNameRemainderPolicyType), string(appsv1alpha1.SpreadBySmallestRemainderPolicyType), string(appsv1alpha1.SpreadByLargestRemainderPolicyType),
+				string(appsv1alpha1.RotateRemainderPolicyType)}))
+	}
+
+	switch spec.Topology.RoundingMode {
+	case "", appsv1alpha1.LargestRemainderRoundingModeType, appsv1alpha1.FloorRoundingModeType, appsv1alpha1.CeilRoundingModeType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "roundingMode"), spec.Topology.RoundingMode,
+			[]string{string(appsv1alpha1.LargestRemainderRoundingModeType), string(appsv1alpha1.FloorRoundingModeType), string(appsv1alpha1.CeilRoundingModeType)}))
+	}
+
+	switch spec.Topology.ScaleInPolicy {
+	case "", appsv1alpha1.MostRecentlyScaledOutScaleInPolicyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "scaleInPolicy"), spec.Topology.ScaleInPolicy,
+			[]string{string(appsv1alpha1.MostRecentlyScaledOutScaleInPolicyType)}))
+	}
+
+	switch spec.Topology.ApplyOrder {
+	case "", appsv1alpha1.DownFirstApplyOrderType, appsv1alpha1.UpFirstApplyOrderType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("topology", "applyOrder"), spec.Topology.ApplyOrder,
+			[]string{string(appsv1alpha1.DownFirstApplyOrderType), string(appsv1alpha1.UpFirstApplyOrderType)}))
+	}
+
+	for name, weight := range spec.Topology.PreferredWeights {
+		if !subSetNames.Has(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "preferredWeights"), spec.Topology.PreferredWeights, fmt.Sprintf("subset %s does not exist", name)))
+		}
+		if weight < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "preferredWeights"), spec.Topology.PreferredWeights, fmt.Sprintf("weight of subset %s should not be less than 0", name)))
+		}
+	}
+
+	groups := sets.NewString()
+	for _, subset := range spec.Topology.Subsets {
+		if subset.Group != "" {
+			groups.Insert(subset.Group)
+		}
+	}
+	for group, replicas := range spec.Topology.GroupReplicas {
+		if !groups.Has(group) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupReplicas"), spec.Topology.GroupReplicas, fmt.Sprintf("no subset belongs to group %s", group)))
+		}
+		if replicas < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupReplicas"), spec.Topology.GroupReplicas, fmt.Sprintf("replicas of group %s should not be less than 0", group)))
+		}
+	}
+	if len(spec.Topology.GroupPercentages) > 0 {
+		if len(spec.Topology.GroupReplicas) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupPercentages"), spec.Topology.GroupPercentages, "groupPercentages should not be indicated together with groupReplicas"))
+		}
+		var total int64
+		for group, percentage := range spec.Topology.GroupPercentages {
+			if !groups.Has(group) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupPercentages"), spec.Topology.GroupPercentages, fmt.Sprintf("no subset belongs to group %s", group)))
+			}
+			if percentage < 0 {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupPercentages"), spec.Topology.GroupPercentages, fmt.Sprintf("percentage of group %s should not be less than 0", group)))
+			}
+			total += int64(percentage)
+		}
+		if total != 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "groupPercentages"), spec.Topology.GroupPercentages, fmt.Sprintf("percentages of groups sum to %d, not 100", total)))
+		}
+	}
+
+	if spec.Topology.PreferredBiasPercent != nil {
+		if bias := *spec.Topology.PreferredBiasPercent; bias < 0 || bias > 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "preferredBiasPercent"), bias, "preferredBiasPercent should be in range [0, 100]"))
+		}
+	}
+
+	if spec.Topology.HeadroomPercent != nil {
+		if headroom := *spec.Topology.HeadroomPercent; headroom < 0 || headroom > 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "headroomPercent"), headroom, "headroomPercent should be in range [0, 100]"))
+		}
+	}
+
+	if spec.Topology.MaxTotalReplicas != nil && *spec.Topology.MaxTotalReplicas < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "maxTotalReplicas"), *spec.Topology.MaxTotalReplicas, "maxTotalReplicas should not be less than 0"))
+	}
+
+	if spec.Topology.ScaleDownStabilizationWindowSeconds != nil && *spec.Topology.ScaleDownStabilizationWindowSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "scaleDownStabilizationWindowSeconds"), *spec.Topology.ScaleDownStabilizationWindowSeconds, "scaleDownStabilizationWindowSeconds should not be less than 0"))
+	}
+
+	if spec.Topology.NodeWarmupSeconds != nil && *spec.Topology.NodeWarmupSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "nodeWarmupSeconds"), *spec.Topology.NodeWarmupSeconds, "nodeWarmupSeconds should not be less than 0"))
+	}
+
+	if spec.Topology.MinSubsetReplicasChangeIntervalSeconds != nil && *spec.Topology.MinSubsetReplicasChangeIntervalSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "minSubsetReplicasChangeIntervalSeconds"), *spec.Topology.MinSubsetReplicasChangeIntervalSeconds, "minSubsetReplicasChangeIntervalSeconds should not be less than 0"))
+	}
+
+	if spec.Topology.MaxActiveSubsets != nil && *spec.Topology.MaxActiveSubsets < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "maxActiveSubsets"), *spec.Topology.MaxActiveSubsets, "maxActiveSubsets should be greater than 0"))
+	}
+
+	if weighting := spec.Topology.MemoryHeadroomWeighting; weighting != nil {
+		minShare, maxShare := int32(0), int32(100)
+		if weighting.MinSharePercent != nil {
+			minShare = *weighting.MinSharePercent
+		}
+		if weighting.MaxSharePercent != nil {
+			maxShare = *weighting.MaxSharePercent
+		}
+		if minShare < 0 || maxShare > 100 || minShare > maxShare {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "memoryHeadroomWeighting"), weighting, "minSharePercent and maxSharePercent should be in range [0, 100], and minSharePercent should not be greater than maxSharePercent"))
+		}
+	}
+
+	if spec.Topology.GradualStep != nil && *spec.Topology.GradualStep < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "gradualStep"), *spec.Topology.GradualStep, "gradualStep should be greater than 0"))
+	}
+
+	if spec.Topology.MaxSkew != nil && *spec.Topology.MaxSkew < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "maxSkew"), *spec.Topology.MaxSkew, "maxSkew should be greater than 0"))
+	}
+
+	if spec.Topology.MaxCostBudget != nil && *spec.Topology.MaxCostBudget < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "maxCostBudget"), *spec.Topology.MaxCostBudget, "maxCostBudget should not be less than 0"))
+	}
+
+	if spec.Topology.MinDomains != nil && *spec.Topology.MinDomains < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "minDomains"), *spec.Topology.MinDomains, "minDomains should not be less than 1"))
+	}
+
+	if spec.Topology.MinNonEmptySubsets != nil && *spec.Topology.MinNonEmptySubsets < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("topology", "minNonEmptySubsets"), *spec.Topology.MinNonEmptySubsets, "minNonEmptySubsets should not be less than 0"))
+	}
+
+	if spec.Topology.MaxUnavailableDuringRebalance != nil {
+		allErrs = append(allErrs, appsvalidation.ValidatePositiveIntOrPercent(*spec.Topology.MaxUnavailableDuringRebalance, fldPath.Child("topology", "maxUnavailableDuringRebalance"))...)
+	}
+
+	return allErrs
+}
+
+// validateSubsetDependencies checks that the subsets only depend on existing subsets without cycles.
+func validateSubsetDependencies(subsets []appsv1alpha1.Subset, subSetNames sets.String, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	nameToDependencies := map[string][]string{}
+	for i, subset := range subsets {
+		for _, dependency := range subset.DependsOn {
+			if !subSetNames.Has(dependency) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("dependsOn"), subset.DependsOn, fmt.Sprintf("subset %s does not exist", dependency)))
+			}
+		}
+		nameToDependencies[subset.Name] = subset.DependsOn
+	}
+
+	// visiting marks the subsets on the current path of the depth-first search, and visited the finished ones
+	visiting, visited := sets.String{}, sets.String{}
+	var inCycle func(name string) bool
+	inCycle = func(name string) bool {
+		if visiting.Has(name) {
+			return true
+		}
+		if visited.Has(name) {
+			return false
+		}
+		visiting.Insert(name)
+		for _, dependency := range nameToDependencies[name] {
+			if inCycle(dependency) {
+				return true
+			}
+		}
+		visiting.Delete(name)
+		visited.Insert(name)
+		return false
+	}
+	for i, subset := range subsets {
+		if inCycle(subset.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("dependsOn"), subset.DependsOn, fmt.Sprintf("dependencies of subset %s form a cycle", subset.Name)))
+			break
+		}
+	}
+
 	return allErrs
 }
 
@@ -139,6 +499,20 @@ func validateUnitedDeploymentSpec(spec *appsv1alpha1.UnitedDeploymentSpec, fldPa
 func validateUnitedDeployment(unitedDeployment *appsv1alpha1.UnitedDeployment) field.ErrorList {
 	allErrs := apivalidation.ValidateObjectMeta(&unitedDeployment.ObjectMeta, true, apimachineryvalidation.NameIsDNSSubdomain, field.NewPath("metadata"))
 	allErrs = append(allErrs, validateUnitedDeploymentSpec(&unitedDeployment.Spec, field.NewPath("spec"))...)
+	if _, err := udctrl.ParseSubsetReplicasOverride(unitedDeployment); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "annotations").Key(appsv1alpha1.AnnotationSubsetReplicasOverride),
+			unitedDeployment.Annotations[appsv1alpha1.AnnotationSubsetReplicasOverride], err.Error()))
+	}
+	if _, err := udctrl.ParseFrozenSubsets(unitedDeployment); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "annotations").Key(appsv1alpha1.AnnotationFrozenSubsets),
+			unitedDeployment.Annotations[appsv1alpha1.AnnotationFrozenSubsets], err.Error()))
+	}
+	if err := udctrl.ValidateSpecifiedPercentages(unitedDeployment); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "topology", "subsets"), unitedDeployment.Spec.Topology.Subsets, err.Error()))
+	}
+	if err := udctrl.ValidateRelativeReplicas(unitedDeployment); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "topology", "subsets"), unitedDeployment.Spec.Topology.Subsets, err.Error()))
+	}
 	return allErrs
 }
 
@@ -150,6 +524,23 @@ func ValidateUnitedDeploymentUpdate(unitedDeployment, oldUnitedDeployment *appsv
 	return allErrs
 }
 
+// validateAllocationPlan plans the allocation of the updated UnitedDeployment against the current subset replicas,
+// and rejects it if the specified subset replicas could not satisfy the replicas of the UnitedDeployment. The other
+// failures are left to the controller, since they depend on the state of the cluster rather than the spec alone.
+func validateAllocationPlan(unitedDeployment, oldUnitedDeployment *appsv1alpha1.UnitedDeployment) field.ErrorList {
+	result, err := udctrl.PlanAllocation(unitedDeployment, oldUnitedDeployment.Status.SubsetReplicas)
+	if err == nil {
+		return nil
+	}
+
+	switch result.ReasonCode {
+	case udctrl.OverSpecifiedAllocationReason, udctrl.UnderSpecifiedAllocationReason, udctrl.SpecifiedOutOfBoundsAllocationReason:
+		return field.ErrorList{field.Invalid(field.NewPath("spec", "topology", "subsets"), string(result.ReasonCode),
+			fmt.Sprintf("subset replicas could not be allocated: %s", result.Message))}
+	}
+	return nil
+}
+
 func validateUnitedDeploymentSpecUpdate(spec, oldSpec *appsv1alpha1.UnitedDeploymentSpec, fldPath *field.Path) field.ErrorList {
 	allErrs := field.ErrorList{}
 	allErrs = append(allErrs, validateSubsetTemplateUpdate(&spec.Template, &oldSpec.Template, fldPath.Child("template"))...)
@@ -25,9 +25,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	appsv1alpha1 "github.com/openkruise/kruise/apis/apps/v1alpha1"
 	appsv1beta1 "github.com/openkruise/kruise/apis/apps/v1beta1"
+	udctrl "github.com/openkruise/kruise/pkg/controller/uniteddeployment"
 )
 
 func TestValidateUnitedDeployment(t *testing.T) {
@@ -50,6 +52,9 @@ func TestValidateUnitedDeployment(t *testing.T) {
 	replicas2 := intstr.FromString("90%")
 	replicas3 := intstr.FromString("71%")
 	replicas4 := intstr.FromString("29%")
+	invalidSmoothingAlpha := int32(0)
+	invalidMaxActiveSubsets := int32(0)
+	zeroReplicas := int32(0)
 	successCases := []appsv1alpha1.UnitedDeployment{
 		{
 			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
@@ -206,6 +211,17 @@ func TestValidateUnitedDeployment(t *testing.T) {
 		})
 	}
 
+	maxReplicas := int32(1)
+	negativeSoftMinReplicas := int32(-1)
+	negativeSystemReservedReplicas := int32(-1)
+	maxReplicas2 := int32(2)
+	maxReplicasValue := intstr.FromInt(2)
+	systemReservedReplicas := int32(1)
+	overPercentReplicas := intstr.FromString("150%")
+	negativePercentReplicas := intstr.FromString("-5%")
+	invalidRebalanceBudget := intstr.FromString("20")
+	zeroGradualStep := int32(0)
+	zeroMaxSkew := int32(0)
 	errorCases := map[string]appsv1alpha1.UnitedDeployment{
 		"no pod template label": {
 			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
@@ -543,6 +559,696 @@ func TestValidateUnitedDeployment(t *testing.T) {
 				},
 			},
 		},
+		"invalid smoothing alpha": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					SmoothingAlphaPercent: &invalidSmoothingAlpha,
+				},
+			},
+		},
+		"invalid ramp curve": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					RampCurve: "Cubic",
+				},
+			},
+		},
+		"cyclic subset dependencies": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:      "subset-a",
+							DependsOn: []string{"subset-b"},
+						},
+						{
+							Name:      "subset-b",
+							DependsOn: []string{"subset-a"},
+						},
+					},
+				},
+			},
+		},
+		"replicas over max replicas": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:        "subset",
+							Replicas:    &replicas2,
+							MaxReplicas: &maxReplicas,
+						},
+					},
+				},
+			},
+		},
+		"replicas over max replicas minus system reserved replicas": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:                   "subset",
+							Replicas:               &maxReplicasValue,
+							MaxReplicas:            &maxReplicas2,
+							SystemReservedReplicas: &systemReservedReplicas,
+						},
+					},
+				},
+			},
+		},
+		"percentage replicas over 100%": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:     "subset1",
+							Replicas: &overPercentReplicas,
+						},
+						{
+							Name: "subset2",
+						},
+					},
+				},
+			},
+		},
+		"negative percentage replicas": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:     "subset1",
+							Replicas: &negativePercentReplicas,
+						},
+						{
+							Name: "subset2",
+						},
+					},
+				},
+			},
+		},
+		"negative soft min replicas": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:            "subset",
+							SoftMinReplicas: &negativeSoftMinReplicas,
+						},
+					},
+				},
+			},
+		},
+		"negative system reserved replicas": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:                   "subset",
+							SystemReservedReplicas: &negativeSystemReservedReplicas,
+						},
+					},
+				},
+			},
+		},
+		"invalid max unavailable during rebalance": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					MaxUnavailableDuringRebalance: &invalidRebalanceBudget,
+				},
+			},
+		},
+		"invalid gradual step": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					GradualStep: &zeroGradualStep,
+				},
+			},
+		},
+		"invalid max skew": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					MaxSkew: &zeroMaxSkew,
+				},
+			},
+		},
+		"group replicas of unknown group": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					GroupReplicas: map[string]int32{"unknown": 1},
+				},
+			},
+		},
+		"group percentages summing to 90": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:  "spot",
+							Group: "spot",
+						},
+						{
+							Name:  "on-demand",
+							Group: "on-demand",
+						},
+					},
+					GroupPercentages: map[string]int32{"spot": 70, "on-demand": 20},
+				},
+			},
+		},
+		"specified percentages summing to 90%": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &zeroReplicas,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:     "subset-a",
+							Replicas: &intstr.IntOrString{Type: intstr.String, StrVal: "40%"},
+						},
+						{
+							Name:     "subset-b",
+							Replicas: &intstr.IntOrString{Type: intstr.String, StrVal: "50%"},
+						},
+					},
+				},
+			},
+		},
+		"subset replicas relative to each other": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:       "subset-a",
+							RelativeTo: &appsv1alpha1.RelativeReplicas{Subset: "subset-b", RatioPercent: 50},
+						},
+						{
+							Name:       "subset-b",
+							RelativeTo: &appsv1alpha1.RelativeReplicas{Subset: "subset-a", RatioPercent: 200},
+						},
+					},
+				},
+			},
+		},
+		"subset replicas override of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "abc",
+				Namespace:   metav1.NamespaceDefault,
+				Annotations: map[string]string{appsv1alpha1.AnnotationSubsetReplicasOverride: `{"unknown": 1}`},
+			},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+				},
+			},
+		},
+		"frozen subsets of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "abc",
+				Namespace:   metav1.NamespaceDefault,
+				Annotations: map[string]string{appsv1alpha1.AnnotationFrozenSubsets: "unknown"},
+			},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+				},
+			},
+		},
+		"overflow subset of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					OverflowOrder: []string{"spare"},
+				},
+			},
+		},
+		"fill subset of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					FillOrder: []string{"spare"},
+				},
+			},
+		},
+		"reserved empty subset of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					ReservedEmptySubset: "canary",
+				},
+			},
+		},
+		"preferred weight of unknown subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					PreferredWeights: map[string]int32{"subset": 1, "unknown": 1},
+				},
+			},
+		},
+		"more than one leader subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset-a",
+							Role: appsv1alpha1.LeaderSubsetRole,
+						},
+						{
+							Name: "subset-b",
+							Role: appsv1alpha1.LeaderSubsetRole,
+						},
+					},
+				},
+			},
+		},
+		"more than one catch-all subset": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name:     "subset-a",
+							CatchAll: true,
+						},
+						{
+							Name:     "subset-b",
+							CatchAll: true,
+						},
+					},
+				},
+			},
+		},
+		"follower subsets without leader": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+							Role: appsv1alpha1.FollowerSubsetRole,
+						},
+					},
+				},
+			},
+		},
+		"invalid max active subsets": {
+			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+			Spec: appsv1alpha1.UnitedDeploymentSpec{
+				Replicas: &val,
+				Selector: &metav1.LabelSelector{MatchLabels: validLabels},
+				Template: appsv1alpha1.SubsetTemplate{
+					StatefulSetTemplate: &appsv1alpha1.StatefulSetTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: validLabels,
+						},
+						Spec: apps.StatefulSetSpec{
+							Template: validPodTemplate.Template,
+						},
+					},
+				},
+				Topology: appsv1alpha1.Topology{
+					Subsets: []appsv1alpha1.Subset{
+						{
+							Name: "subset",
+						},
+					},
+					MaxActiveSubsets: &invalidMaxActiveSubsets,
+				},
+			},
+		},
 		"deployment no pod template termination policy": {
 			ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
 			Spec: appsv1alpha1.UnitedDeploymentSpec{
@@ -584,6 +1290,24 @@ func TestValidateUnitedDeployment(t *testing.T) {
 					field != "spec.topology.subsets[0]" &&
 					field != "spec.topology.subsets[0].name" &&
 					field != "spec.updateStrategy.partitions" &&
+					field != "spec.topology.smoothingAlphaPercent" &&
+					field != "spec.topology.preferredWeights" &&
+					field != "spec.topology.maxActiveSubsets" &&
+					field != "spec.topology.maxUnavailableDuringRebalance" &&
+					field != "spec.topology.gradualStep" &&
+					field != "spec.topology.maxSkew" &&
+					field != "spec.topology.groupReplicas" &&
+					field != "spec.topology.groupPercentages" &&
+					field != "metadata.annotations[apps.kruise.io/subset-replicas-override]" &&
+					field != "metadata.annotations[apps.kruise.io/frozen-subsets]" &&
+					field != "spec.topology.rampCurve" &&
+					field != "spec.topology.reservedEmptySubset" &&
+					field != "spec.topology.overflowOrder[0]" &&
+					field != "spec.topology.fillOrder[0]" &&
+					field != "spec.topology.subsets[0].dependsOn" &&
+					field != "spec.topology.subsets[0].replicas" &&
+					field != "spec.topology.subsets[0].softMinReplicas" &&
+					field != "spec.topology.subsets[0].systemReservedReplicas" &&
 					field != "spec.topology.subsets[0].nodeSelectorTerm.matchExpressions[0].values" {
 					t.Errorf("%s: missing prefix for: %v", k, errs[i])
 				}
@@ -597,6 +1321,37 @@ type UpdateCase struct {
 	New appsv1alpha1.UnitedDeployment
 }
 
+func TestValidateSubsetReplicasOverflow(t *testing.T) {
+	replicas := int32(10)
+	overflow := intstr.FromInt(11)
+	ud := appsv1alpha1.UnitedDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+		Spec: appsv1alpha1.UnitedDeploymentSpec{
+			Replicas: &replicas,
+			Topology: appsv1alpha1.Topology{
+				Subsets: []appsv1alpha1.Subset{{Name: "subset-a", Replicas: &overflow}, {Name: "subset-b"}},
+			},
+		},
+	}
+	setTestDefault(&ud)
+
+	var found bool
+	for _, err := range validateUnitedDeployment(&ud) {
+		if err.Field == "spec.topology.subsets" {
+			t.Errorf("expected the overflow to be reported on the subset only, got %v", err)
+		}
+		if err.Field == "spec.topology.subsets[0].replicas" {
+			found = true
+			if !strings.Contains(err.Detail, "replicas 11 should not be greater than UnitedDeployment replicas 10") {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected the replicas of subset-a to be rejected")
+	}
+}
+
 func TestValidateUnitedDeploymentUpdate(t *testing.T) {
 	validLabels := map[string]string{"a": "b"}
 	validPodTemplate := corev1.PodTemplate{
@@ -965,6 +1720,14 @@ func TestValidateUnitedDeploymentUpdate(t *testing.T) {
 					field != "spec.topology.subset" &&
 					field != "spec.topology.subset.name" &&
 					field != "spec.updateStrategy.partitions" &&
+					field != "spec.topology.smoothingAlphaPercent" &&
+					field != "spec.topology.preferredWeights" &&
+					field != "spec.topology.maxActiveSubsets" &&
+					field != "spec.topology.rampCurve" &&
+					field != "spec.topology.reservedEmptySubset" &&
+					field != "spec.topology.overflowOrder[0]" &&
+					field != "spec.topology.subsets[0].dependsOn" &&
+					field != "spec.topology.subsets[0].replicas" &&
 					field != "spec.topology.subsets[0].nodeSelectorTerm" {
 					t.Errorf("%s: missing prefix for: %v", k, errs[i])
 				}
@@ -973,6 +1736,99 @@ func TestValidateUnitedDeploymentUpdate(t *testing.T) {
 	}
 }
 
+func TestValidateSpecifiedPercentagesSum(t *testing.T) {
+	p30, p33, p49, p50 := intstr.FromString("30%"), intstr.FromString("33%"), intstr.FromString("49%"), intstr.FromString("50%")
+	cases := map[string]struct {
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		rejected bool
+	}{
+		"33% of 10 for each of three subsets": {
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p33}, {Name: "t2", Replicas: &p33}, {Name: "t3", Replicas: &p33}},
+		},
+		"sum to 99% of 100 within the tolerance": {
+			replicas: 100,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p50}, {Name: "t2", Replicas: &p49}},
+		},
+		"sum to 90% out of the tolerance": {
+			replicas: 10,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &p30}, {Name: "t2", Replicas: &p30}, {Name: "t3", Replicas: &p30}},
+			rejected: true,
+		},
+	}
+
+	for k, v := range cases {
+		t.Run(k, func(t *testing.T) {
+			ud := appsv1alpha1.UnitedDeployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "abc", Namespace: metav1.NamespaceDefault},
+				Spec: appsv1alpha1.UnitedDeploymentSpec{
+					Replicas: &v.replicas,
+					Topology: appsv1alpha1.Topology{Subsets: v.subsets},
+				},
+			}
+			setTestDefault(&ud)
+
+			var errs field.ErrorList
+			for _, err := range validateUnitedDeployment(&ud) {
+				if strings.HasPrefix(err.Field, "spec.topology.subsets") {
+					errs = append(errs, err)
+				}
+			}
+			if rejected := len(errs) != 0; rejected != v.rejected {
+				t.Fatalf("expected rejected %v, got %v", v.rejected, errs)
+			}
+		})
+	}
+}
+
+func TestValidateAllocationPlan(t *testing.T) {
+	maxReplicas := int32(2)
+	three := intstr.FromInt(3)
+	lastStable := intstr.FromString(appsv1alpha1.SubsetReplicasLastStable)
+	cases := map[string]struct {
+		replicas int32
+		subsets  []appsv1alpha1.Subset
+		rejected bool
+	}{
+		"subsets able to hold the replicas": {
+			replicas: 4,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: &maxReplicas}, {Name: "t2", MaxReplicas: &maxReplicas}},
+		},
+		"all subsets capped": {
+			replicas: 5,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", MaxReplicas: &maxReplicas}, {Name: "t2", MaxReplicas: &maxReplicas}},
+		},
+		"subsets over specified": {
+			replicas: 4,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &three}, {Name: "t2", Replicas: &three}},
+			rejected: true,
+		},
+		"last stable replicas not recorded yet": {
+			replicas: 4,
+			subsets:  []appsv1alpha1.Subset{{Name: "t1", Replicas: &lastStable}, {Name: "t2"}},
+		},
+	}
+
+	for k, v := range cases {
+		t.Run(k, func(t *testing.T) {
+			old := appsv1alpha1.UnitedDeployment{Status: appsv1alpha1.UnitedDeploymentStatus{SubsetReplicas: map[string]int32{"t1": 2, "t2": 2}}}
+			ud := old.DeepCopy()
+			ud.Spec.Replicas = &v.replicas
+			ud.Spec.Topology.Subsets = v.subsets
+			errs := validateAllocationPlan(ud, &old)
+			if rejected := len(errs) != 0; rejected != v.rejected {
+				t.Fatalf("expected rejected %v, got %v", v.rejected, errs)
+			}
+			for i := range errs {
+				if errs[i].Field != "spec.topology.subsets" || !strings.Contains(errs[i].Error(), string(udctrl.OverSpecifiedAllocationReason)) {
+					t.Errorf("unexpected error %v", errs[i])
+				}
+			}
+		})
+	}
+}
+
 func setTestDefault(obj *appsv1alpha1.UnitedDeployment) {
 	if obj.Spec.Replicas == nil {
 		obj.Spec.Replicas = new(int32)